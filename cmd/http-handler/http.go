@@ -7,7 +7,11 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo"
 	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"github.com/novalwardhana/golang-boilerplate/config/jwtkey"
 	"github.com/novalwardhana/golang-boilerplate/config/postgres"
+	"github.com/novalwardhana/golang-boilerplate/helper/oidc"
+	"github.com/novalwardhana/golang-boilerplate/helper/password"
+	"github.com/novalwardhana/golang-boilerplate/middleware/auth"
 
 	crudHandler "github.com/novalwardhana/golang-boilerplate/module/crud/handler"
 	crudRepository "github.com/novalwardhana/golang-boilerplate/module/crud/repository"
@@ -21,6 +25,14 @@ import (
 	userManagementRepository "github.com/novalwardhana/golang-boilerplate/module/user-management/repository"
 	userManagementUsecase "github.com/novalwardhana/golang-boilerplate/module/user-management/usecase"
 
+	roleManagementHandler "github.com/novalwardhana/golang-boilerplate/module/role-management/handler"
+	roleManagementRepository "github.com/novalwardhana/golang-boilerplate/module/role-management/repository"
+	roleManagementUsecase "github.com/novalwardhana/golang-boilerplate/module/role-management/usecase"
+
+	organizationManagementHandler "github.com/novalwardhana/golang-boilerplate/module/organization-management/handler"
+	organizationManagementRepository "github.com/novalwardhana/golang-boilerplate/module/organization-management/repository"
+	organizationManagementUsecase "github.com/novalwardhana/golang-boilerplate/module/organization-management/usecase"
+
 	fileHandler "github.com/novalwardhana/golang-boilerplate/module/file/handler"
 	fileRepository "github.com/novalwardhana/golang-boilerplate/module/file/repository"
 	fileUsecase "github.com/novalwardhana/golang-boilerplate/module/file/usecase"
@@ -49,29 +61,56 @@ func RunHTTPHandler() {
 		return
 	}
 
+	if err := jwtkey.Init(); err != nil {
+		fmt.Println("Error load JWT key: ", err.Error())
+		return
+	}
+
 	e := echo.New()
 
 	/* Create DB Connection */
 	dbMaster := postgres.DBMasterConnection()
 
+	/* Token revocation checked by auth middleware */
+	auth.SetRepository(auth.NewRepository(dbMaster))
+
+	/* Password hasher shared by user modules */
+	passwordHasher := password.NewHasher(password.ConfigFromEnv())
+
 	/* CRUD module */
 	crudRepository := crudRepository.NewRepository(dbMaster)
 	crudUsecase := crudUsecase.NewUsecase(crudRepository)
 	crudHandler := crudHandler.NewHandler(crudUsecase)
 	crudHandler.Mount(e.Group("/api/v1/crud"))
 
+	/* Email repository shared by user modules */
+	emailRepository := emailRepository.NewRepository()
+
 	/* User Authentication */
 	userAuthenticationRepository := userAuthenticationRepository.NewRepository(dbMaster)
-	userAuthenticationUsecase := userAuthenticationUsecase.NewUsecase(userAuthenticationRepository)
+	userAuthenticationUsecase := userAuthenticationUsecase.NewUsecase(userAuthenticationRepository, passwordHasher, emailRepository, oidc.NewProvider(oidc.ConfigFromEnv()))
 	userAuthenticationHandler := userAuthenticationHandler.NewHandler(userAuthenticationUsecase)
 	userAuthenticationHandler.Mount(e.Group("/api/v1/user-authentication"))
+	userAuthenticationHandler.MountWellKnown(e.Group("/.well-known"))
 
 	/* User Management */
 	userManagenentRepository := userManagementRepository.NewRepository(dbMaster)
-	userManagementUsecase := userManagementUsecase.NewUsecase(userManagenentRepository)
+	userManagementUsecase := userManagementUsecase.NewUsecase(userManagenentRepository, passwordHasher, emailRepository)
 	userManagementHandler := userManagementHandler.NewHandler(userManagementUsecase)
 	userManagementHandler.Mount(e.Group("/api/v1/user-management"))
 
+	/* Role Management */
+	roleManagementRepository := roleManagementRepository.NewRepository(dbMaster)
+	roleManagementUsecase := roleManagementUsecase.NewUsecase(roleManagementRepository)
+	roleManagementHandler := roleManagementHandler.NewHandler(roleManagementUsecase)
+	roleManagementHandler.Mount(e.Group("/api/v1/role-management"))
+
+	/* Organization Management */
+	organizationManagementRepository := organizationManagementRepository.NewRepository(dbMaster)
+	organizationManagementUsecase := organizationManagementUsecase.NewUsecase(organizationManagementRepository)
+	organizationManagementHandler := organizationManagementHandler.NewHandler(organizationManagementUsecase)
+	organizationManagementHandler.Mount(e.Group("/api/v1/organization-management"))
+
 	/* File */
 	fileRepository := fileRepository.NewRepository(dbMaster)
 	fileUsecase := fileUsecase.NewUsecase(fileRepository)
@@ -91,7 +130,6 @@ func RunHTTPHandler() {
 	httpClientHandler.Mount(e.Group("/api/v1/http-client"))
 
 	/* Email */
-	emailRepository := emailRepository.NewRepository()
 	emailUsecase := emailUsecase.NewUsecase(emailRepository)
 	emailHandler := emailHandler.NewHandler(emailUsecase)
 	emailHandler.Mount(e.Group("/api/v1/email"))
@@ -1,6 +1,13 @@
 package env
 
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
 const EnvPort string = "PORT"
+const EnvTrustedProxies string = "TRUSTED_PROXIES"
 
 const EnvAdvanceCrudDirectory string = "ADVANCE_CRUD_DIRECTORY"
 const EnvFileDirectory string = "FILE_DIRECTORY"
@@ -13,3 +20,70 @@ const EnvEmailPort string = "EMAIL_PORT"
 const EnvEmailUser string = "EMAIL_USER"
 const EnvEmailPassword string = "EMAIL_PASSWORD"
 const EnvEmailAttachmentDirectory string = "EMAIL_ATTACHMENT_DIRECTORY"
+
+const EnvJWTAccessTokenTTL string = "JWT_ACCESS_TOKEN_TTL"
+const EnvJWTRefreshTokenTTL string = "JWT_REFRESH_TOKEN_TTL"
+const EnvJWTSigningMethod string = "JWT_SIGNING_METHOD"
+const EnvJWTSigningKeyID string = "JWT_SIGNING_KEY_ID"
+const EnvJWTSigningKeyFile string = "JWT_SIGNING_KEY_FILE"
+const EnvJWTVerificationKeys string = "JWT_VERIFICATION_KEYS"
+
+const EnvPasswordResetURL string = "PASSWORD_RESET_URL"
+const EnvPasswordResetTTL string = "PASSWORD_RESET_TTL"
+
+const EnvEmailVerificationURL string = "EMAIL_VERIFICATION_URL"
+const EnvEmailVerificationTTL string = "EMAIL_VERIFICATION_TTL"
+const EnvLoginUnverifiedPolicy string = "LOGIN_UNVERIFIED_POLICY"
+
+const EnvMFAIssuer string = "MFA_ISSUER"
+const EnvMFAChallengeTTL string = "MFA_CHALLENGE_TTL"
+
+const EnvLoginMaxAttempts string = "LOGIN_MAX_ATTEMPTS"
+const EnvLoginMaxAttemptsPerIP string = "LOGIN_MAX_ATTEMPTS_PER_IP"
+const EnvLoginFailureWindow string = "LOGIN_FAILURE_WINDOW"
+const EnvLoginLockoutDuration string = "LOGIN_LOCKOUT_DURATION"
+const EnvLoginLockoutMaxDuration string = "LOGIN_LOCKOUT_MAX_DURATION"
+const EnvLoginFailureDelay string = "LOGIN_FAILURE_DELAY"
+const EnvLoginFailureMaxDelay string = "LOGIN_FAILURE_MAX_DELAY"
+
+const EnvImpersonationTTL string = "IMPERSONATION_TTL"
+
+const EnvUserImportBatchSize string = "USER_IMPORT_BATCH_SIZE"
+const EnvUserImportMaxRows string = "USER_IMPORT_MAX_ROWS"
+const EnvUserInviteTTL string = "USER_INVITE_TTL"
+const EnvUserInvitationURL string = "USER_INVITATION_URL"
+
+const EnvCrudBatchMaxSize string = "CRUD_BATCH_MAX_SIZE"
+
+const EnvOIDCProviderName string = "OIDC_PROVIDER_NAME"
+const EnvOIDCIssuer string = "OIDC_ISSUER"
+const EnvOIDCClientID string = "OIDC_CLIENT_ID"
+const EnvOIDCClientSecret string = "OIDC_CLIENT_SECRET"
+const EnvOIDCRedirectURL string = "OIDC_REDIRECT_URL"
+const EnvOIDCScopes string = "OIDC_SCOPES"
+const EnvOIDCDefaultRoles string = "OIDC_DEFAULT_ROLES"
+const EnvOIDCStateTTL string = "OIDC_STATE_TTL"
+
+const EnvPasswordHashAlgorithm string = "PASSWORD_HASH_ALGORITHM"
+const EnvPasswordBcryptCost string = "PASSWORD_BCRYPT_COST"
+const EnvPasswordArgon2Memory string = "PASSWORD_ARGON2_MEMORY"
+const EnvPasswordArgon2Iterations string = "PASSWORD_ARGON2_ITERATIONS"
+const EnvPasswordArgon2Parallelism string = "PASSWORD_ARGON2_PARALLELISM"
+
+// GetDuration: read duration value (ex: 15m, 24h), return fallback when empty or not valid
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// GetInt: read integer value, return fallback when empty or not valid
+func GetInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
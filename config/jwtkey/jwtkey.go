@@ -0,0 +1,287 @@
+package jwtkey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"github.com/novalwardhana/golang-boilerplate/helper/token"
+)
+
+type KeySet struct {
+	method           jwt.SigningMethod
+	signingKeyID     string
+	signingKey       crypto.PrivateKey
+	verificationKeys map[string]crypto.PublicKey
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+var defaultKeySet *KeySet
+
+// Init: load key set from env and use it as default key set
+func Init() error {
+	keySet, err := Load()
+	if err != nil {
+		return err
+	}
+	defaultKeySet = keySet
+	return nil
+}
+
+// Load: read signing key and verification keys, create ephemeral signing key when key file not set
+func Load() (*KeySet, error) {
+	keySet := &KeySet{
+		verificationKeys: map[string]crypto.PublicKey{},
+	}
+
+	/* Signing method */
+	switch strings.ToUpper(os.Getenv(env.EnvJWTSigningMethod)) {
+	case "", "RS256":
+		keySet.method = jwt.SigningMethodRS256
+	case "ES256":
+		keySet.method = jwt.SigningMethodES256
+	default:
+		return nil, fmt.Errorf("JWT signing method %s not supported", os.Getenv(env.EnvJWTSigningMethod))
+	}
+
+	/* Signing key */
+	keySet.signingKeyID = os.Getenv(env.EnvJWTSigningKeyID)
+	signingKeyFile := os.Getenv(env.EnvJWTSigningKeyFile)
+	if len(signingKeyFile) == 0 {
+		signingKey, err := generateKey(keySet.method)
+		if err != nil {
+			return nil, err
+		}
+		keySet.signingKey = signingKey
+		if len(keySet.signingKeyID) == 0 {
+			id, err := token.NewID()
+			if err != nil {
+				return nil, err
+			}
+			keySet.signingKeyID = "ephemeral-" + id
+		}
+		fmt.Println("Warning: JWT signing key file not set, using ephemeral key ", keySet.signingKeyID)
+	} else {
+		if len(keySet.signingKeyID) == 0 {
+			return nil, errors.New("JWT signing key id must be filled")
+		}
+		pemByte, err := ioutil.ReadFile(signingKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if keySet.method == jwt.SigningMethodES256 {
+			keySet.signingKey, err = jwt.ParseECPrivateKeyFromPEM(pemByte)
+		} else {
+			keySet.signingKey, err = jwt.ParseRSAPrivateKeyFromPEM(pemByte)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch signingKey := keySet.signingKey.(type) {
+	case *rsa.PrivateKey:
+		keySet.verificationKeys[keySet.signingKeyID] = &signingKey.PublicKey
+	case *ecdsa.PrivateKey:
+		if signingKey.Curve != elliptic.P256() {
+			return nil, errors.New("ES256 signing key must use P-256 curve")
+		}
+		keySet.verificationKeys[keySet.signingKeyID] = &signingKey.PublicKey
+	}
+
+	/* Verification keys, format: kid=path,kid=path */
+	for _, item := range strings.Split(os.Getenv(env.EnvJWTVerificationKeys), ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		pair := strings.SplitN(item, "=", 2)
+		if len(pair) != 2 || len(pair[0]) == 0 || len(pair[1]) == 0 {
+			return nil, fmt.Errorf("JWT verification key %s not valid", item)
+		}
+		pemByte, err := ioutil.ReadFile(pair[1])
+		if err != nil {
+			return nil, err
+		}
+		if publicKey, err := jwt.ParseRSAPublicKeyFromPEM(pemByte); err == nil {
+			keySet.verificationKeys[pair[0]] = publicKey
+			continue
+		}
+		publicKey, err := jwt.ParseECPublicKeyFromPEM(pemByte)
+		if err != nil {
+			return nil, fmt.Errorf("JWT verification key %s must be RSA or EC public key", pair[0])
+		}
+		keySet.verificationKeys[pair[0]] = publicKey
+	}
+
+	return keySet, nil
+}
+
+// Sign: sign claims with active signing key, the key id is written in kid header
+func Sign(claims jwt.Claims) (string, error) {
+	if defaultKeySet == nil {
+		return "", errors.New("JWT key not initialized")
+	}
+	return defaultKeySet.Sign(claims)
+}
+
+// Keyfunc: resolve verification key from kid header, used by jwt.Parse
+func Keyfunc(t *jwt.Token) (interface{}, error) {
+	if defaultKeySet == nil {
+		return nil, errors.New("JWT key not initialized")
+	}
+	return defaultKeySet.Keyfunc(t)
+}
+
+// JWKS: public part of all active verification keys
+func JWKS() JSONWebKeySet {
+	if defaultKeySet == nil {
+		return JSONWebKeySet{Keys: []JSONWebKey{}}
+	}
+	return defaultKeySet.JWKS()
+}
+
+// Sign:
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	jwtToken := jwt.NewWithClaims(k.method, claims)
+	jwtToken.Header["kid"] = k.signingKeyID
+	return jwtToken.SignedString(k.signingKey)
+}
+
+// Keyfunc:
+func (k *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	publicKey, ok := k.verificationKeys[kid]
+	if !ok {
+		return nil, errors.New("Token key id not valid")
+	}
+
+	/* Algorithm must follow the key type, prevent algorithm confusion */
+	if t.Method.Alg() != algorithm(publicKey) {
+		return nil, errors.New("Token signing method not valid")
+	}
+	return publicKey, nil
+}
+
+// JWKS:
+func (k *KeySet) JWKS() JSONWebKeySet {
+	keys := []JSONWebKey{}
+	for kid, publicKey := range k.verificationKeys {
+		switch publicKey := publicKey.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, JSONWebKey{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: jwt.SigningMethodRS256.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			size := (publicKey.Curve.Params().BitSize + 7) / 8
+			keys = append(keys, JSONWebKey{
+				Kty: "EC",
+				Kid: kid,
+				Use: "sig",
+				Alg: jwt.SigningMethodES256.Alg(),
+				Crv: publicKey.Curve.Params().Name,
+				X:   base64.RawURLEncoding.EncodeToString(padLeft(publicKey.X.Bytes(), size)),
+				Y:   base64.RawURLEncoding.EncodeToString(padLeft(publicKey.Y.Bytes(), size)),
+			})
+		}
+	}
+	return JSONWebKeySet{Keys: keys}
+}
+
+// PublicKey: convert RSA or EC P-256 web key to public key, used to verify token from other issuer
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("JSON web key %s not valid", k.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != elliptic.P256().Params().Name {
+			return nil, fmt.Errorf("JSON web key %s curve %s not supported", k.Kid, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, fmt.Errorf("JSON web key %s not valid", k.Kid)
+		}
+		return publicKey, nil
+	}
+	return nil, fmt.Errorf("JSON web key type %s not supported", k.Kty)
+}
+
+// Algorithm: signing algorithm that must be used with the public key
+func Algorithm(publicKey crypto.PublicKey) string {
+	return algorithm(publicKey)
+}
+
+func generateKey(method jwt.SigningMethod) (crypto.PrivateKey, error) {
+	if method == jwt.SigningMethodES256 {
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+func algorithm(publicKey crypto.PublicKey) string {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256.Alg()
+	case *ecdsa.PublicKey:
+		return jwt.SigningMethodES256.Alg()
+	}
+	return ""
+}
+
+func padLeft(value []byte, size int) []byte {
+	if len(value) >= size {
+		return value
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(value):], value)
+	return padded
+}
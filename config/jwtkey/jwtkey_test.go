@@ -0,0 +1,285 @@
+package jwtkey
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/novalwardhana/golang-boilerplate/config/env"
+)
+
+// setEnv: set the JWT env for one test, previous value is restored on cleanup
+func setEnv(t *testing.T, values map[string]string) {
+	t.Helper()
+	for _, key := range []string{env.EnvJWTSigningMethod, env.EnvJWTSigningKeyID, env.EnvJWTSigningKeyFile, env.EnvJWTVerificationKeys} {
+		previous, ok := os.LookupEnv(key)
+		os.Setenv(key, values[key])
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, previous)
+				return
+			}
+			os.Unsetenv(key)
+		})
+	}
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "jwtkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func claims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+func TestLoadEphemeral(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		alg    string
+		kty    string
+	}{
+		{name: "default", method: "", alg: "RS256", kty: "RSA"},
+		{name: "RS256", method: "rs256", alg: "RS256", kty: "RSA"},
+		{name: "ES256", method: "ES256", alg: "ES256", kty: "EC"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, map[string]string{env.EnvJWTSigningMethod: test.method})
+			keySet, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			/* Sign and verify round trip */
+			signed, err := keySet.Sign(claims())
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			parsed, err := jwt.Parse(signed, keySet.Keyfunc)
+			if err != nil || !parsed.Valid {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if parsed.Header["alg"] != test.alg || parsed.Header["kid"] != keySet.signingKeyID {
+				t.Errorf("header = %v, want alg %s and kid %s", parsed.Header, test.alg, keySet.signingKeyID)
+			}
+
+			/* Published key verify the token too */
+			jwks := keySet.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Kty != test.kty || jwks.Keys[0].Alg != test.alg {
+				t.Fatalf("JWKS() = %+v", jwks)
+			}
+			publicKey, err := jwks.Keys[0].PublicKey()
+			if err != nil {
+				t.Fatalf("PublicKey() error = %v", err)
+			}
+			if _, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return publicKey, nil }); err != nil {
+				t.Errorf("Parse() with JWKS key error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	dir := tempDir(t)
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384DER, err := x509.MarshalECPrivateKey(p384Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384File := writePEM(t, dir, "p384.pem", "EC PRIVATE KEY", p384DER)
+
+	tests := []struct {
+		name   string
+		values map[string]string
+	}{
+		{name: "unsupported method", values: map[string]string{env.EnvJWTSigningMethod: "HS256"}},
+		{name: "key file without key id", values: map[string]string{env.EnvJWTSigningKeyFile: p384File}},
+		{name: "missing key file", values: map[string]string{env.EnvJWTSigningKeyID: "k1", env.EnvJWTSigningKeyFile: filepath.Join(dir, "missing.pem")}},
+		{name: "curve not P-256", values: map[string]string{env.EnvJWTSigningMethod: "ES256", env.EnvJWTSigningKeyID: "k1", env.EnvJWTSigningKeyFile: p384File}},
+		{name: "verification key without path", values: map[string]string{env.EnvJWTVerificationKeys: "old="}},
+		{name: "verification key not public key", values: map[string]string{env.EnvJWTVerificationKeys: "old=" + p384File}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, test.values)
+			if _, err := Load(); err == nil {
+				t.Error("Load() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := tempDir(t)
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPublicDER, err := x509.MarshalPKIXPublicKey(&oldKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDER, err := x509.MarshalECPrivateKey(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldFile := writePEM(t, dir, "old.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(oldKey))
+	oldPublicFile := writePEM(t, dir, "old.pub.pem", "PUBLIC KEY", oldPublicDER)
+	newFile := writePEM(t, dir, "new.pem", "EC PRIVATE KEY", newDER)
+
+	/* Token signed before the rotation */
+	setEnv(t, map[string]string{env.EnvJWTSigningKeyID: "old", env.EnvJWTSigningKeyFile: oldFile})
+	oldKeySet, err := Load()
+	if err != nil {
+		t.Fatalf("Load() old error = %v", err)
+	}
+	oldToken, err := oldKeySet.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* New signing key, old key is kept for verification only */
+	setEnv(t, map[string]string{
+		env.EnvJWTSigningMethod:    "ES256",
+		env.EnvJWTSigningKeyID:     "new",
+		env.EnvJWTSigningKeyFile:   newFile,
+		env.EnvJWTVerificationKeys: " old=" + oldPublicFile + " ,",
+	})
+	keySet, err := Load()
+	if err != nil {
+		t.Fatalf("Load() new error = %v", err)
+	}
+	newToken, err := keySet.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, signed := range map[string]string{"old token": oldToken, "new token": newToken} {
+		if _, err := jwt.Parse(signed, keySet.Keyfunc); err != nil {
+			t.Errorf("Parse(%s) error = %v", name, err)
+		}
+	}
+	if len(keySet.JWKS().Keys) != 2 {
+		t.Errorf("JWKS() has %d keys, want 2", len(keySet.JWKS().Keys))
+	}
+
+	/* Token of the new key is unknown to the old key set */
+	if _, err := jwt.Parse(newToken, oldKeySet.Keyfunc); err == nil {
+		t.Error("Parse() new token with old key set error = nil, want error")
+	}
+}
+
+func TestKeyfuncRefuse(t *testing.T) {
+	setEnv(t, map[string]string{env.EnvJWTSigningKeyID: "k1"})
+	keySet, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey := keySet.signingKey.(*rsa.PrivateKey)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid interface{}, key interface{}) string {
+		jwtToken := jwt.NewWithClaims(method, claims())
+		if kid != nil {
+			jwtToken.Header["kid"] = kid
+		}
+		signed, err := jwtToken.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	tests := []struct {
+		name   string
+		signed string
+	}{
+		{name: "missing kid", signed: sign(jwt.SigningMethodRS256, nil, rsaKey)},
+		{name: "unknown kid", signed: sign(jwt.SigningMethodRS256, "k2", rsaKey)},
+		{name: "HS256 with public key as secret", signed: sign(jwt.SigningMethodHS256, "k1", publicDER)},
+		{name: "ES256 against RSA key", signed: sign(jwt.SigningMethodES256, "k1", ecKey)},
+		{name: "none algorithm", signed: sign(jwt.SigningMethodNone, "k1", jwt.UnsafeAllowNoneSignatureType)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := jwt.Parse(test.signed, keySet.Keyfunc); err == nil {
+				t.Error("Parse() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestJSONWebKeyPublicKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  JSONWebKey
+	}{
+		{name: "unknown type", key: JSONWebKey{Kty: "oct"}},
+		{name: "RSA empty modulus", key: JSONWebKey{Kty: "RSA", E: "AQAB"}},
+		{name: "RSA exponent too long", key: JSONWebKey{Kty: "RSA", N: "AQAB", E: "AQABAQAB"}},
+		{name: "RSA bad encoding", key: JSONWebKey{Kty: "RSA", N: "!!", E: "AQAB"}},
+		{name: "EC other curve", key: JSONWebKey{Kty: "EC", Crv: "P-384", X: "AQ", Y: "AQ"}},
+		{name: "EC point not on curve", key: JSONWebKey{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.key.PublicKey(); err == nil {
+				t.Error("PublicKey() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestPadLeft(t *testing.T) {
+	tests := []struct {
+		value []byte
+		size  int
+		want  []byte
+	}{
+		{value: []byte{1, 2}, size: 4, want: []byte{0, 0, 1, 2}},
+		{value: []byte{1, 2}, size: 2, want: []byte{1, 2}},
+		{value: []byte{1, 2, 3}, size: 2, want: []byte{1, 2, 3}},
+	}
+	for _, test := range tests {
+		if got := padLeft(test.value, test.size); string(got) != string(test.want) {
+			t.Errorf("padLeft(%v, %d) = %v, want %v", test.value, test.size, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidCursor = errors.New("Cursor not valid")
+
+// Column: sort column of keyset pagination, param wrap the cursor value the same way as the expression (ex: lower(?))
+type Column struct {
+	Expr  string
+	Param string
+	Desc  bool
+	Value interface{}
+}
+
+// payload: sort is kept so cursor of other sort order is refused
+type payload struct {
+	Sort     string          `json:"s"`
+	Backward bool            `json:"b,omitempty"`
+	Key      json.RawMessage `json:"k"`
+}
+
+// Encode: opaque cursor of the row key, backward cursor read the page before the row
+func Encode(sort string, backward bool, key interface{}) (string, error) {
+	keyByte, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	payloadByte, err := json.Marshal(payload{Sort: sort, Backward: backward, Key: keyByte})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payloadByte), nil
+}
+
+// Decode: fill the row key and return the direction of the cursor
+func Decode(cursor, sort string, key interface{}) (bool, error) {
+	payloadByte, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return false, ErrInvalidCursor
+	}
+	var data payload
+	if err := json.Unmarshal(payloadByte, &data); err != nil || data.Sort != sort {
+		return false, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data.Key, key); err != nil {
+		return false, ErrInvalidCursor
+	}
+	return data.Backward, nil
+}
+
+// Condition: row after the key in sort order, or before it when backward.
+// (a, b) after (x, y) is a > x or (a = x and b > y), operator is flipped for descending column
+func Condition(columns []Column, backward bool) (string, []interface{}) {
+	alternatives := []string{}
+	args := []interface{}{}
+	for index, column := range columns {
+		parts := []string{}
+		for _, previous := range columns[:index] {
+			parts = append(parts, previous.Expr+" = "+param(previous))
+			args = append(args, previous.Value)
+		}
+		operator := ">"
+		if column.Desc != backward {
+			operator = "<"
+		}
+		parts = append(parts, column.Expr+" "+operator+" "+param(column))
+		args = append(args, column.Value)
+		alternatives = append(alternatives, "("+strings.Join(parts, " and ")+")")
+	}
+	return "(" + strings.Join(alternatives, " or ") + ")", args
+}
+
+// Order: backward page is read in reverse order, the caller reverse the rows back
+func Order(columns []Column, backward bool) string {
+	orders := []string{}
+	for _, column := range columns {
+		order := "asc"
+		if column.Desc != backward {
+			order = "desc"
+		}
+		orders = append(orders, column.Expr+" "+order)
+	}
+	return strings.Join(orders, ", ")
+}
+
+// Estimate: row estimate of the query planner, cheap replacement of count on large table
+func Estimate(db *gorm.DB, sql string, args ...interface{}) (int, error) {
+	var plan string
+	if err := db.Raw("explain (format json) "+sql, args...).Row().Scan(&plan); err != nil {
+		return 0, err
+	}
+	var plans []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(plan), &plans); err != nil {
+		return 0, err
+	}
+	if len(plans) == 0 {
+		return 0, errors.New("Query plan not found")
+	}
+	return int(plans[0].Plan.Rows), nil
+}
+
+func param(column Column) string {
+	if len(column.Param) == 0 {
+		return "?"
+	}
+	return column.Param
+}
@@ -0,0 +1,144 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+type testKey struct {
+	ID   int    `json:"i"`
+	Name string `json:"n"`
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, backward := range []bool{false, true} {
+		encoded, err := Encode("name", backward, testKey{ID: 7, Name: "Ada"})
+		if err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+		var key testKey
+		gotBackward, err := Decode(encoded, "name", &key)
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if gotBackward != backward || key != (testKey{ID: 7, Name: "Ada"}) {
+			t.Errorf("Decode() = %v, %+v, want %v, {7 Ada}", gotBackward, key, backward)
+		}
+	}
+}
+
+func TestDecodeRefuse(t *testing.T) {
+	valid, err := Encode("name", false, testKey{ID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKey, err := Encode("name", false, "not a key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		cursor string
+		sort   string
+	}{
+		{name: "other sort", cursor: valid, sort: "email"},
+		{name: "not base64", cursor: "!!!", sort: "name"},
+		{name: "not json", cursor: base64.RawURLEncoding.EncodeToString([]byte("not json")), sort: "name"},
+		{name: "key of other type", cursor: wrongKey, sort: "name"},
+		{name: "empty", cursor: "", sort: "name"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var key testKey
+			if _, err := Decode(test.cursor, test.sort, &key); err != ErrInvalidCursor {
+				t.Errorf("Decode() error = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestCondition(t *testing.T) {
+	name := Column{Expr: "lower(u.name)", Param: "lower(?)", Value: "ada"}
+	nameDesc := Column{Expr: "lower(u.name)", Param: "lower(?)", Desc: true, Value: "ada"}
+	id := Column{Expr: "u.id", Value: 7}
+	idDesc := Column{Expr: "u.id", Desc: true, Value: 7}
+	tests := []struct {
+		name     string
+		columns  []Column
+		backward bool
+		want     string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "single column",
+			columns:  []Column{idDesc},
+			want:     "((u.id < ?))",
+			wantArgs: []interface{}{7},
+		},
+		{
+			name:     "single column backward",
+			columns:  []Column{idDesc},
+			backward: true,
+			want:     "((u.id > ?))",
+			wantArgs: []interface{}{7},
+		},
+		{
+			name:     "ascending",
+			columns:  []Column{name, id},
+			want:     "((lower(u.name) > lower(?)) or (lower(u.name) = lower(?) and u.id > ?))",
+			wantArgs: []interface{}{"ada", "ada", 7},
+		},
+		{
+			name:     "ascending backward",
+			columns:  []Column{name, id},
+			backward: true,
+			want:     "((lower(u.name) < lower(?)) or (lower(u.name) = lower(?) and u.id < ?))",
+			wantArgs: []interface{}{"ada", "ada", 7},
+		},
+		{
+			name:     "descending then ascending",
+			columns:  []Column{nameDesc, id},
+			want:     "((lower(u.name) < lower(?)) or (lower(u.name) = lower(?) and u.id > ?))",
+			wantArgs: []interface{}{"ada", "ada", 7},
+		},
+		{
+			name:     "descending then ascending backward",
+			columns:  []Column{nameDesc, id},
+			backward: true,
+			want:     "((lower(u.name) > lower(?)) or (lower(u.name) = lower(?) and u.id < ?))",
+			wantArgs: []interface{}{"ada", "ada", 7},
+		},
+		{
+			name:     "ascending then descending backward",
+			columns:  []Column{name, idDesc},
+			backward: true,
+			want:     "((lower(u.name) < lower(?)) or (lower(u.name) = lower(?) and u.id > ?))",
+			wantArgs: []interface{}{"ada", "ada", 7},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, args := Condition(test.columns, test.backward)
+			if got != test.want || !reflect.DeepEqual(args, test.wantArgs) {
+				t.Errorf("Condition() = %s %v, want %s %v", got, args, test.want, test.wantArgs)
+			}
+		})
+	}
+}
+
+func TestOrder(t *testing.T) {
+	columns := []Column{{Expr: "lower(u.name)", Desc: true}, {Expr: "u.id"}}
+	tests := []struct {
+		backward bool
+		want     string
+	}{
+		{backward: false, want: "lower(u.name) desc, u.id asc"},
+		{backward: true, want: "lower(u.name) asc, u.id desc"},
+	}
+	for _, test := range tests {
+		if got := Order(columns, test.backward); got != test.want {
+			t.Errorf("Order(backward %v) = %s, want %s", test.backward, got, test.want)
+		}
+	}
+}
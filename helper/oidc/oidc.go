@@ -0,0 +1,340 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"github.com/novalwardhana/golang-boilerplate/config/jwtkey"
+	"github.com/novalwardhana/golang-boilerplate/helper/token"
+)
+
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type Provider struct {
+	config    Config
+	client    *http.Client
+	mutex     sync.Mutex
+	discovery *Discovery
+	keys      map[string]crypto.PublicKey
+}
+
+// ConfigFromEnv: scopes default to openid email profile
+func ConfigFromEnv() Config {
+	config := Config{
+		Name:         os.Getenv(env.EnvOIDCProviderName),
+		Issuer:       strings.TrimSuffix(os.Getenv(env.EnvOIDCIssuer), "/"),
+		ClientID:     os.Getenv(env.EnvOIDCClientID),
+		ClientSecret: os.Getenv(env.EnvOIDCClientSecret),
+		RedirectURL:  os.Getenv(env.EnvOIDCRedirectURL),
+		Scopes:       strings.Fields(os.Getenv(env.EnvOIDCScopes)),
+	}
+	if len(config.Name) == 0 {
+		config.Name = "oidc"
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return config
+}
+
+// NewProvider: discovery document is loaded on first use, so the app still start when the identity provider is down
+func NewProvider(config Config) *Provider {
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   map[string]crypto.PublicKey{},
+	}
+}
+
+// Enabled:
+func (p *Provider) Enabled() bool {
+	return len(p.config.Issuer) > 0 && len(p.config.ClientID) > 0 && len(p.config.RedirectURL) > 0
+}
+
+// Name: provider name stored with the external subject
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// NewCodeVerifier: PKCE code verifier
+func NewCodeVerifier() (string, error) {
+	verifier, _, err := token.Generate(32)
+	return verifier, err
+}
+
+// CodeChallenge: PKCE S256 code challenge
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL:
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+	authorizationURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	query := authorizationURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	authorizationURL.RawQuery = query.Encode()
+	return authorizationURL.String(), nil
+}
+
+// Exchange: exchange authorization code with token, client secret is optional for public client
+func (p *Provider) Exchange(code, codeVerifier string) (TokenResponse, error) {
+	var tokenResponse TokenResponse
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return tokenResponse, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	request, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tokenResponse, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if len(p.config.ClientSecret) > 0 {
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return tokenResponse, err
+	}
+	defer response.Body.Close()
+	if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+		return tokenResponse, err
+	}
+	if len(tokenResponse.Error) > 0 {
+		return tokenResponse, fmt.Errorf("Identity provider error: %s %s", tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+	if response.StatusCode != http.StatusOK {
+		return tokenResponse, fmt.Errorf("Identity provider token endpoint return status %d", response.StatusCode)
+	}
+	if len(tokenResponse.IDToken) == 0 {
+		return tokenResponse, errors.New("Identity provider not return ID token")
+	}
+	return tokenResponse, nil
+}
+
+// VerifyIDToken: check signature, issuer, audience, expiry and nonce of ID token
+func (p *Provider) VerifyIDToken(rawIDToken, nonce string) (Claims, error) {
+	var claims Claims
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return claims, err
+	}
+
+	/* Signature and time validation */
+	mapClaims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(rawIDToken, mapClaims, p.keyfunc); err != nil {
+		return claims, err
+	}
+	if _, ok := mapClaims["exp"]; !ok {
+		return claims, errors.New("ID token not have expiry")
+	}
+
+	/* Issuer and audience validation */
+	if issuer, _ := mapClaims["iss"].(string); issuer != discovery.Issuer {
+		return claims, errors.New("ID token issuer not valid")
+	}
+	audiences := []string{}
+	switch audience := mapClaims["aud"].(type) {
+	case string:
+		audiences = append(audiences, audience)
+	case []interface{}:
+		for _, item := range audience {
+			if value, ok := item.(string); ok {
+				audiences = append(audiences, value)
+			}
+		}
+	}
+	validAudience := false
+	for _, audience := range audiences {
+		if audience == p.config.ClientID {
+			validAudience = true
+		}
+	}
+	if !validAudience {
+		return claims, errors.New("ID token audience not valid")
+	}
+	if azp, ok := mapClaims["azp"].(string); ok && len(audiences) > 1 && azp != p.config.ClientID {
+		return claims, errors.New("ID token authorized party not valid")
+	}
+
+	/* Nonce validation */
+	if tokenNonce, _ := mapClaims["nonce"].(string); tokenNonce != nonce {
+		return claims, errors.New("ID token nonce not valid")
+	}
+
+	claims.Subject, _ = mapClaims["sub"].(string)
+	claims.Email, _ = mapClaims["email"].(string)
+	claims.Name, _ = mapClaims["name"].(string)
+	switch emailVerified := mapClaims["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = emailVerified
+	case string:
+		claims.EmailVerified = emailVerified == "true"
+	}
+	if len(claims.Subject) == 0 {
+		return claims, errors.New("ID token not have subject")
+	}
+	return claims, nil
+}
+
+// keyfunc: unknown key id reload the key set once, identity provider may rotate its key
+func (p *Provider) keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	publicKey, err := p.getKey(kid, false)
+	if err != nil {
+		publicKey, err = p.getKey(kid, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	/* Algorithm must follow the key type, prevent algorithm confusion */
+	if t.Method.Alg() != jwtkey.Algorithm(publicKey) {
+		return nil, errors.New("ID token signing method not valid")
+	}
+	return publicKey, nil
+}
+
+// getDiscovery:
+func (p *Provider) getDiscovery() (*Discovery, error) {
+	if !p.Enabled() {
+		return nil, errors.New("OIDC login not configured")
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	discovery := new(Discovery)
+	if err := p.getJSON(p.config.Issuer+"/.well-known/openid-configuration", discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.config.Issuer {
+		return nil, errors.New("Identity provider issuer not match")
+	}
+	if len(discovery.AuthorizationEndpoint) == 0 || len(discovery.TokenEndpoint) == 0 || len(discovery.JWKSURI) == 0 {
+		return nil, errors.New("Identity provider discovery document not complete")
+	}
+	p.discovery = discovery
+	return p.discovery, nil
+}
+
+// getKey:
+func (p *Provider) getKey(kid string, reload bool) (crypto.PublicKey, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if reload || len(p.keys) == 0 {
+		keySet := jwtkey.JSONWebKeySet{}
+		if err := p.getJSON(discovery.JWKSURI, &keySet); err != nil {
+			return nil, err
+		}
+		keys := map[string]crypto.PublicKey{}
+		for _, key := range keySet.Keys {
+			if len(key.Use) > 0 && key.Use != "sig" {
+				continue
+			}
+			publicKey, err := key.PublicKey()
+			if err != nil {
+				continue
+			}
+			keys[key.Kid] = publicKey
+		}
+		p.keys = keys
+	}
+
+	/* Token without kid is allowed when identity provider only has one key */
+	if len(kid) == 0 && len(p.keys) == 1 {
+		for _, publicKey := range p.keys {
+			return publicKey, nil
+		}
+	}
+	publicKey, ok := p.keys[kid]
+	if !ok {
+		return nil, errors.New("ID token key id not valid")
+	}
+	return publicKey, nil
+}
+
+// getJSON:
+func (p *Provider) getJSON(url string, data interface{}) error {
+	response, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Identity provider %s return status %d", url, response.StatusCode)
+	}
+	return json.NewDecoder(response.Body).Decode(data)
+}
@@ -0,0 +1,329 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/novalwardhana/golang-boilerplate/config/jwtkey"
+)
+
+const (
+	clientID     string = "client-1"
+	clientSecret string = "client-secret"
+	redirectURL  string = "https://app.example.com/oidc/callback"
+	goodCode     string = "good-code"
+)
+
+// mockIdP: local identity provider with discovery, JWKS and token endpoint. The token endpoint return the ID token
+// prepared by the test only for the good code and the code verifier that match the code challenge
+type mockIdP struct {
+	server        *httptest.Server
+	mutex         sync.Mutex
+	keys          map[string]*rsa.PrivateKey
+	idToken       string
+	codeChallenge string
+	jwksRequests  int
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	idp := &mockIdP{keys: map[string]*rsa.PrivateKey{}}
+	idp.addKey(t, "k1")
+
+	/* Discovery is served under /other too, its issuer does not match that path */
+	mux := http.NewServeMux()
+	discovery := func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	}
+	mux.HandleFunc("/.well-known/openid-configuration", discovery)
+	mux.HandleFunc("/other/.well-known/openid-configuration", discovery)
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mutex.Lock()
+		defer idp.mutex.Unlock()
+		idp.jwksRequests++
+		keySet := jwtkey.JSONWebKeySet{}
+		for kid, key := range idp.keys {
+			keySet.Keys = append(keySet.Keys, jwtkey.JSONWebKey{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: "RS256",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(keySet)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mutex.Lock()
+		defer idp.mutex.Unlock()
+		username, password, _ := r.BasicAuth()
+		switch {
+		case r.Method != http.MethodPost || r.PostFormValue("grant_type") != "authorization_code":
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(TokenResponse{Error: "unsupported_grant_type"})
+		case username != clientID || password != clientSecret:
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(TokenResponse{Error: "invalid_client"})
+		case r.PostFormValue("code") != goodCode || r.PostFormValue("redirect_uri") != redirectURL ||
+			CodeChallenge(r.PostFormValue("code_verifier")) != idp.codeChallenge:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(TokenResponse{Error: "invalid_grant"})
+		default:
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "access", TokenType: "Bearer", IDToken: idp.idToken, ExpiresIn: 60})
+		}
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) addKey(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.mutex.Lock()
+	defer idp.mutex.Unlock()
+	idp.keys[kid] = key
+}
+
+// sign: kid nil is omitted from the header
+func (idp *mockIdP) sign(t *testing.T, kid interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	idp.mutex.Lock()
+	defer idp.mutex.Unlock()
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	key := idp.keys["k1"]
+	if kid != nil {
+		jwtToken.Header["kid"] = kid
+		if value, ok := idp.keys[kid.(string)]; ok {
+			key = value
+		}
+	}
+	signed, err := jwtToken.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (idp *mockIdP) claims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            clientID,
+		"sub":            "subject-1",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"name":           "User",
+		"nonce":          "nonce-1",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func (idp *mockIdP) provider() *Provider {
+	return NewProvider(Config{
+		Name:         "mock",
+		Issuer:       idp.server.URL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "email"},
+	})
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newMockIdP(t)
+	authorizationURL, err := idp.provider().AuthCodeURL("state-1", "nonce-1", "challenge-1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Scheme+"://"+parsed.Host+parsed.Path != idp.server.URL+"/authorize" {
+		t.Errorf("endpoint = %s", authorizationURL)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             clientID,
+		"redirect_uri":          redirectURL,
+		"scope":                 "openid email",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "challenge-1",
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if got := parsed.Query().Get(key); got != value {
+			t.Errorf("query %s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	/* RFC 7636 appendix B */
+	if got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("CodeChallenge() = %s", got)
+	}
+	verifier, err := NewCodeVerifier()
+	if err != nil || len(verifier) < 43 {
+		t.Errorf("NewCodeVerifier() = %q, %v, want at least 43 character", verifier, err)
+	}
+}
+
+func TestLoginFlow(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.codeChallenge = CodeChallenge(verifier)
+	idp.idToken = idp.sign(t, "k1", idp.claims())
+
+	tokenResponse, err := provider.Exchange(goodCode, verifier)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	claims, err := provider.VerifyIDToken(tokenResponse.IDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+	want := Claims{Subject: "subject-1", Email: "user@example.com", EmailVerified: true, Name: "User"}
+	if claims != want {
+		t.Errorf("VerifyIDToken() = %+v, want %+v", claims, want)
+	}
+}
+
+func TestExchangeRefuse(t *testing.T) {
+	idp := newMockIdP(t)
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.codeChallenge = CodeChallenge(verifier)
+	idp.idToken = idp.sign(t, "k1", idp.claims())
+	wrongSecret := idp.provider()
+	wrongSecret.config.ClientSecret = "wrong"
+
+	tests := []struct {
+		name     string
+		provider *Provider
+		code     string
+		verifier string
+	}{
+		{name: "wrong code", provider: idp.provider(), code: "bad-code", verifier: verifier},
+		{name: "wrong code verifier", provider: idp.provider(), code: goodCode, verifier: verifier + "x"},
+		{name: "wrong client secret", provider: wrongSecret, code: goodCode, verifier: verifier},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.provider.Exchange(test.code, test.verifier); err == nil {
+				t.Error("Exchange() error = nil, want error")
+			}
+		})
+	}
+
+	/* Token response without ID token */
+	idp.idToken = ""
+	if _, err := idp.provider().Exchange(goodCode, verifier); err == nil {
+		t.Error("Exchange() without ID token error = nil, want error")
+	}
+}
+
+func TestVerifyIDTokenRefuse(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.addKey(t, "k2")
+	claims := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		value := idp.claims()
+		change(value)
+		return value
+	}
+	hmacToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.claims()).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		signed string
+	}{
+		{name: "wrong nonce", signed: idp.sign(t, "k1", claims(func(c jwt.MapClaims) { c["nonce"] = "other" }))},
+		{name: "missing nonce", signed: idp.sign(t, "k1", claims(func(c jwt.MapClaims) { delete(c, "nonce") }))},
+		{name: "wrong issuer", signed: idp.sign(t, "k1", claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }))},
+		{name: "wrong audience", signed: idp.sign(t, "k1", claims(func(c jwt.MapClaims) { c["aud"] = "other-client" }))},
+		{name: "wrong authorized party", signed: idp.sign(t, "k1", claims(func(c jwt.MapClaims) {
+			c["aud"] = []string{clientID, "other-client"}
+			c["azp"] = "other-client"
+		}))},
+		{name: "expired", signed: idp.sign(t, "k1", claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }))},
+		{name: "missing expiry", signed: idp.sign(t, "k1", claims(func(c jwt.MapClaims) { delete(c, "exp") }))},
+		{name: "missing subject", signed: idp.sign(t, "k1", claims(func(c jwt.MapClaims) { delete(c, "sub") }))},
+		{name: "missing kid with many keys", signed: idp.sign(t, nil, idp.claims())},
+		{name: "unknown kid", signed: idp.sign(t, "k3", idp.claims())},
+		{name: "HS256", signed: hmacToken},
+		{name: "not a token", signed: "not.a.token"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := idp.provider().VerifyIDToken(test.signed, "nonce-1"); err == nil {
+				t.Error("VerifyIDToken() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	if _, err := provider.VerifyIDToken(idp.sign(t, "k1", idp.claims()), "nonce-1"); err != nil {
+		t.Fatalf("VerifyIDToken() k1 error = %v", err)
+	}
+
+	/* New key is loaded once when the kid is unknown */
+	idp.addKey(t, "k2")
+	if _, err := provider.VerifyIDToken(idp.sign(t, "k2", idp.claims()), "nonce-1"); err != nil {
+		t.Fatalf("VerifyIDToken() k2 error = %v", err)
+	}
+	if idp.jwksRequests != 2 {
+		t.Errorf("JWKS requested %d times, want 2", idp.jwksRequests)
+	}
+}
+
+func TestDiscoveryRefuse(t *testing.T) {
+	idp := newMockIdP(t)
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{name: "not configured", config: Config{Issuer: idp.server.URL, RedirectURL: redirectURL}},
+		{name: "discovery not found", config: Config{Issuer: idp.server.URL + "/missing", ClientID: clientID, RedirectURL: redirectURL}},
+		{name: "issuer not match", config: Config{Issuer: idp.server.URL + "/other", ClientID: clientID, RedirectURL: redirectURL}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewProvider(test.config).AuthCodeURL("state", "nonce", "challenge"); err == nil {
+				t.Error("AuthCodeURL() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package password
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const AlgorithmBcrypt string = "bcrypt"
+const AlgorithmArgon2id string = "argon2id"
+const AlgorithmMD5 string = "md5"
+
+var ErrUnknownFormat = errors.New("Unknown password hash format")
+
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (match bool, needsRehash bool, err error)
+}
+
+type Config struct {
+	Algorithm         string
+	BcryptCost        int
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+}
+
+type hasher struct {
+	config Config
+}
+
+// ConfigFromEnv: read hasher config, default to bcrypt when algorithm not set
+func ConfigFromEnv() Config {
+	config := Config{
+		Algorithm:         strings.ToLower(os.Getenv(env.EnvPasswordHashAlgorithm)),
+		BcryptCost:        env.GetInt(env.EnvPasswordBcryptCost, 12),
+		Argon2Memory:      uint32(env.GetInt(env.EnvPasswordArgon2Memory, 64*1024)),
+		Argon2Iterations:  uint32(env.GetInt(env.EnvPasswordArgon2Iterations, 3)),
+		Argon2Parallelism: uint8(env.GetInt(env.EnvPasswordArgon2Parallelism, 2)),
+	}
+	if config.Algorithm != AlgorithmArgon2id {
+		config.Algorithm = AlgorithmBcrypt
+	}
+	if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+		config.BcryptCost = bcrypt.DefaultCost
+	}
+	return config
+}
+
+func NewHasher(config Config) Hasher {
+	return &hasher{
+		config: config,
+	}
+}
+
+// Hash: encode password with configured algorithm, the algorithm and its parameter are kept inside the hash string
+func (h *hasher) Hash(password string) (string, error) {
+	if h.config.Algorithm == AlgorithmArgon2id {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.config.Argon2Iterations, h.config.Argon2Memory, h.config.Argon2Parallelism, 32)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version,
+			h.config.Argon2Memory,
+			h.config.Argon2Iterations,
+			h.config.Argon2Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.config.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify: compare password with encoded hash, needsRehash is true when the hash use old algorithm or parameter
+func (h *hasher) Verify(password, encoded string) (bool, bool, error) {
+	switch Algorithm(encoded) {
+	case AlgorithmBcrypt:
+		if err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)); err != nil {
+			if err == bcrypt.ErrMismatchedHashAndPassword {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return true, true, nil
+		}
+		return true, h.config.Algorithm != AlgorithmBcrypt || cost != h.config.BcryptCost, nil
+
+	case AlgorithmArgon2id:
+		var version int
+		var memory, iterations uint32
+		var parallelism uint8
+		parts := strings.Split(encoded, "$")
+		if len(parts) != 6 {
+			return false, false, ErrUnknownFormat
+		}
+		if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+			return false, false, ErrUnknownFormat
+		}
+		if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+			return false, false, ErrUnknownFormat
+		}
+		salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+		if err != nil {
+			return false, false, ErrUnknownFormat
+		}
+		key, err := base64.RawStdEncoding.DecodeString(parts[5])
+		if err != nil {
+			return false, false, ErrUnknownFormat
+		}
+		compareKey := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, compareKey) != 1 {
+			return false, false, nil
+		}
+		needsRehash := h.config.Algorithm != AlgorithmArgon2id ||
+			version != argon2.Version ||
+			memory != h.config.Argon2Memory ||
+			iterations != h.config.Argon2Iterations ||
+			parallelism != h.config.Argon2Parallelism
+		return true, needsRehash, nil
+
+	case AlgorithmMD5:
+		passwordHex := md5.Sum([]byte(password))
+		passwordHash := hex.EncodeToString(passwordHex[:])
+		if subtle.ConstantTimeCompare([]byte(passwordHash), []byte(strings.ToLower(encoded))) != 1 {
+			return false, false, nil
+		}
+		return true, true, nil
+	}
+
+	return false, false, ErrUnknownFormat
+}
+
+// Algorithm: detect algorithm from encoded hash, legacy hash is a bare 32 char md5 hex
+func Algorithm(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return AlgorithmBcrypt
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return AlgorithmArgon2id
+	}
+	if len(encoded) == md5.Size*2 {
+		if _, err := hex.DecodeString(encoded); err == nil {
+			return AlgorithmMD5
+		}
+	}
+	return ""
+}
@@ -0,0 +1,129 @@
+package password
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var bcryptConfig = Config{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}
+
+var argon2Config = Config{Algorithm: AlgorithmArgon2id, Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1}
+
+func TestAlgorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		want    string
+	}{
+		{name: "bcrypt 2a", encoded: "$2a$10$abcdefghijklmnopqrstuv", want: AlgorithmBcrypt},
+		{name: "bcrypt 2b", encoded: "$2b$10$abcdefghijklmnopqrstuv", want: AlgorithmBcrypt},
+		{name: "bcrypt 2y", encoded: "$2y$10$abcdefghijklmnopqrstuv", want: AlgorithmBcrypt},
+		{name: "argon2id", encoded: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$a2V5", want: AlgorithmArgon2id},
+		{name: "md5 lower", encoded: "5f4dcc3b5aa765d61d8327deb882cf99", want: AlgorithmMD5},
+		{name: "md5 upper", encoded: "5F4DCC3B5AA765D61D8327DEB882CF99", want: AlgorithmMD5},
+		{name: "md5 not hex", encoded: "5f4dcc3b5aa765d61d8327deb882cfzz", want: ""},
+		{name: "empty", encoded: "", want: ""},
+		{name: "plain text", encoded: "password", want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Algorithm(test.encoded); got != test.want {
+				t.Errorf("Algorithm(%q) = %q, want %q", test.encoded, got, test.want)
+			}
+		})
+	}
+}
+
+func TestHashVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    Config
+		algorithm string
+	}{
+		{name: "bcrypt", config: bcryptConfig, algorithm: AlgorithmBcrypt},
+		{name: "argon2id", config: argon2Config, algorithm: AlgorithmArgon2id},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hasher := NewHasher(test.config)
+			encoded, err := hasher.Hash("secret password")
+			if err != nil {
+				t.Fatalf("Hash() error = %v", err)
+			}
+			if got := Algorithm(encoded); got != test.algorithm {
+				t.Fatalf("Algorithm() = %q, want %q", got, test.algorithm)
+			}
+
+			match, needsRehash, err := hasher.Verify("secret password", encoded)
+			if err != nil || !match || needsRehash {
+				t.Errorf("Verify(correct) = %v, %v, %v, want true, false, nil", match, needsRehash, err)
+			}
+			match, needsRehash, err = hasher.Verify("wrong password", encoded)
+			if err != nil || match || needsRehash {
+				t.Errorf("Verify(wrong) = %v, %v, %v, want false, false, nil", match, needsRehash, err)
+			}
+		})
+	}
+}
+
+func TestVerifyNeedsRehash(t *testing.T) {
+	bcryptHash, err := NewHasher(bcryptConfig).Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon2Hash, err := NewHasher(argon2Config).Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strongerArgon2 := argon2Config
+	strongerArgon2.Argon2Iterations = 2
+	strongerBcrypt := bcryptConfig
+	strongerBcrypt.BcryptCost = bcrypt.MinCost + 1
+
+	tests := []struct {
+		name    string
+		config  Config
+		encoded string
+		want    bool
+	}{
+		{name: "bcrypt same cost", config: bcryptConfig, encoded: bcryptHash, want: false},
+		{name: "bcrypt other cost", config: strongerBcrypt, encoded: bcryptHash, want: true},
+		{name: "bcrypt to argon2id", config: argon2Config, encoded: bcryptHash, want: true},
+		{name: "argon2id same parameter", config: argon2Config, encoded: argon2Hash, want: false},
+		{name: "argon2id other parameter", config: strongerArgon2, encoded: argon2Hash, want: true},
+		{name: "argon2id to bcrypt", config: bcryptConfig, encoded: argon2Hash, want: true},
+		{name: "legacy md5", config: bcryptConfig, encoded: "5ebe2294ecd0e0f08eab7690d2a6ee69", want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match, needsRehash, err := NewHasher(test.config).Verify("secret", test.encoded)
+			if err != nil || !match {
+				t.Fatalf("Verify() = %v, %v, want match", match, err)
+			}
+			if needsRehash != test.want {
+				t.Errorf("Verify() needsRehash = %v, want %v", needsRehash, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "unknown format", encoded: "plain"},
+		{name: "argon2id missing part", encoded: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA"},
+		{name: "argon2id bad parameter", encoded: "$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5"},
+		{name: "argon2id bad salt", encoded: "$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match, _, err := NewHasher(bcryptConfig).Verify("secret", test.encoded)
+			if err == nil || match {
+				t.Errorf("Verify(%q) = %v, %v, want error", test.encoded, match, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrUnsupportedFormat = errors.New("File format must be csv or xlsx")
+var ErrTooManyRows = errors.New("File has too many rows")
+var ErrTooManyColumns = errors.New("File has too many columns")
+var ErrTooLarge = errors.New("Content of xlsx is too large")
+
+// maxXLSXColumn: number of column up to XFD, the last column of xlsx
+const maxXLSXColumn int = 16384
+
+// Limit: reading stop as soon as the file go over the limit, xlsx is compressed so its content can be far larger than the upload.
+// MaxRows count every row including header and empty row, MaxXMLSize is the uncompressed size of each xml part
+type Limit struct {
+	MaxRows    int
+	MaxColumns int
+	MaxXMLSize int64
+}
+
+// Read: rows of csv or the first sheet of xlsx, format is taken from the file extension
+func Read(filename string, reader io.Reader, limit Limit) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return ReadCSV(reader, limit)
+	case ".xlsx":
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		return ReadXLSX(bytes.NewReader(content), int64(len(content)), limit)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// ReadCSV: row may have different number of column, UTF-8 byte order mark from spreadsheet export is removed
+func ReadCSV(reader io.Reader, limit Limit) ([][]string, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+	rows := [][]string{}
+	for {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) >= limit.MaxRows {
+			return nil, ErrTooManyRows
+		}
+		if len(row) > limit.MaxColumns {
+			return nil, ErrTooManyColumns
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+	}
+	return rows, nil
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+// xlsxText: plain text is in t, rich text is split into runs
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var builder strings.Builder
+	for _, run := range t.Runs {
+		builder.WriteString(run.Text)
+	}
+	return builder.String()
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Index int `xml:"r,attr"`
+		Cells []struct {
+			Reference string   `xml:"r,attr"`
+			Type      string   `xml:"t,attr"`
+			Value     string   `xml:"v"`
+			Inline    xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadXLSX: only cell value is read, formula return its cached value and empty row is kept so row number match the sheet
+func ReadXLSX(reader io.ReaderAt, size int64, limit Limit) ([][]string, error) {
+	archive, err := zip.NewReader(reader, size)
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	/* Shared strings is optional, sheet without text cell does not have it */
+	sharedStrings := xlsxSharedStrings{}
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeXML(file, &sharedStrings, limit.MaxXMLSize); err != nil {
+			return nil, err
+		}
+	}
+
+	/* Find the first sheet */
+	sheetName, err := firstSheet(files, limit.MaxXMLSize)
+	if err != nil {
+		return nil, err
+	}
+	sheet := xlsxSheet{}
+	if err := decodeXML(files[sheetName], &sheet, limit.MaxXMLSize); err != nil {
+		return nil, err
+	}
+
+	rows := [][]string{}
+	for _, sheetRow := range sheet.Rows {
+		if sheetRow.Index > limit.MaxRows || len(rows) >= limit.MaxRows {
+			return nil, ErrTooManyRows
+		}
+		for sheetRow.Index > len(rows)+1 {
+			rows = append(rows, []string{})
+		}
+		row := []string{}
+		for index, cell := range sheetRow.Cells {
+			column := columnIndex(cell.Reference)
+			if column < 0 {
+				column = index
+			}
+			if column >= limit.MaxColumns {
+				return nil, ErrTooManyColumns
+			}
+			for len(row) <= column {
+				row = append(row, "")
+			}
+			switch cell.Type {
+			case "s":
+				stringIndex, err := strconv.Atoi(cell.Value)
+				if err != nil || stringIndex < 0 || stringIndex >= len(sharedStrings.Items) {
+					return nil, errors.New("Shared string of xlsx not valid")
+				}
+				row[column] = sharedStrings.Items[stringIndex].String()
+			case "inlineStr":
+				row[column] = cell.Inline.String()
+			default:
+				row[column] = cell.Value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// firstSheet: follow workbook relationship, fallback to the default name when the workbook does not have it
+func firstSheet(files map[string]*zip.File, maxSize int64) (string, error) {
+	const defaultSheet = "xl/worksheets/sheet1.xml"
+	workbookFile, ok := files["xl/workbook.xml"]
+	relationshipsFile, okRelationships := files["xl/_rels/workbook.xml.rels"]
+	if ok && okRelationships {
+		workbook := xlsxWorkbook{}
+		relationships := xlsxRelationships{}
+		if err := decodeXML(workbookFile, &workbook, maxSize); err != nil {
+			return "", err
+		}
+		if err := decodeXML(relationshipsFile, &relationships, maxSize); err != nil {
+			return "", err
+		}
+		if len(workbook.Sheets) > 0 {
+			for _, relationship := range relationships.Relationships {
+				if relationship.ID != workbook.Sheets[0].ID {
+					continue
+				}
+				name := strings.TrimPrefix(relationship.Target, "/")
+				if !strings.HasPrefix(name, "xl/") {
+					name = path.Join("xl", name)
+				}
+				if _, ok := files[name]; ok {
+					return name, nil
+				}
+			}
+		}
+	}
+	if _, ok := files[defaultSheet]; ok {
+		return defaultSheet, nil
+	}
+	return "", errors.New("Sheet of xlsx not found")
+}
+
+// columnIndex: zero based column of cell reference, A1 is 0 and AA1 is 26. Column after XFD is returned as
+// maxXLSXColumn so long reference can not overflow
+func columnIndex(reference string) int {
+	column := 0
+	letters := 0
+	for _, char := range strings.ToUpper(reference) {
+		if char < 'A' || char > 'Z' {
+			break
+		}
+		column = column*26 + int(char-'A'+1)
+		letters++
+		if column > maxXLSXColumn {
+			return maxXLSXColumn
+		}
+	}
+	if letters == 0 {
+		return -1
+	}
+	return column - 1
+}
+
+// decodeXML: size in the zip header is checked first, the limit reader still stop a header that lie about the size
+func decodeXML(file *zip.File, data interface{}, maxSize int64) error {
+	if file.UncompressedSize64 > uint64(maxSize) {
+		return ErrTooLarge
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return xml.NewDecoder(io.LimitReader(reader, maxSize)).Decode(data)
+}
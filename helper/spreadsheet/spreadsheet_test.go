@@ -0,0 +1,215 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testLimit = Limit{MaxRows: 100, MaxColumns: 10, MaxXMLSize: 1 << 20}
+
+const workbookXML string = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+	<sheets><sheet name="Users" sheetId="1" r:id="rId2"/></sheets>
+</workbook>`
+
+const relationshipsXML string = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+	<Relationship Id="rId1" Target="worksheets/sheet1.xml"/>
+	<Relationship Id="rId2" Target="/xl/worksheets/users.xml"/>
+</Relationships>`
+
+const sharedStringsXML string = `<sst>
+	<si><t>name</t></si>
+	<si><t>email</t></si>
+	<si><r><t>Ada </t></r><r><t>Lovelace</t></r></si>
+</sst>`
+
+// sheetXML: wrap rows into worksheet
+func sheetXML(rows string) string {
+	return `<worksheet><sheetData>` + rows + `</sheetData></worksheet>`
+}
+
+// xlsxFile: zip of the given parts, name is the path inside the archive
+func xlsxFile(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for name, content := range parts {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := file.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func readXLSX(content []byte, limit Limit) ([][]string, error) {
+	return ReadXLSX(bytes.NewReader(content), int64(len(content)), limit)
+}
+
+func TestRead(t *testing.T) {
+	content := xlsxFile(t, map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="A1"><v>1</v></c></row>`)})
+	tests := []struct {
+		name     string
+		filename string
+		content  []byte
+		want     [][]string
+		wantErr  error
+	}{
+		{name: "csv", filename: "users.CSV", content: []byte("a,b\n"), want: [][]string{{"a", "b"}}},
+		{name: "xlsx", filename: "users.xlsx", content: content, want: [][]string{{"1"}}},
+		{name: "xlsx not zip", filename: "users.xlsx", content: []byte("a,b\n"), wantErr: ErrUnsupportedFormat},
+		{name: "other extension", filename: "users.txt", content: []byte("a,b\n"), wantErr: ErrUnsupportedFormat},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Read(test.filename, bytes.NewReader(test.content), testLimit)
+			if !errors.Is(err, test.wantErr) || (err == nil && !reflect.DeepEqual(got, test.want)) {
+				t.Errorf("Read() = %q, %v, want %q, %v", got, err, test.want, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		limit   Limit
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name:    "byte order mark and ragged rows",
+			content: "\ufeffname,email,roles\nAda, ada@example.com\n\"Lovelace, Ada\",ada@example.com,\"admin,user\"\n",
+			limit:   testLimit,
+			want:    [][]string{{"name", "email", "roles"}, {"Ada", "ada@example.com"}, {"Lovelace, Ada", "ada@example.com", "admin,user"}},
+		},
+		{name: "at row limit", content: "a\nb\n", limit: Limit{MaxRows: 2, MaxColumns: 1}, want: [][]string{{"a"}, {"b"}}},
+		{name: "too many rows", content: "a\nb\nc\n", limit: Limit{MaxRows: 2, MaxColumns: 1}, wantErr: ErrTooManyRows},
+		{name: "too many columns", content: "a,b\n", limit: Limit{MaxRows: 2, MaxColumns: 1}, wantErr: ErrTooManyColumns},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ReadCSV(strings.NewReader(test.content), test.limit)
+			if !errors.Is(err, test.wantErr) || (err == nil && !reflect.DeepEqual(got, test.want)) {
+				t.Errorf("ReadCSV() = %q, %v, want %q, %v", got, err, test.want, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	content := xlsxFile(t, map[string]string{
+		"xl/workbook.xml":            workbookXML,
+		"xl/_rels/workbook.xml.rels": relationshipsXML,
+		"xl/sharedStrings.xml":       sharedStringsXML,
+		"xl/worksheets/sheet1.xml":   sheetXML(`<row r="1"><c r="A1"><v>wrong sheet</v></c></row>`),
+		"xl/worksheets/users.xml": sheetXML(`
+			<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+			<row r="3"><c r="A3" t="s"><v>2</v></c><c r="C3" t="inlineStr"><is><t>admin</t></is></c></row>
+			<row r="4"><c><v>42</v></c><c t="str"><v>formula</v></c></row>`),
+	})
+	got, err := readXLSX(content, testLimit)
+	if err != nil {
+		t.Fatalf("ReadXLSX() error = %v", err)
+	}
+	want := [][]string{
+		{"name", "email"},
+		{},
+		{"Ada Lovelace", "", "admin"},
+		{"42", "formula"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadXLSX() = %q, want %q", got, want)
+	}
+}
+
+func TestReadXLSXRefuse(t *testing.T) {
+	tests := []struct {
+		name    string
+		parts   map[string]string
+		limit   Limit
+		wantErr error
+	}{
+		{
+			name:  "no sheet",
+			parts: map[string]string{"xl/workbook.xml": workbookXML},
+			limit: testLimit,
+		},
+		{
+			name:  "shared string out of range",
+			parts: map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="A1" t="s"><v>3</v></c></row>`)},
+			limit: testLimit,
+		},
+		{
+			name:    "row index far after the limit",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="2000000000"><c r="A2000000000"><v>1</v></c></row>`)},
+			limit:   testLimit,
+			wantErr: ErrTooManyRows,
+		},
+		{
+			name:    "rows over the limit",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"/><row r="2"/><row r="3"/>`)},
+			limit:   Limit{MaxRows: 2, MaxColumns: 10, MaxXMLSize: 1 << 20},
+			wantErr: ErrTooManyRows,
+		},
+		{
+			name:    "long cell reference",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="ZZZZZZZZZZZZZZZZZZZZ1"><v>1</v></c></row>`)},
+			limit:   testLimit,
+			wantErr: ErrTooManyColumns,
+		},
+		{
+			name:    "column over the limit",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(`<row r="1"><c r="K1"><v>1</v></c></row>`)},
+			limit:   testLimit,
+			wantErr: ErrTooManyColumns,
+		},
+		{
+			name:    "xml over the size limit",
+			parts:   map[string]string{"xl/worksheets/sheet1.xml": sheetXML(strings.Repeat(`<row/>`, 1000))},
+			limit:   Limit{MaxRows: 100, MaxColumns: 10, MaxXMLSize: 1024},
+			wantErr: ErrTooLarge,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := readXLSX(xlsxFile(t, test.parts), test.limit)
+			if err == nil || (test.wantErr != nil && !errors.Is(err, test.wantErr)) {
+				t.Errorf("ReadXLSX() error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		reference string
+		want      int
+	}{
+		{reference: "A1", want: 0},
+		{reference: "b7", want: 1},
+		{reference: "Z1", want: 25},
+		{reference: "AA1", want: 26},
+		{reference: "XFD1", want: maxXLSXColumn - 1},
+		{reference: "XFE1", want: maxXLSXColumn},
+		{reference: "ZZZZZZZZZZZZZZZZZZZZ1", want: maxXLSXColumn},
+		{reference: "1", want: -1},
+		{reference: "", want: -1},
+	}
+	for _, test := range tests {
+		if got := columnIndex(test.reference); got != test.want {
+			t.Errorf("columnIndex(%q) = %d, want %d", test.reference, got, test.want)
+		}
+	}
+}
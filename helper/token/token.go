@@ -0,0 +1,64 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Generate: create random url safe token and the sha256 hash that stored in database
+func Generate(size int) (string, string, error) {
+	buffer := make([]byte, size)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", "", err
+	}
+	plain := base64.RawURLEncoding.EncodeToString(buffer)
+	return plain, Hash(plain), nil
+}
+
+// Hash:
+func Hash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewID: create random UUID version 4
+func NewID() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	buffer[6] = (buffer[6] & 0x0f) | 0x40
+	buffer[8] = (buffer[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buffer[0:4], buffer[4:6], buffer[6:8], buffer[8:10], buffer[10:16]), nil
+}
+
+// APIKeyPrefix: key format is gbk_<prefix>_<secret>, prefix is kept as plain text to find the key and shown to user
+const APIKeyPrefix string = "gbk"
+
+// GenerateAPIKey: return full key, visible prefix, and hash of the full key
+func GenerateAPIKey() (string, string, string, error) {
+	buffer := make([]byte, 4)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", "", "", err
+	}
+	prefix := hex.EncodeToString(buffer)
+	secret, _, err := Generate(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	key := fmt.Sprintf("%s_%s_%s", APIKeyPrefix, prefix, secret)
+	return key, prefix, Hash(key), nil
+}
+
+// ParseAPIKeyPrefix:
+func ParseAPIKeyPrefix(key string) (string, bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != APIKeyPrefix || len(parts[1]) != 8 || len(parts[2]) == 0 {
+		return "", false
+	}
+	return parts[1], true
+}
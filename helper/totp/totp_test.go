@@ -0,0 +1,131 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret: base32 of the ASCII secret "12345678901234567890" used by RFC 4226 and RFC 6238 test vectors
+const rfcSecret string = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC4226(t *testing.T) {
+	codes := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, want := range codes {
+		got, err := Code(rfcSecret, int64(counter))
+		if err != nil {
+			t.Fatalf("Code(%d) error = %v", counter, err)
+		}
+		if got != want {
+			t.Errorf("Code(%d) = %s, want %s", counter, got, want)
+		}
+	}
+}
+
+// RFC 6238 appendix B SHA1 vectors, the 8 digit codes are truncated to the last 6 digits
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+	for _, test := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d) error = %v", test.unix, err)
+		}
+		if got != test.want {
+			t.Errorf("Code at %d = %s, want %s", test.unix, got, test.want)
+		}
+	}
+}
+
+func TestCodeSecretFormat(t *testing.T) {
+	want, _ := Code(rfcSecret, 1)
+	for _, secret := range []string{strings.ToLower(rfcSecret), " " + rfcSecret + " "} {
+		if got, err := Code(secret, 1); err != nil || got != want {
+			t.Errorf("Code(%q) = %s, %v, want %s", secret, got, err, want)
+		}
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code() with invalid secret error = nil, want error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code := func(step int64) string {
+		value, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", code: code(current), wantStep: current, wantOK: true},
+		{name: "previous step", code: code(current - 1), wantStep: current - 1, wantOK: true},
+		{name: "next step", code: code(current + 1), wantStep: current + 1, wantOK: true},
+		{name: "surrounding space", code: " " + code(current) + " ", wantStep: current, wantOK: true},
+		{name: "two steps ago", code: code(current - 2), wantOK: false},
+		{name: "two steps ahead", code: code(current + 2), wantOK: false},
+		{name: "too short", code: code(current)[:5], wantOK: false},
+		{name: "too long", code: code(current) + "0", wantOK: false},
+		{name: "empty", code: "", wantOK: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, test.code, now)
+			if ok != test.wantOK || (ok && step != test.wantStep) {
+				t.Errorf("Validate(%q) = %d, %v, want %d, %v", test.code, step, ok, test.wantStep, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("GenerateSecret() = %q, decoded %d byte, error %v, want 20 byte", secret, len(key), err)
+	}
+	other, err := GenerateSecret()
+	if err != nil || other == secret {
+		t.Errorf("GenerateSecret() returned the same secret twice")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(ProvisioningURI("Golang Boilerplate", "user@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" {
+		t.Errorf("scheme and host = %s %s, want otpauth totp", uri.Scheme, uri.Host)
+	}
+	if uri.Path != "/Golang Boilerplate:user@example.com" {
+		t.Errorf("label = %q", uri.Path)
+	}
+	query := uri.Query()
+	want := map[string]string{"secret": rfcSecret, "issuer": "Golang Boilerplate", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for key, value := range want {
+		if query.Get(key) != value {
+			t.Errorf("query %s = %q, want %q", key, query.Get(key), value)
+		}
+	}
+}
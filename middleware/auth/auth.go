@@ -1,14 +1,29 @@
 package auth
 
 import (
+	"crypto/subtle"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo"
+	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"github.com/novalwardhana/golang-boilerplate/config/jwtkey"
+	"github.com/novalwardhana/golang-boilerplate/helper/token"
 )
 
+var authRepository Repository
+
+// SetRepository: repository used to check token revocation and API key, revocation check is skipped and API key is rejected when not set
+func SetRepository(repo Repository) {
+	authRepository = repo
+}
+
 // CheckAuth:
 func CheckAuth() echo.MiddlewareFunc {
 
@@ -30,6 +45,9 @@ func CheckAuth() echo.MiddlewareFunc {
 			if len(authorizationaArray) < 2 {
 				return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Bearer not valid"})
 			}
+			if authorizationaArray[0] == "ApiKey" {
+				return checkAPIKey(c, next, authorizationaArray[1])
+			}
 			if authorizationaArray[0] != "Bearer" {
 				return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Bearer not valid"})
 			}
@@ -38,9 +56,7 @@ func CheckAuth() echo.MiddlewareFunc {
 			}
 
 			/* Token validation */
-			token, err := jwt.ParseWithClaims(authorizationaArray[1], &JwtCustomClaims{}, func(t *jwt.Token) (interface{}, error) {
-				return []byte("novalwardhana"), nil
-			})
+			token, err := jwt.ParseWithClaims(authorizationaArray[1], &JwtCustomClaims{}, jwtkey.Keyfunc)
 			if err != nil {
 				return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: err.Error()})
 			}
@@ -54,13 +70,283 @@ func CheckAuth() echo.MiddlewareFunc {
 				return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Failed decode token"})
 			}
 
+			/* Audience validation */
+			if decodeToken.Audience != AudienceAccess {
+				return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Token invalid"})
+			}
+
 			/* Expired token validation */
 			if decodeToken.ExpiresAt < time.Now().Local().Unix() {
 				return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Token expired"})
 			}
 
-			return next(NewContext{User: decodeToken.Data.User, Roles: decodeToken.Data.Roles, Context: c})
+			/* Revoked token validation */
+			if authRepository != nil {
+				processIsRevoked := <-authRepository.IsRevoked(decodeToken.Id, decodeToken.SessionID, decodeToken.Data.ID, decodeToken.IssuedAt)
+				if processIsRevoked.Error != nil {
+					return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Failed check token revocation"})
+				}
+				if processIsRevoked.Data.(bool) {
+					return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Token revoked"})
+				}
+				if len(decodeToken.SessionID) > 0 {
+					<-authRepository.TouchSession(decodeToken.SessionID)
+				}
+			}
+
+			mc := NewContext{User: decodeToken.Data.User, RealUser: decodeToken.Data.User, Roles: decodeToken.Data.Roles, Permissions: decodeToken.Data.Permissions, AuthType: AuthTypeBearer, SessionID: decodeToken.SessionID, OrganizationID: decodeToken.OrganizationID, Context: c}
+			if response, ok := overrideOrganization(&mc); !ok {
+				return c.JSON(http.StatusOK, response)
+			}
+			if decodeToken.Actor == nil {
+				return next(mc)
+			}
+
+			/* Impersonated request, every request is written to audit trail before it is handled */
+			if authRepository == nil {
+				return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Impersonation audit not available"})
+			}
+			mc.RealUser = *decodeToken.Actor
+			audit := ImpersonationAudit{
+				ActorID: decodeToken.Actor.ID,
+				UserID:  decodeToken.Data.ID,
+				JTI:     decodeToken.Id,
+				Action:  ImpersonationActionRequest,
+				Method:  c.Request().Method,
+				Path:    c.Request().URL.RequestURI(),
+				IP:      ClientIP(c),
+			}
+			processCreateAudit := <-authRepository.CreateImpersonationAudit(&audit)
+			if processCreateAudit.Error != nil {
+				return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Failed write impersonation audit"})
+			}
+
+			/* Status of the audit, error not yet written is answered by echo error handler */
+			err = next(mc)
+			responseStatus := c.Response().Status
+			if err != nil && !c.Response().Committed {
+				responseStatus = http.StatusInternalServerError
+				if httpError, ok := err.(*echo.HTTPError); ok {
+					responseStatus = httpError.Code
+				}
+			}
+			processUpdateAudit := <-authRepository.UpdateImpersonationAuditStatus(audit.ID, responseStatus)
+			if processUpdateAudit.Error != nil {
+				fmt.Println("Failed update impersonation audit status: ", processUpdateAudit.Error.Error())
+			}
+			return err
+		}
+
+	}
+}
+
+// checkAPIKey: permissions of API key is the intersection of key scopes and current owner permissions
+func checkAPIKey(c echo.Context, next echo.HandlerFunc, key string) error {
+
+	/* API key validation */
+	prefix, ok := token.ParseAPIKeyPrefix(key)
+	if !ok || authRepository == nil {
+		return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "API key not valid"})
+	}
+	processGetAPIKey := <-authRepository.GetAPIKey(prefix)
+	if processGetAPIKey.Error != nil {
+		return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "API key not valid"})
+	}
+	apiKey := processGetAPIKey.Data.(APIKey)
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(token.Hash(key))) != 1 {
+		return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "API key not valid"})
+	}
+	if apiKey.RevokedAt != nil {
+		return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "API key revoked"})
+	}
+	if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
+		return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "API key expired"})
+	}
+
+	/* Get API key owner */
+	processGetUser := <-authRepository.GetUser(apiKey.UserID)
+	if processGetUser.Error != nil {
+		return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "API key owner not found"})
+	}
+	processGetRoles := <-authRepository.GetRoles(apiKey.UserID)
+	if processGetRoles.Error != nil {
+		return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Failed get API key owner roles"})
+	}
+	processGetPermissions := <-authRepository.GetPermissions(apiKey.UserID)
+	if processGetPermissions.Error != nil {
+		return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Failed get API key owner permissions"})
+	}
+
+	/* Scope permissions */
+	scopes := strings.Split(apiKey.Scopes, ",")
+	permissions := []string{}
+	for _, permission := range processGetPermissions.Data.([]string) {
+		for _, scope := range scopes {
+			if permission == strings.TrimSpace(scope) {
+				permissions = append(permissions, permission)
+				break
+			}
+		}
+	}
+
+	/* API key act in the default organization of the owner */
+	processGetOrganization := <-authRepository.GetDefaultOrganization(apiKey.UserID)
+	if processGetOrganization.Error != nil {
+		return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Failed get API key owner organization"})
+	}
+
+	/* Update last used */
+	<-authRepository.TouchAPIKey(apiKey.ID)
+
+	mc := NewContext{User: processGetUser.Data.(User), RealUser: processGetUser.Data.(User), Roles: processGetRoles.Data.([]Role), Permissions: permissions, AuthType: AuthTypeAPIKey, OrganizationID: processGetOrganization.Data.(int), Context: c}
+	if response, ok := overrideOrganization(&mc); !ok {
+		return c.JSON(http.StatusOK, response)
+	}
+	return next(mc)
+}
+
+// overrideOrganization: only root can read or write data of another organization through the organization header
+func overrideOrganization(mc *NewContext) (Response, bool) {
+	header := mc.Request().Header.Get(HeaderOrganization)
+	if len(header) == 0 {
+		return Response{}, true
+	}
+	organizationID, err := strconv.Atoi(header)
+	if err != nil || organizationID < 1 {
+		return Response{Status: http.StatusBadRequest, Message: "Organization header not valid"}, false
+	}
+	if organizationID == mc.OrganizationID {
+		return Response{}, true
+	}
+	if !mc.IsRoot() || mc.IsImpersonated() {
+		return Response{Status: http.StatusForbidden, Message: "Only root can access another organization"}, false
+	}
+	if authRepository == nil {
+		return Response{Status: http.StatusUnauthorized, Message: "Organization check not available"}, false
+	}
+	processIsOrganization := <-authRepository.IsOrganization(organizationID)
+	if processIsOrganization.Error != nil {
+		return Response{Status: http.StatusUnauthorized, Message: "Failed check organization"}, false
+	}
+	if !processIsOrganization.Data.(bool) {
+		return Response{Status: http.StatusNotFound, Message: "Organization not found"}, false
+	}
+	mc.OrganizationID = organizationID
+	return Response{}, true
+}
+
+// Require: must be mounted after CheckAuth, user must have all permissions
+func Require(permissions ...string) echo.MiddlewareFunc {
+
+	/* Return handler function */
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+
+		/* Return http */
+		return func(c echo.Context) error {
+
+			mc, ok := c.(NewContext)
+			if !ok {
+				return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Auth bearer must provided"})
+			}
+
+			/* Permission check */
+			for _, permission := range permissions {
+				if !mc.HasPermission(permission) {
+					return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "User not have permission " + permission})
+				}
+			}
+
+			return next(mc)
 		}
 
 	}
 }
+
+// RefuseImpersonation: must be mounted after CheckAuth, used by destructive endpoint
+func RefuseImpersonation() echo.MiddlewareFunc {
+
+	/* Return handler function */
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+
+		/* Return http */
+		return func(c echo.Context) error {
+
+			mc, ok := c.(NewContext)
+			if !ok {
+				return c.JSON(http.StatusOK, Response{Status: http.StatusUnauthorized, Message: "Auth bearer must provided"})
+			}
+			if mc.IsImpersonated() {
+				return c.JSON(http.StatusOK, Response{Status: http.StatusForbidden, Message: "Action not allowed while impersonating"})
+			}
+
+			return next(mc)
+		}
+
+	}
+}
+
+// ClientIP: forwarded header is only trusted when the request come from a trusted proxy (TRUSTED_PROXIES, comma separated ip or cidr),
+// otherwise anyone can choose their ip. Forwarded for is read from the right, the first address that is not a trusted proxy is the client
+func ClientIP(c echo.Context) string {
+	remoteAddr := c.Request().RemoteAddr
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	proxies := trustedProxies()
+	if !isTrustedProxy(proxies, host) {
+		return host
+	}
+
+	/* Request come from trusted proxy */
+	headers := c.Request().Header
+	forwardedFor := strings.Split(headers.Get(echo.HeaderXForwardedFor), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwardedFor[i])
+		if net.ParseIP(address) == nil {
+			break
+		}
+		if !isTrustedProxy(proxies, address) {
+			return address
+		}
+		host = address
+	}
+	if realIP := strings.TrimSpace(headers.Get(echo.HeaderXRealIP)); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return host
+}
+
+func trustedProxies() []*net.IPNet {
+	proxies := []*net.IPNet{}
+	for _, item := range strings.Split(os.Getenv(env.EnvTrustedProxies), ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(item); err == nil {
+			proxies = append(proxies, network)
+		}
+	}
+	return proxies
+}
+
+func isTrustedProxy(proxies []*net.IPNet, address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
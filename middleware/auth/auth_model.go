@@ -1,16 +1,37 @@
 package auth
 
 import (
+	"time"
+
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo"
 )
 
+// AudienceAccess: only token with access audience can be used to call API, other token (ex: MFA challenge) is rejected
+const AudienceAccess string = "access"
+
+const ImpersonationActionStart string = "start"
+const ImpersonationActionRequest string = "request"
+
+const AuthTypeBearer string = "bearer"
+const AuthTypeAPIKey string = "api_key"
+
+// HeaderOrganization: root can act in another organization than the active organization of the token
+const HeaderOrganization string = "X-Organization-ID"
+
+const RoleRoot string = "root"
+
 type Response struct {
 	Status  int         `json:"status"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
 }
 
+type Result struct {
+	Data  interface{} `json:"data"`
+	Error error       `json:"error"`
+}
+
 type User struct {
 	ID    int    `json:"id"`
 	Name  string `json:"name"`
@@ -25,16 +46,79 @@ type Role struct {
 
 type JwtUserData struct {
 	User
-	Roles []Role `json:"roles"`
+	Roles       []Role   `json:"roles"`
+	Permissions []string `json:"permissions"`
 }
 
 type JwtCustomClaims struct {
-	Data JwtUserData `json:"data"`
+	Data           JwtUserData `json:"data"`
+	SessionID      string      `json:"sid,omitempty"`
+	OrganizationID int         `json:"org,omitempty"`
+	Actor          *User       `json:"act,omitempty"`
 	jwt.StandardClaims
 }
 
+type APIKey struct {
+	ID        int        `json:"id" gorm:"id"`
+	UserID    int        `json:"user_id" gorm:"user_id"`
+	KeyHash   string     `json:"-" gorm:"key_hash"`
+	Scopes    string     `json:"scopes" gorm:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at" gorm:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at" gorm:"revoked_at"`
+}
+
+// ImpersonationAudit: shared by the impersonation start and every impersonated request
+type ImpersonationAudit struct {
+	ID      int64  `json:"id" gorm:"id"`
+	ActorID int    `json:"actor_id" gorm:"actor_id"`
+	UserID  int    `json:"user_id" gorm:"user_id"`
+	JTI     string `json:"jti" gorm:"column:jti"`
+	Action  string `json:"action" gorm:"action"`
+	Method  string `json:"method" gorm:"method"`
+	Path    string `json:"path" gorm:"path"`
+	Status  int    `json:"status" gorm:"status"`
+	IP      string `json:"ip" gorm:"column:ip"`
+	Reason  string `json:"reason" gorm:"reason"`
+}
+
+func (i *ImpersonationAudit) TableName() string {
+	return "impersonation_audits"
+}
+
+// NewContext: User is the effective user, RealUser is the user who authenticate (differ only when impersonating),
+// every tenant data must be scoped by OrganizationID
 type NewContext struct {
-	User  User
-	Roles []Role
+	User           User
+	RealUser       User
+	Roles          []Role
+	Permissions    []string
+	AuthType       string
+	SessionID      string
+	OrganizationID int
 	echo.Context
 }
+
+// HasPermission:
+func (c NewContext) HasPermission(code string) bool {
+	for _, permission := range c.Permissions {
+		if permission == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRoot:
+func (c NewContext) IsRoot() bool {
+	for _, role := range c.Roles {
+		if role.Code == RoleRoot {
+			return true
+		}
+	}
+	return false
+}
+
+// IsImpersonated:
+func (c NewContext) IsImpersonated() bool {
+	return c.RealUser.ID != c.User.ID
+}
@@ -1 +1,260 @@
 package auth
+
+import (
+	"gorm.io/gorm"
+)
+
+type repository struct {
+	dbMaster *gorm.DB
+}
+
+type Repository interface {
+	IsRevoked(jti, sessionID string, userID int, issuedAt int64) <-chan Result
+	GetAPIKey(prefix string) <-chan Result
+	TouchAPIKey(id int) <-chan Result
+	TouchSession(sessionID string) <-chan Result
+	CreateImpersonationAudit(audit *ImpersonationAudit) <-chan Result
+	UpdateImpersonationAuditStatus(id int64, status int) <-chan Result
+	GetUser(id int) <-chan Result
+	GetRoles(userID int) <-chan Result
+	GetPermissions(userID int) <-chan Result
+	GetDefaultOrganization(userID int) <-chan Result
+	IsOrganization(id int) <-chan Result
+}
+
+func NewRepository(dbMaster *gorm.DB) Repository {
+	return &repository{
+		dbMaster: dbMaster,
+	}
+}
+
+// IsRevoked: token is revoked by its jti, by its session, or by user revocation after the token issued.
+// Issued at only has second precision, so token issued in the same second as the revocation is still accepted
+func (r *repository) IsRevoked(jti, sessionID string, userID int, issuedAt int64) <-chan Result {
+	result := make(chan Result)
+	go func() {
+		defer close(result)
+
+		/* Process check revocation */
+		var revoked bool
+		sql := `select (
+				exists(select 1 from revoked_tokens where jti = ?)
+				or exists(select 1 from sessions where id = ? and revoked_at is not null)
+				or exists(select 1 from user_token_revocations where user_id = ? and date_trunc('second', revoked_at) > to_timestamp(?))
+			) as revoked`
+		if err := r.dbMaster.Raw(sql, jti, sessionID, userID, issuedAt).Scan(&revoked).Error; err != nil {
+			result <- Result{Error: err}
+			return
+		}
+		result <- Result{Data: revoked}
+
+	}()
+	return result
+}
+
+// GetAPIKey:
+func (r *repository) GetAPIKey(prefix string) <-chan Result {
+	result := make(chan Result)
+	go func() {
+		defer close(result)
+
+		/* Process get api key */
+		var apiKey APIKey
+		sql := `select id, user_id, key_hash, scopes, expires_at, revoked_at from api_keys where prefix = ?`
+		if err := r.dbMaster.Raw(sql, prefix).First(&apiKey).Error; err != nil {
+			result <- Result{Error: err}
+			return
+		}
+		result <- Result{Data: apiKey}
+
+	}()
+	return result
+}
+
+// TouchAPIKey: last used time is only updated once per minute
+func (r *repository) TouchAPIKey(id int) <-chan Result {
+	result := make(chan Result)
+	go func() {
+		defer close(result)
+
+		/* Process update last used */
+		sql := `update api_keys set last_used_at = now()
+			where id = ? and (last_used_at is null or last_used_at < now() - interval '1 minute')`
+		if err := r.dbMaster.Exec(sql, id).Error; err != nil {
+			result <- Result{Error: err}
+			return
+		}
+		result <- Result{}
+
+	}()
+	return result
+}
+
+// TouchSession: last seen time is only updated once per minute
+func (r *repository) TouchSession(sessionID string) <-chan Result {
+	result := make(chan Result)
+	go func() {
+		defer close(result)
+
+		/* Process update last seen */
+		sql := `update sessions set last_seen_at = now()
+			where id = ? and last_seen_at < now() - interval '1 minute'`
+		if err := r.dbMaster.Exec(sql, sessionID).Error; err != nil {
+			result <- Result{Error: err}
+			return
+		}
+		result <- Result{}
+
+	}()
+	return result
+}
+
+// CreateImpersonationAudit:
+func (r *repository) CreateImpersonationAudit(audit *ImpersonationAudit) <-chan Result {
+	result := make(chan Result)
+	go func() {
+		defer close(result)
+
+		/* Process create audit */
+		if err := r.dbMaster.Create(audit).Error; err != nil {
+			result <- Result{Error: err}
+			return
+		}
+		result <- Result{}
+
+	}()
+	return result
+}
+
+// UpdateImpersonationAuditStatus: status is known only after the request is handled
+func (r *repository) UpdateImpersonationAuditStatus(id int64, status int) <-chan Result {
+	result := make(chan Result)
+	go func() {
+		defer close(result)
+
+		/* Process update audit */
+		sql := `update impersonation_audits set status = ? where id = ?`
+		if err := r.dbMaster.Exec(sql, status, id).Error; err != nil {
+			result <- Result{Error: err}
+			return
+		}
+		result <- Result{}
+
+	}()
+	return result
+}
+
+// GetUser:
+func (r *repository) GetUser(id int) <-chan Result {
+	result := make(chan Result)
+	go func() {
+		defer close(result)
+
+		/* Process get user */
+		var user User
+		sql := `select id, name, email from users where id = ? and deleted_at is null and status = 'active'`
+		if err := r.dbMaster.Raw(sql, id).First(&user).Error; err != nil {
+			result <- Result{Error: err}
+			return
+		}
+		result <- Result{Data: user}
+
+	}()
+	return result
+}
+
+// GetRoles:
+func (r *repository) GetRoles(userID int) <-chan Result {
+	result := make(chan Result)
+	go func() {
+		defer close(result)
+
+		/* Process get roles */
+		var roles []Role
+		sql := `select
+				roles.id,
+				roles.code,
+				roles.name
+			from user_has_roles
+			inner join roles on roles.id = user_has_roles.role_id
+			where user_has_roles.user_id = ?
+			order by roles.id asc
+		`
+		if err := r.dbMaster.Raw(sql, userID).Scan(&roles).Error; err != nil {
+			result <- Result{Error: err}
+			return
+		}
+		result <- Result{Data: roles}
+
+	}()
+	return result
+}
+
+// GetPermissions: root role hold every permission
+func (r *repository) GetPermissions(userID int) <-chan Result {
+	result := make(chan Result)
+	go func() {
+		defer close(result)
+
+		/* Process get permissions */
+		var permissions []string
+		sql := `select permissions.code
+			from permissions
+			where exists (
+				select 1 from user_has_roles
+				inner join roles on roles.id = user_has_roles.role_id
+				where user_has_roles.user_id = ? and roles.code = 'root'
+			) or permissions.id in (
+				select role_has_permissions.permission_id from user_has_roles
+				inner join role_has_permissions on role_has_permissions.role_id = user_has_roles.role_id
+				where user_has_roles.user_id = ?
+			)
+			order by permissions.code asc
+		`
+		if err := r.dbMaster.Raw(sql, userID, userID).Scan(&permissions).Error; err != nil {
+			result <- Result{Error: err}
+			return
+		}
+		result <- Result{Data: permissions}
+
+	}()
+	return result
+}
+
+// GetDefaultOrganization: first organization the user joined, zero when the user has no organization
+func (r *repository) GetDefaultOrganization(userID int) <-chan Result {
+	result := make(chan Result)
+	go func() {
+		defer close(result)
+
+		/* Process get organization */
+		var organizationID int
+		sql := `select organization_id from organization_users where user_id = ? order by created_at asc, organization_id asc limit 1`
+		if err := r.dbMaster.Raw(sql, userID).Scan(&organizationID).Error; err != nil {
+			result <- Result{Error: err}
+			return
+		}
+		result <- Result{Data: organizationID}
+
+	}()
+	return result
+}
+
+// IsOrganization:
+func (r *repository) IsOrganization(id int) <-chan Result {
+	result := make(chan Result)
+	go func() {
+		defer close(result)
+
+		/* Process check organization */
+		var exists bool
+		sql := `select exists(select 1 from organizations where id = ?)`
+		if err := r.dbMaster.Raw(sql, id).Scan(&exists).Error; err != nil {
+			result <- Result{Error: err}
+			return
+		}
+		result <- Result{Data: exists}
+
+	}()
+	return result
+}
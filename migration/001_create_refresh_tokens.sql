@@ -0,0 +1,13 @@
+create table if not exists refresh_tokens (
+	id serial primary key,
+	user_id integer not null references users(id) on delete cascade,
+	family_id varchar(36) not null,
+	token_hash varchar(64) not null unique,
+	expires_at timestamp not null,
+	used_at timestamp null,
+	revoked_at timestamp null,
+	created_at timestamp not null default now()
+);
+
+create index if not exists refresh_tokens_family_id_idx on refresh_tokens (family_id);
+create index if not exists refresh_tokens_user_id_idx on refresh_tokens (user_id);
@@ -0,0 +1,13 @@
+create table if not exists revoked_tokens (
+	jti varchar(36) primary key,
+	user_id integer not null,
+	expires_at timestamptz not null,
+	created_at timestamptz not null default now()
+);
+
+create index if not exists revoked_tokens_expires_at_idx on revoked_tokens (expires_at);
+
+create table if not exists user_token_revocations (
+	user_id integer primary key,
+	revoked_at timestamptz not null
+);
@@ -0,0 +1,25 @@
+create table if not exists permissions (
+	id serial primary key,
+	code varchar(100) not null unique,
+	name varchar(255) not null
+);
+
+create table if not exists role_has_permissions (
+	role_id integer not null references roles(id) on delete cascade,
+	permission_id integer not null references permissions(id) on delete cascade,
+	primary key (role_id, permission_id)
+);
+
+insert into permissions (code, name) values
+	('users:read', 'Read user data'),
+	('users:write', 'Create and update user data'),
+	('users:delete', 'Delete user data')
+on conflict (code) do nothing;
+
+-- root role always hold every permission, admin get the user management permissions
+insert into role_has_permissions (role_id, permission_id)
+select roles.id, permissions.id
+from roles
+cross join permissions
+where roles.code = 'admin' and permissions.code in ('users:read', 'users:write', 'users:delete')
+on conflict do nothing;
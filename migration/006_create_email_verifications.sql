@@ -0,0 +1,15 @@
+alter table users add column if not exists verified_at timestamptz null;
+
+-- existing accounts were created before verification exists, treat them as verified
+update users set verified_at = now() where verified_at is null;
+
+create table if not exists email_verifications (
+	id serial primary key,
+	user_id integer not null references users(id) on delete cascade,
+	token_hash varchar(64) not null unique,
+	expires_at timestamptz not null,
+	used_at timestamptz null,
+	created_at timestamptz not null default now()
+);
+
+create index if not exists email_verifications_user_id_idx on email_verifications (user_id);
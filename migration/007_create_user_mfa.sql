@@ -0,0 +1,21 @@
+create table if not exists user_mfa (
+	user_id integer primary key references users(id) on delete cascade,
+	secret varchar(64) not null,
+	enabled_at timestamptz null,
+	last_used_step bigint not null default 0,
+	created_at timestamptz not null default now()
+);
+
+create table if not exists user_mfa_recovery_codes (
+	id serial primary key,
+	user_id integer not null references users(id) on delete cascade,
+	code_hash varchar(64) not null,
+	used_at timestamptz null,
+	created_at timestamptz not null default now()
+);
+
+create index if not exists user_mfa_recovery_codes_user_id_idx on user_mfa_recovery_codes (user_id);
+
+alter table roles add column if not exists mfa_required boolean not null default false;
+
+update roles set mfa_required = true where code in ('root', 'admin');
@@ -0,0 +1,10 @@
+create table if not exists login_failures (
+	kind varchar(10) not null,
+	value varchar(320) not null,
+	failures integer not null default 0,
+	last_failed_at timestamptz not null default now(),
+	locked_until timestamptz null,
+	primary key (kind, value)
+);
+
+create index if not exists login_failures_locked_until_idx on login_failures (locked_until);
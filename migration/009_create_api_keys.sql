@@ -0,0 +1,14 @@
+create table if not exists api_keys (
+	id serial primary key,
+	user_id integer not null references users(id) on delete cascade,
+	name varchar(255) not null,
+	prefix varchar(8) not null unique,
+	key_hash varchar(64) not null,
+	scopes text not null,
+	expires_at timestamptz null,
+	last_used_at timestamptz null,
+	revoked_at timestamptz null,
+	created_at timestamptz not null default now()
+);
+
+create index if not exists api_keys_user_id_idx on api_keys (user_id);
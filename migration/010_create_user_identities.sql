@@ -0,0 +1,23 @@
+create table if not exists user_identities (
+	id serial primary key,
+	user_id integer not null references users(id) on delete cascade,
+	provider varchar(100) not null,
+	subject varchar(255) not null,
+	email varchar(255) null,
+	last_login_at timestamptz null,
+	created_at timestamptz not null default now(),
+	unique (provider, subject)
+);
+
+create index if not exists user_identities_user_id_idx on user_identities (user_id);
+
+-- state of authorization request, PKCE code verifier and nonce is kept on server side
+create table if not exists oidc_states (
+	id serial primary key,
+	state_hash varchar(64) not null unique,
+	code_verifier varchar(255) not null,
+	nonce varchar(255) not null,
+	expires_at timestamptz not null,
+	used_at timestamptz null,
+	created_at timestamptz not null default now()
+);
@@ -0,0 +1,12 @@
+-- session id is the refresh token family id, access token carry it as sid claim
+create table if not exists sessions (
+	id varchar(36) primary key,
+	user_id integer not null references users(id) on delete cascade,
+	user_agent text not null default '',
+	ip varchar(64) not null default '',
+	created_at timestamptz not null default now(),
+	last_seen_at timestamptz not null default now(),
+	revoked_at timestamptz null
+);
+
+create index if not exists sessions_user_id_idx on sessions (user_id);
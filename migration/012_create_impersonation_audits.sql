@@ -0,0 +1,28 @@
+insert into permissions (code, name) values
+	('users:impersonate', 'Act as another user')
+on conflict (code) do nothing;
+
+insert into role_has_permissions (role_id, permission_id)
+select roles.id, permissions.id
+from roles
+cross join permissions
+where roles.code = 'admin' and permissions.code = 'users:impersonate'
+on conflict do nothing;
+
+-- start row is written when the token is minted, request row for every call made with the token
+create table if not exists impersonation_audits (
+	id bigserial primary key,
+	actor_id integer not null,
+	user_id integer not null,
+	jti varchar(36) not null,
+	action varchar(20) not null,
+	method varchar(10) not null default '',
+	path text not null default '',
+	status integer not null default 0,
+	ip varchar(64) not null default '',
+	reason text not null default '',
+	created_at timestamptz not null default now()
+);
+
+create index if not exists impersonation_audits_actor_id_idx on impersonation_audits (actor_id);
+create index if not exists impersonation_audits_user_id_idx on impersonation_audits (user_id);
@@ -0,0 +1,12 @@
+insert into permissions (code, name) values
+	('roles:read', 'Read role data'),
+	('roles:write', 'Create, update, and delete role data')
+on conflict (code) do nothing;
+
+-- admin can see roles, changing roles and their permissions is left to root
+insert into role_has_permissions (role_id, permission_id)
+select roles.id, permissions.id
+from roles
+cross join permissions
+where roles.code = 'admin' and permissions.code = 'roles:read'
+on conflict do nothing;
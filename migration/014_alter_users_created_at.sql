@@ -0,0 +1,8 @@
+alter table users add column if not exists created_at timestamptz not null default now();
+
+create index if not exists users_created_at_idx on users (created_at);
+
+-- search of user get-data is like '%term%' on lower case name and email, btree can not serve a leading wildcard
+create extension if not exists pg_trgm;
+create index if not exists users_name_trgm_idx on users using gin (lower(name) gin_trgm_ops);
+create index if not exists users_email_trgm_idx on users using gin (lower(email) gin_trgm_ops);
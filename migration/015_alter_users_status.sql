@@ -0,0 +1,7 @@
+alter table users add column if not exists status varchar(20) not null default 'active';
+alter table users add column if not exists deleted_at timestamptz null;
+
+alter table users drop constraint if exists users_status_check;
+alter table users add constraint users_status_check check (status in ('active', 'disabled'));
+
+create index if not exists users_deleted_at_idx on users (deleted_at);
@@ -0,0 +1,10 @@
+insert into permissions (code, name) values
+	('users:import', 'Import users from file')
+on conflict (code) do nothing;
+
+insert into role_has_permissions (role_id, permission_id)
+select roles.id, permissions.id
+from roles
+cross join permissions
+where roles.code = 'admin' and permissions.code = 'users:import'
+on conflict do nothing;
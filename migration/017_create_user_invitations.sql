@@ -0,0 +1,21 @@
+-- one pending invitation for an email, accepted or revoked invitation is kept as history
+create table if not exists user_invitations (
+	id serial primary key,
+	email varchar(255) not null,
+	token_hash varchar(64) not null unique,
+	invited_by integer null references users(id) on delete set null,
+	user_id integer null references users(id) on delete set null,
+	expires_at timestamptz not null,
+	accepted_at timestamptz null,
+	revoked_at timestamptz null,
+	created_at timestamptz not null default now()
+);
+
+create unique index if not exists user_invitations_pending_email_idx on user_invitations (lower(email))
+	where accepted_at is null and revoked_at is null;
+
+create table if not exists user_invitation_roles (
+	invitation_id integer not null references user_invitations(id) on delete cascade,
+	role_id integer not null references roles(id) on delete cascade,
+	primary key (invitation_id, role_id)
+);
@@ -0,0 +1,56 @@
+create table if not exists organizations (
+	id serial primary key,
+	code varchar(100) not null unique,
+	name varchar(255) not null,
+	created_at timestamptz not null default now()
+);
+
+create table if not exists organization_users (
+	organization_id integer not null references organizations(id) on delete cascade,
+	user_id integer not null references users(id) on delete cascade,
+	created_at timestamptz not null default now(),
+	primary key (organization_id, user_id)
+);
+
+create index if not exists organization_users_user_id_idx on organization_users (user_id);
+
+-- existing data belong to the default organization, new user without organization (ex: OIDC provisioning) join it too
+insert into organizations (code, name) values ('default', 'Default') on conflict (code) do nothing;
+
+insert into organization_users (organization_id, user_id)
+select organizations.id, users.id
+from organizations
+cross join users
+where organizations.code = 'default'
+on conflict do nothing;
+
+-- active organization of the session, carried as org claim of the access token
+alter table sessions add column if not exists organization_id integer null references organizations(id) on delete set null;
+
+alter table persons add column if not exists organization_id integer null references organizations(id) on delete cascade;
+update persons set organization_id = (select id from organizations where code = 'default') where organization_id is null;
+alter table persons alter column organization_id set not null;
+create index if not exists persons_organization_id_idx on persons (organization_id);
+
+alter table user_invitations add column if not exists organization_id integer null references organizations(id) on delete cascade;
+update user_invitations set organization_id = (select id from organizations where code = 'default') where organization_id is null;
+alter table user_invitations alter column organization_id set not null;
+
+create table if not exists files (
+	id serial primary key,
+	organization_id integer not null references organizations(id) on delete cascade,
+	filename varchar(255) not null unique,
+	original_name varchar(255) not null,
+	content_type varchar(255) not null default '',
+	size bigint not null default 0,
+	uploaded_by integer null references users(id) on delete set null,
+	created_at timestamptz not null default now()
+);
+
+create index if not exists files_organization_id_idx on files (organization_id);
+
+-- organization management is root only, root role always hold every permission
+insert into permissions (code, name) values
+	('organizations:read', 'Read organization data'),
+	('organizations:write', 'Create and update organization and its members')
+on conflict (code) do nothing;
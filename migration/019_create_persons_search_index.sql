@@ -0,0 +1,6 @@
+-- full-text search of crud get-data, the expression must match personSearchVector of crud repository
+create index if not exists persons_search_idx on persons
+	using gin (to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(address, '')));
+
+create index if not exists persons_organization_age_idx on persons (organization_id, age);
+create index if not exists persons_organization_name_idx on persons (organization_id, lower(name));
@@ -0,0 +1,2 @@
+-- optimistic concurrency of crud, every update increment the version and it is sent as ETag
+alter table persons add column if not exists version integer not null default 1;
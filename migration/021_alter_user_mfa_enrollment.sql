@@ -0,0 +1,13 @@
+-- pending secret belong to the login challenge that created it, null for enrollment of signed in user
+alter table user_mfa add column if not exists challenge_id varchar(64) null;
+
+-- first enrollment during login need a code sent to the user email, the password alone is not enough
+create table if not exists user_mfa_enrollment_codes (
+	challenge_id varchar(64) primary key,
+	user_id integer not null references users(id) on delete cascade,
+	code_hash varchar(64) not null,
+	expires_at timestamptz not null,
+	created_at timestamptz not null default now()
+);
+
+create index if not exists user_mfa_enrollment_codes_user_id_idx on user_mfa_enrollment_codes (user_id);
@@ -0,0 +1,6 @@
+-- email is stored in lower case, mixed case email is kept when the lower case one is already taken
+update users set email = lower(email)
+where email <> lower(email)
+	and not exists (select 1 from users other where other.id <> users.id and lower(other.email) = lower(users.email));
+
+create index if not exists users_email_lower_idx on users (lower(email));
@@ -0,0 +1,7 @@
+-- sort column of keyset pagination can not be null, null row would never match the cursor condition
+update persons set name = '' where name is null;
+update persons set address = '' where address is null;
+update persons set age = 0 where age is null;
+alter table persons alter column name set not null;
+alter table persons alter column address set not null;
+alter table persons alter column age set not null;
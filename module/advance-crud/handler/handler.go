@@ -7,6 +7,7 @@ import (
 
 	"github.com/labstack/echo"
 	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"github.com/novalwardhana/golang-boilerplate/middleware/auth"
 	"github.com/novalwardhana/golang-boilerplate/module/advance-crud/model"
 	"github.com/novalwardhana/golang-boilerplate/module/advance-crud/usecase"
 )
@@ -22,13 +23,15 @@ func NewHandler(usecase usecase.Usecase) *Handler {
 }
 
 func (h *Handler) Mount(group *echo.Group) {
-	group.POST("/bulk-insert", h.bulkInsert)
-	group.GET("/export-csv", h.exportCSV)
+	group.POST("/bulk-insert", h.bulkInsert, auth.CheckAuth())
+	group.GET("/export-csv", h.exportCSV, auth.CheckAuth())
 }
 
 // BulkInsert:
 func (h *Handler) bulkInsert(c echo.Context) error {
 
+	mc := c.(auth.NewContext)
+
 	/* File validation */
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -36,7 +39,7 @@ func (h *Handler) bulkInsert(c echo.Context) error {
 	}
 
 	/* Process */
-	result := <-h.usecase.BulkInsert(file)
+	result := <-h.usecase.BulkInsert(mc.OrganizationID, file)
 	if result.Error != nil {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
 	}
@@ -47,8 +50,10 @@ func (h *Handler) bulkInsert(c echo.Context) error {
 // ExportCSV:
 func (h *Handler) exportCSV(c echo.Context) error {
 
+	mc := c.(auth.NewContext)
+
 	/* Process */
-	result := <-h.usecase.ExportCSV()
+	result := <-h.usecase.ExportCSV(mc.OrganizationID)
 	if result.Error != nil {
 		return c.JSON(http.StatusNotFound, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
 	}
@@ -12,10 +12,11 @@ type Result struct {
 }
 
 type Person struct {
-	ID      int    `json:"id"`
-	Name    string `json:"name"`
-	Age     int    `json:"age"`
-	Address string `json:"address"`
+	ID             int    `json:"id"`
+	OrganizationID int    `json:"organization_id"`
+	Name           string `json:"name"`
+	Age            int    `json:"age"`
+	Address        string `json:"address"`
 }
 
 func (p *Person) TableName() string {
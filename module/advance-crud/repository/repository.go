@@ -13,7 +13,7 @@ type repository struct {
 
 type Repository interface {
 	Insert(payload *[]*model.Person) <-chan model.Result
-	GetData(persons *[]*model.Person) <-chan model.Result
+	GetData(organizationID int, persons *[]*model.Person) <-chan model.Result
 }
 
 func NewRepository(dbMaster *gorm.DB) Repository {
@@ -50,17 +50,18 @@ func (r *repository) Insert(payload *[]*model.Person) <-chan model.Result {
 }
 
 // ExportCSV:
-func (r *repository) GetData(persons *[]*model.Person) <-chan model.Result {
+func (r *repository) GetData(organizationID int, persons *[]*model.Person) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
-		sql := `select * from persons order by id`
-		rows, err := r.dbMaster.Raw(sql).Rows()
+		sql := `select id, name, age, address from persons where organization_id = ? order by id`
+		rows, err := r.dbMaster.Raw(sql, organizationID).Rows()
 		if err != nil {
 			result <- model.Result{Error: err}
 			return
 		}
+		defer rows.Close()
 		for rows.Next() {
 			var person model.Person
 			if err := rows.Scan(
@@ -22,8 +22,8 @@ type usecase struct {
 }
 
 type Usecase interface {
-	BulkInsert(file *multipart.FileHeader) <-chan model.Result
-	ExportCSV() <-chan model.Result
+	BulkInsert(organizationID int, file *multipart.FileHeader) <-chan model.Result
+	ExportCSV(organizationID int) <-chan model.Result
 }
 
 func NewUsecase(repo repository.Repository) Usecase {
@@ -33,7 +33,7 @@ func NewUsecase(repo repository.Repository) Usecase {
 }
 
 // BulkInsert:
-func (u *usecase) BulkInsert(file *multipart.FileHeader) <-chan model.Result {
+func (u *usecase) BulkInsert(organizationID int, file *multipart.FileHeader) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
@@ -88,9 +88,10 @@ func (u *usecase) BulkInsert(file *multipart.FileHeader) <-chan model.Result {
 				continue
 			}
 			person := &model.Person{
-				Name:    arrData[0],
-				Age:     age,
-				Address: arrData[2],
+				OrganizationID: organizationID,
+				Name:           arrData[0],
+				Age:            age,
+				Address:        arrData[2],
 			}
 			payload = append(payload, person)
 		}
@@ -108,14 +109,14 @@ func (u *usecase) BulkInsert(file *multipart.FileHeader) <-chan model.Result {
 }
 
 // ExportCSV
-func (u *usecase) ExportCSV() <-chan model.Result {
+func (u *usecase) ExportCSV(organizationID int) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Process get data */
 		var persons []*model.Person
-		processGetData := <-u.repo.GetData(&persons)
+		processGetData := <-u.repo.GetData(organizationID, &persons)
 		if processGetData.Error != nil {
 			result <- model.Result{Error: processGetData.Error}
 			return
@@ -1,10 +1,16 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/labstack/echo"
+	"github.com/novalwardhana/golang-boilerplate/helper/cursor"
+	"github.com/novalwardhana/golang-boilerplate/middleware/auth"
 	"github.com/novalwardhana/golang-boilerplate/module/crud/model"
 	"github.com/novalwardhana/golang-boilerplate/module/crud/usecase"
 )
@@ -20,21 +26,26 @@ func NewHandler(uc usecase.Usecase) *Handler {
 }
 
 func (h *Handler) Mount(group *echo.Group) {
-	group.POST("/create", h.create)
-	group.GET("/get-data", h.getData)
-	group.GET("/detail", h.detail)
-	group.PUT("/update/:id", h.update)
-	group.DELETE("/delete/:id", h.delete)
+	group.POST("/create", h.create, auth.CheckAuth())
+	group.GET("/get-data", h.getData, auth.CheckAuth())
+	group.GET("/detail", h.detail, auth.CheckAuth())
+	group.PUT("/update/:id", h.update, auth.CheckAuth())
+	group.PATCH("/update/:id", h.patch, auth.CheckAuth())
+	group.DELETE("/delete/:id", h.delete, auth.CheckAuth(), auth.RefuseImpersonation())
+	group.POST("/batch", h.batch, auth.CheckAuth(), auth.RefuseImpersonation())
 }
 
 // Create:
 func (h *Handler) create(c echo.Context) error {
 
+	mc := c.(auth.NewContext)
+
 	/* Payload validation */
 	params := new(model.Person)
 	if err := c.Bind(params); err != nil {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
 	}
+	params.OrganizationID = mc.OrganizationID
 
 	/* Create process */
 	result := <-h.uc.Create(params)
@@ -47,15 +58,7 @@ func (h *Handler) create(c echo.Context) error {
 // GetData:
 func (h *Handler) getData(c echo.Context) error {
 
-	/* Page parameter validation */
-	paramPage := c.QueryParam("page")
-	page, err := strconv.Atoi(paramPage)
-	if err != nil {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Page parameter not valid"})
-	}
-	if page <= 0 {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Page parameter not valid"})
-	}
+	mc := c.(auth.NewContext)
 
 	/* Limit parameter validation */
 	paramLimit := c.QueryParam("limit")
@@ -67,8 +70,37 @@ func (h *Handler) getData(c echo.Context) error {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Limit parameter not valid"})
 	}
 
+	/* Filter parameter validation */
+	filter, err := personFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	filter.OrganizationID = mc.OrganizationID
+
+	/* Cursor mode is used when cursor parameter is sent, empty cursor read the first page */
+	if _, ok := c.QueryParams()["cursor"]; ok {
+		result := <-h.uc.GetDataCursor(limit, c.QueryParam("cursor"), c.QueryParam("estimate") == "true", filter)
+		if errors.Is(result.Error, cursor.ErrInvalidCursor) {
+			return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+		}
+		if result.Error != nil {
+			return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+		}
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get data", Data: result.Data})
+	}
+
+	/* Page parameter validation */
+	paramPage := c.QueryParam("page")
+	page, err := strconv.Atoi(paramPage)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Page parameter not valid"})
+	}
+	if page <= 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Page parameter not valid"})
+	}
+
 	/* Get data process */
-	result := <-h.uc.GetData(page, limit)
+	result := <-h.uc.GetData(page, limit, filter)
 	if result.Error != nil {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
 	}
@@ -78,6 +110,8 @@ func (h *Handler) getData(c echo.Context) error {
 // Detail:
 func (h *Handler) detail(c echo.Context) error {
 
+	mc := c.(auth.NewContext)
+
 	/* ID paramater validation */
 	idParam := c.QueryParam("id")
 	id, err := strconv.Atoi(idParam)
@@ -86,10 +120,11 @@ func (h *Handler) detail(c echo.Context) error {
 	}
 
 	/* Detail process */
-	result := <-h.uc.Detail(id)
+	result := <-h.uc.Detail(mc.OrganizationID, id)
 	if result.Error != nil {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
 	}
+	setETag(c, result.Data.(model.Person))
 
 	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get data", Data: result.Data})
 }
@@ -97,6 +132,8 @@ func (h *Handler) detail(c echo.Context) error {
 // Update:
 func (h *Handler) update(c echo.Context) error {
 
+	mc := c.(auth.NewContext)
+
 	/* ID parameter validation */
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
@@ -110,18 +147,59 @@ func (h *Handler) update(c echo.Context) error {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
 	}
 	params.ID = id
+	params.OrganizationID = mc.OrganizationID
 
 	/* Update process */
-	result := <-h.uc.Update(params)
+	result := <-h.uc.Update(params, ifMatch(c))
 	if result.Error != nil {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+		return errorResponse(c, result.Error)
+	}
+	setETag(c, result.Data.(model.Person))
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success update data", Data: result.Data})
+}
+
+// Patch: body is JSON merge patch, or with fields parameter (ex: fields=name,age) only the listed fields of the body is updated
+// and listed field that is absent from the body is reset to its zero value
+func (h *Handler) patch(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Payload validation */
+	body := map[string]json.RawMessage{}
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Payload must be JSON object"})
+	}
+	var patch model.PersonPatch
+	if fields := c.QueryParam("fields"); len(fields) > 0 {
+		patch, err = fieldMaskPatch(body, strings.Split(fields, ","))
+	} else {
+		patch, err = mergePatch(body)
+	}
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Patch process */
+	result := <-h.uc.Patch(mc.OrganizationID, id, ifMatch(c), patch)
+	if result.Error != nil {
+		return errorResponse(c, result.Error)
 	}
+	setETag(c, result.Data.(model.Person))
 	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success update data", Data: result.Data})
 }
 
 // Delete
 func (h *Handler) delete(c echo.Context) error {
 
+	mc := c.(auth.NewContext)
+
 	/* ID paramater validation */
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
@@ -130,9 +208,183 @@ func (h *Handler) delete(c echo.Context) error {
 	}
 
 	/* Delete process */
-	result := <-h.uc.Delete(id)
+	result := <-h.uc.Delete(mc.OrganizationID, id, ifMatch(c))
 	if result.Error != nil {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+		return errorResponse(c, result.Error)
 	}
 	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success delete data"})
 }
+
+// Batch: rolled back batch is not accepted, result of every operation is returned in both case
+func (h *Handler) batch(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* Payload validation */
+	request := new(model.BatchRequest)
+	if err := c.Bind(request); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	for index, operation := range request.Operations {
+		switch operation.Operation {
+		case model.BatchOperationCreate:
+		case model.BatchOperationUpdate, model.BatchOperationDelete:
+			if operation.ID <= 0 {
+				return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: fmt.Sprintf("ID of operation %d not valid", index)})
+			}
+		default:
+			return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: fmt.Sprintf("Operation %d must be create, update, or delete", index)})
+		}
+	}
+
+	/* Batch process */
+	result := <-h.uc.Batch(mc.OrganizationID, *request)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotAcceptable, Message: result.Error.Error()})
+	}
+	response := result.Data.(model.BatchResponse)
+	if !response.Committed {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotAcceptable, Message: "Batch is rolled back", Data: response})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success process batch", Data: response})
+}
+
+// personFilter: sort is comma separated column of id, name, age, or address, column with - prefix is sorted descending (ex: age,-name)
+func personFilter(c echo.Context) (model.PersonFilter, error) {
+	filter := model.PersonFilter{
+		Search: strings.TrimSpace(c.QueryParam("search")),
+	}
+
+	/* Age range parameter validation */
+	if paramMinAge := c.QueryParam("min_age"); len(paramMinAge) > 0 {
+		minAge, err := strconv.Atoi(paramMinAge)
+		if err != nil || minAge < 0 {
+			return filter, errors.New("Min age parameter not valid")
+		}
+		filter.MinAge = &minAge
+	}
+	if paramMaxAge := c.QueryParam("max_age"); len(paramMaxAge) > 0 {
+		maxAge, err := strconv.Atoi(paramMaxAge)
+		if err != nil || maxAge < 0 {
+			return filter, errors.New("Max age parameter not valid")
+		}
+		filter.MaxAge = &maxAge
+	}
+	if filter.MinAge != nil && filter.MaxAge != nil && *filter.MinAge > *filter.MaxAge {
+		return filter, errors.New("Min age must not be greater than max age")
+	}
+
+	/* Sort parameter validation */
+	columns := map[string]bool{}
+	for _, column := range strings.Split(c.QueryParam("sort"), ",") {
+		column = strings.TrimSpace(column)
+		if len(column) == 0 {
+			continue
+		}
+		sortField := model.SortField{Column: strings.TrimPrefix(column, "-"), Desc: strings.HasPrefix(column, "-")}
+		if sortField.Column != "id" && sortField.Column != "name" && sortField.Column != "age" && sortField.Column != "address" {
+			return filter, errors.New("Sort must be id, name, age, or address")
+		}
+		if columns[sortField.Column] {
+			return filter, errors.New("Sort column must be unique")
+		}
+		columns[sortField.Column] = true
+		filter.Sort = append(filter.Sort, sortField)
+	}
+	return filter, nil
+}
+
+// mergePatch: every member of the body is updated, column of person is not nullable so null is refused
+func mergePatch(body map[string]json.RawMessage) (model.PersonPatch, error) {
+	patch := model.PersonPatch{}
+	for field, value := range body {
+		if string(value) == "null" {
+			return patch, fmt.Errorf("Field %s can not be null", field)
+		}
+		if err := setPatchField(&patch, field, value); err != nil {
+			return patch, err
+		}
+	}
+	return patch, nil
+}
+
+// fieldMaskPatch:
+func fieldMaskPatch(body map[string]json.RawMessage, fields []string) (model.PersonPatch, error) {
+	patch := model.PersonPatch{}
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		value, ok := body[field]
+		if !ok || string(value) == "null" {
+			value = json.RawMessage(zeroValues[field])
+		}
+		if err := setPatchField(&patch, field, value); err != nil {
+			return patch, err
+		}
+	}
+	return patch, nil
+}
+
+var zeroValues = map[string]string{
+	"name":    `""`,
+	"age":     `0`,
+	"address": `""`,
+}
+
+// setPatchField: id and organization of person can not be patched
+func setPatchField(patch *model.PersonPatch, field string, value json.RawMessage) error {
+	var err error
+	switch field {
+	case "name":
+		patch.Name = new(string)
+		err = json.Unmarshal(value, patch.Name)
+	case "age":
+		patch.Age = new(int)
+		err = json.Unmarshal(value, patch.Age)
+	case "address":
+		patch.Address = new(string)
+		err = json.Unmarshal(value, patch.Address)
+	default:
+		return fmt.Errorf("Field %s can not be updated", field)
+	}
+	if err != nil {
+		return fmt.Errorf("Field %s not valid", field)
+	}
+	return nil
+}
+
+// headerIfMatch: precondition of update and delete, the value is ETag of detail
+const headerIfMatch string = "If-Match"
+
+// headerETag:
+const headerETag string = "ETag"
+
+// setETag: ETag is the version of the person
+func setETag(c echo.Context, person model.Person) {
+	c.Response().Header().Set(headerETag, strconv.Quote(strconv.Itoa(person.Version)))
+}
+
+// ifMatch: expected version of If-Match header, zero when there is no precondition.
+// Weak or malformed ETag never match the current version
+func ifMatch(c echo.Context) int {
+	value := strings.TrimSpace(c.Request().Header.Get(headerIfMatch))
+	if len(value) == 0 || value == "*" {
+		return 0
+	}
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return -1
+	}
+	version, err := strconv.Atoi(unquoted)
+	if err != nil || version < 1 {
+		return -1
+	}
+	return version
+}
+
+// errorResponse: failed precondition use the real http status so client and proxy can detect it
+func errorResponse(c echo.Context, err error) error {
+	if errors.Is(err, model.ErrVersionMismatch) {
+		return c.JSON(http.StatusPreconditionFailed, model.Response{Status: http.StatusPreconditionFailed, Message: err.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: err.Error()})
+}
@@ -1,16 +1,83 @@
 package model
 
+import "errors"
+
+var ErrVersionMismatch = errors.New("Data has been changed by another request")
+
 type Person struct {
-	ID      int    `json:"id" gorm:"id"`
-	Name    string `json:"name" gorm:"name"`
-	Age     int    `json:"age" gorm:"age"`
-	Address string `json:"address" gorm:"address"`
+	ID             int    `json:"id" gorm:"id"`
+	OrganizationID int    `json:"organization_id" gorm:"organization_id"`
+	Name           string `json:"name" gorm:"name"`
+	Age            int    `json:"age" gorm:"age"`
+	Address        string `json:"address" gorm:"address"`
+	Version        int    `json:"version" gorm:"version"`
 }
 
 func (p *Person) TableName() string {
 	return "persons"
 }
 
+// PersonPatch: nil field is not updated
+type PersonPatch struct {
+	Name    *string
+	Age     *int
+	Address *string
+}
+
+// PersonFilter: search is full-text over name and address, sort is applied in order and id is the last tiebreaker
+type PersonFilter struct {
+	OrganizationID int
+	Search         string
+	MinAge         *int
+	MaxAge         *int
+	Sort           []SortField
+}
+
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+const (
+	BatchOperationCreate string = "create"
+	BatchOperationUpdate string = "update"
+	BatchOperationDelete string = "delete"
+
+	BatchStatusSuccess    string = "success"
+	BatchStatusFailed     string = "failed"
+	BatchStatusRolledBack string = "rolled_back"
+	BatchStatusSkipped    string = "skipped"
+)
+
+// BatchRequest: all operation is rolled back on the first failure unless continue on error is set
+type BatchRequest struct {
+	ContinueOnError bool             `json:"continue_on_error"`
+	Operations      []BatchOperation `json:"operations"`
+}
+
+// BatchOperation: id and version is used by update and delete, version zero skip the version check
+type BatchOperation struct {
+	Operation string `json:"operation"`
+	ID        int    `json:"id"`
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Age       int    `json:"age"`
+	Address   string `json:"address"`
+}
+
+type BatchResult struct {
+	Index     int     `json:"index"`
+	Operation string  `json:"operation"`
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	Data      *Person `json:"data,omitempty"`
+}
+
+type BatchResponse struct {
+	Committed bool          `json:"committed"`
+	Results   []BatchResult `json:"results"`
+}
+
 type Response struct {
 	Status  int         `json:"status"`
 	Message string      `json:"message"`
@@ -22,10 +89,14 @@ type Result struct {
 	Error error       `json:"error"`
 }
 
+// Pagination: cursor mode fill next and prev cursor instead of page and total, estimated total is only filled on request
 type Pagination struct {
-	Page         int      `json:"page"`
-	Limit        int      `json:"limit"`
-	TotalData    int      `json:"total_data"`
-	NumberOfPage int      `json:"number_of_page"`
-	Data         []Person `json:"data"`
+	Page           int      `json:"page"`
+	Limit          int      `json:"limit"`
+	TotalData      int      `json:"total_data"`
+	NumberOfPage   int      `json:"number_of_page"`
+	Data           []Person `json:"data"`
+	NextCursor     string   `json:"next_cursor,omitempty"`
+	PrevCursor     string   `json:"prev_cursor,omitempty"`
+	EstimatedTotal *int     `json:"estimated_total,omitempty"`
 }
@@ -1,6 +1,13 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/novalwardhana/golang-boilerplate/helper/cursor"
 	"github.com/novalwardhana/golang-boilerplate/module/crud/model"
 	"gorm.io/gorm"
 )
@@ -11,11 +18,15 @@ type repository struct {
 
 type Repository interface {
 	Create(params *model.Person) <-chan model.Result
-	CountData() <-chan model.Result
-	GetData(page, limit int) <-chan model.Result
-	Detail(id int) <-chan model.Result
-	Update(params *model.Person) <-chan model.Result
-	Delete(id int) <-chan model.Result
+	CountData(filter model.PersonFilter) <-chan model.Result
+	GetData(page, limit int, filter model.PersonFilter) <-chan model.Result
+	GetDataCursor(limit int, after string, filter model.PersonFilter) <-chan model.Result
+	EstimateData(filter model.PersonFilter) <-chan model.Result
+	Detail(organizationID, id int) <-chan model.Result
+	Update(params *model.Person, version int) <-chan model.Result
+	Patch(organizationID, id, version int, patch model.PersonPatch) <-chan model.Result
+	Delete(organizationID, id, version int) <-chan model.Result
+	Batch(organizationID int, operations []model.BatchOperation, continueOnError bool) <-chan model.Result
 }
 
 func NewRepository(dbMaster *gorm.DB) Repository {
@@ -32,7 +43,7 @@ func (repo *repository) Create(params *model.Person) <-chan model.Result {
 
 		/* Process add data to database */
 		tx := repo.dbMaster.Begin()
-		if err := tx.Create(params).Error; err != nil {
+		if err := createPerson(tx, params); err != nil {
 			tx.Rollback()
 			result <- model.Result{Error: err}
 			return
@@ -44,16 +55,17 @@ func (repo *repository) Create(params *model.Person) <-chan model.Result {
 	return result
 }
 
-// CountData:
-func (repo *repository) CountData() <-chan model.Result {
+// CountData: count over the same filter as GetData
+func (repo *repository) CountData(filter model.PersonFilter) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Process count data */
 		var count int64
-		sql := `select count(id) from persons`
-		if err := repo.dbMaster.Raw(sql).Count(&count).Error; err != nil {
+		where, args := personFilterQuery(filter)
+		sql := `select count(id) from persons ` + where
+		if err := repo.dbMaster.Raw(sql, args...).Count(&count).Error; err != nil {
 			result <- model.Result{Error: err}
 			return
 		}
@@ -64,7 +76,7 @@ func (repo *repository) CountData() <-chan model.Result {
 }
 
 // GetData:
-func (repo *repository) GetData(page, limit int) <-chan model.Result {
+func (repo *repository) GetData(page, limit int, filter model.PersonFilter) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
@@ -72,8 +84,10 @@ func (repo *repository) GetData(page, limit int) <-chan model.Result {
 		/* Process get data */
 		var persons []model.Person
 		offset := (page - 1) * limit
-		sql := `select * from persons order by id desc offset ? limit ? `
-		if err := repo.dbMaster.Raw(sql, offset, limit).Find(&persons).Error; err != nil {
+		where, args := personFilterQuery(filter)
+		sql := `select * from persons ` + where + ` order by ` + personSortQuery(filter) + ` offset ? limit ? `
+		args = append(args, offset, limit)
+		if err := repo.dbMaster.Raw(sql, args...).Find(&persons).Error; err != nil {
 			result <- model.Result{Error: err}
 			return
 		}
@@ -83,16 +97,105 @@ func (repo *repository) GetData(page, limit int) <-chan model.Result {
 	return result
 }
 
+// GetDataCursor: keyset pagination, one more row is read to know whether there is next page.
+// Empty cursor read the first page
+func (repo *repository) GetDataCursor(limit int, after string, filter model.PersonFilter) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Decode cursor */
+		signature := personCursorSignature(filter)
+		var key *model.Person
+		backward := false
+		if len(after) > 0 {
+			var decoded personKey
+			var err error
+			backward, err = cursor.Decode(after, signature, &decoded)
+			if err != nil {
+				result <- model.Result{Error: err}
+				return
+			}
+			key = &model.Person{ID: decoded.ID, Name: decoded.Name, Age: decoded.Age, Address: decoded.Address}
+		}
+
+		/* Process get data */
+		var persons []model.Person
+		where, args := personFilterQuery(filter)
+		columns := personSortKey(filter, key)
+		if key != nil {
+			condition, conditionArgs := cursor.Condition(columns, backward)
+			where += " and " + condition
+			args = append(args, conditionArgs...)
+		}
+		sql := `select * from persons ` + where + ` order by ` + cursor.Order(columns, backward) + ` limit ?`
+		args = append(args, limit+1)
+		if err := repo.dbMaster.Raw(sql, args...).Find(&persons).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		hasMore := len(persons) > limit
+		if hasMore {
+			persons = persons[:limit]
+		}
+		if backward {
+			for i, j := 0, len(persons)-1; i < j; i, j = i+1, j-1 {
+				persons[i], persons[j] = persons[j], persons[i]
+			}
+		}
+
+		/* Create next and prev cursor */
+		pagination := model.Pagination{Limit: limit, Data: persons}
+		if len(persons) > 0 {
+			var err error
+			if hasMore || backward {
+				if pagination.NextCursor, err = cursor.Encode(signature, false, newPersonKey(persons[len(persons)-1])); err != nil {
+					result <- model.Result{Error: err}
+					return
+				}
+			}
+			if (backward && hasMore) || (!backward && key != nil) {
+				if pagination.PrevCursor, err = cursor.Encode(signature, true, newPersonKey(persons[0])); err != nil {
+					result <- model.Result{Error: err}
+					return
+				}
+			}
+		}
+		result <- model.Result{Data: pagination}
+
+	}()
+	return result
+}
+
+// EstimateData: planner estimate over the same filter as GetData
+func (repo *repository) EstimateData(filter model.PersonFilter) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process estimate data */
+		where, args := personFilterQuery(filter)
+		estimate, err := cursor.Estimate(repo.dbMaster, `select id from persons `+where, args...)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: estimate}
+
+	}()
+	return result
+}
+
 // Detail:
-func (repo *repository) Detail(id int) <-chan model.Result {
+func (repo *repository) Detail(organizationID, id int) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Process get data from database */
 		var person model.Person
-		sql := `select * from persons where id = ?`
-		if err := repo.dbMaster.Raw(sql, id).First(&person).Error; err != nil {
+		sql := `select * from persons where id = ? and organization_id = ?`
+		if err := repo.dbMaster.Raw(sql, id, organizationID).First(&person).Error; err != nil {
 			result <- model.Result{Error: err}
 			return
 		}
@@ -102,25 +205,58 @@ func (repo *repository) Detail(id int) <-chan model.Result {
 	return result
 }
 
-// Update:
-func (repo *repository) Update(params *model.Person) <-chan model.Result {
+// Update: person of other organization is not found, version zero skip the version check
+func (repo *repository) Update(params *model.Person, version int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process update data */
+		tx := repo.dbMaster.Begin()
+		person, err := updatePerson(tx, params, version)
+		if err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		tx.Commit()
+
+		result <- model.Result{Data: person}
+	}()
+	return result
+}
+
+// Patch: only the given field is updated, result is the updated person
+func (repo *repository) Patch(organizationID, id, version int, patch model.PersonPatch) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Process get data */
 		tx := repo.dbMaster.Begin()
-		var person model.Person
-		sql := `select * from persons where id = ?`
-		if err := tx.Raw(sql, params.ID).First(&person).Error; err != nil {
+		person, err := lockPerson(tx, organizationID, id, version)
+		if err != nil {
+			tx.Rollback()
 			result <- model.Result{Error: err}
 			return
 		}
 
-		/* Process update data */
-		person.Name = params.Name
-		person.Age = params.Age
-		person.Address = params.Address
+		/* Process update data, empty patch keep the version */
+		if patch.Name == nil && patch.Age == nil && patch.Address == nil {
+			tx.Rollback()
+			result <- model.Result{Data: person}
+			return
+		}
+		if patch.Name != nil {
+			person.Name = *patch.Name
+		}
+		if patch.Age != nil {
+			person.Age = *patch.Age
+		}
+		if patch.Address != nil {
+			person.Address = *patch.Address
+		}
+		person.Version++
 		if err := tx.Save(&person).Error; err != nil {
 			tx.Rollback()
 			result <- model.Result{Error: err}
@@ -134,14 +270,14 @@ func (repo *repository) Update(params *model.Person) <-chan model.Result {
 }
 
 // Delete:
-func (repo *repository) Delete(id int) <-chan model.Result {
+func (repo *repository) Delete(organizationID, id, version int) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Process delete */
 		tx := repo.dbMaster.Begin()
-		if err := tx.Delete(&model.Person{}, id).Error; err != nil {
+		if err := deletePerson(tx, organizationID, id, version); err != nil {
 			tx.Rollback()
 			result <- model.Result{Error: err}
 			return
@@ -151,3 +287,246 @@ func (repo *repository) Delete(id int) <-chan model.Result {
 	}()
 	return result
 }
+
+// Batch: every operation run in one transaction. Continue on error rollback only the failed operation to its savepoint,
+// otherwise the first failure rollback the whole batch
+func (repo *repository) Batch(organizationID int, operations []model.BatchOperation, continueOnError bool) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		tx := repo.dbMaster.Begin()
+		if tx.Error != nil {
+			result <- model.Result{Error: tx.Error}
+			return
+		}
+		response := model.BatchResponse{Results: make([]model.BatchResult, len(operations))}
+		for index, operation := range operations {
+			response.Results[index] = model.BatchResult{Index: index, Operation: operation.Operation, Status: model.BatchStatusSkipped}
+		}
+
+		for index, operation := range operations {
+			if continueOnError {
+				if err := tx.SavePoint("batch_operation").Error; err != nil {
+					tx.Rollback()
+					result <- model.Result{Error: err}
+					return
+				}
+			}
+
+			/* Process operation */
+			person, err := batchOperation(tx, organizationID, operation)
+			if err == nil {
+				response.Results[index].Status = model.BatchStatusSuccess
+				response.Results[index].Data = person
+				continue
+			}
+			response.Results[index].Status = model.BatchStatusFailed
+			response.Results[index].Error = err.Error()
+
+			/* Rollback the whole batch */
+			if !continueOnError {
+				tx.Rollback()
+				for previous := range response.Results[:index] {
+					response.Results[previous].Status = model.BatchStatusRolledBack
+					response.Results[previous].Data = nil
+				}
+				result <- model.Result{Data: response}
+				return
+			}
+
+			/* Rollback the failed operation */
+			if err := tx.RollbackTo("batch_operation").Error; err != nil {
+				tx.Rollback()
+				result <- model.Result{Error: err}
+				return
+			}
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		response.Committed = true
+		result <- model.Result{Data: response}
+
+	}()
+	return result
+}
+
+// batchOperation: result is nil for delete
+func batchOperation(tx *gorm.DB, organizationID int, operation model.BatchOperation) (*model.Person, error) {
+	params := model.Person{
+		ID:             operation.ID,
+		OrganizationID: organizationID,
+		Name:           operation.Name,
+		Age:            operation.Age,
+		Address:        operation.Address,
+	}
+	switch operation.Operation {
+	case model.BatchOperationCreate:
+		params.ID = 0
+		if err := createPerson(tx, &params); err != nil {
+			return nil, err
+		}
+		return &params, nil
+	case model.BatchOperationUpdate:
+		person, err := updatePerson(tx, &params, operation.Version)
+		if err != nil {
+			return nil, err
+		}
+		return &person, nil
+	case model.BatchOperationDelete:
+		return nil, deletePerson(tx, organizationID, operation.ID, operation.Version)
+	}
+	return nil, errors.New("Operation must be create, update, or delete")
+}
+
+func createPerson(tx *gorm.DB, params *model.Person) error {
+	params.Version = 1
+	return tx.Create(params).Error
+}
+
+func updatePerson(tx *gorm.DB, params *model.Person, version int) (model.Person, error) {
+	person, err := lockPerson(tx, params.OrganizationID, params.ID, version)
+	if err != nil {
+		return person, err
+	}
+	person.Name = params.Name
+	person.Age = params.Age
+	person.Address = params.Address
+	person.Version++
+	err = tx.Save(&person).Error
+	return person, err
+}
+
+func deletePerson(tx *gorm.DB, organizationID, id, version int) error {
+	if _, err := lockPerson(tx, organizationID, id, version); err != nil {
+		return err
+	}
+	return tx.Delete(&model.Person{}, id).Error
+}
+
+// lockPerson: row is locked until the transaction end so the version can not change between the check and the write
+func lockPerson(tx *gorm.DB, organizationID, id, version int) (model.Person, error) {
+	var person model.Person
+	sql := `select * from persons where id = ? and organization_id = ? for update`
+	if err := tx.Raw(sql, id, organizationID).First(&person).Error; err != nil {
+		return person, err
+	}
+	if version != 0 && person.Version != version {
+		return person, model.ErrVersionMismatch
+	}
+	return person, nil
+}
+
+// personSearchVector: same expression as the full-text index of persons so the index is used
+const personSearchVector string = `to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(address, ''))`
+
+// personSortColumns: only allowlisted column is used in order by
+var personSortColumns = map[string]sortColumn{
+	"id":      {expr: "id", param: "?", value: func(p model.Person) interface{} { return p.ID }},
+	"name":    {expr: "lower(name)", param: "lower(?)", value: func(p model.Person) interface{} { return p.Name }},
+	"age":     {expr: "age", param: "?", value: func(p model.Person) interface{} { return p.Age }},
+	"address": {expr: "lower(address)", param: "lower(?)", value: func(p model.Person) interface{} { return p.Address }},
+}
+
+type sortColumn struct {
+	expr  string
+	param string
+	value func(model.Person) interface{}
+}
+
+// personKey: sort value of the row kept in cursor
+type personKey struct {
+	ID      int    `json:"i"`
+	Name    string `json:"n"`
+	Age     int    `json:"a"`
+	Address string `json:"d"`
+}
+
+// personFilterQuery:
+func personFilterQuery(filter model.PersonFilter) (string, []interface{}) {
+	conditions := []string{`organization_id = ?`}
+	args := []interface{}{filter.OrganizationID}
+	if search := searchQuery(filter.Search); len(search) > 0 {
+		conditions = append(conditions, personSearchVector+` @@ to_tsquery('simple', ?)`)
+		args = append(args, search)
+	}
+	if filter.MinAge != nil {
+		conditions = append(conditions, `age >= ?`)
+		args = append(args, *filter.MinAge)
+	}
+	if filter.MaxAge != nil {
+		conditions = append(conditions, `age <= ?`)
+		args = append(args, *filter.MaxAge)
+	}
+	return "where " + strings.Join(conditions, " and "), args
+}
+
+// personSortQuery: default is the latest person first
+func personSortQuery(filter model.PersonFilter) string {
+	return cursor.Order(personSortKey(filter, nil), false)
+}
+
+// personSortKey: id is the last tiebreaker so the order is stable, key fill the cursor value of each column
+func personSortKey(filter model.PersonFilter, key *model.Person) []cursor.Column {
+	columns := []cursor.Column{}
+	sortByID := false
+	sortFields := filter.Sort
+	for _, sortField := range filter.Sort {
+		sortByID = sortByID || sortField.Column == "id"
+	}
+	if !sortByID {
+		sortFields = append(sortFields, model.SortField{Column: "id", Desc: true})
+	}
+	for _, sortField := range sortFields {
+		sortColumn, ok := personSortColumns[sortField.Column]
+		if !ok {
+			continue
+		}
+		column := cursor.Column{Expr: sortColumn.expr, Param: sortColumn.param, Desc: sortField.Desc}
+		if key != nil {
+			column.Value = sortColumn.value(*key)
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// personCursorSignature: cursor is only valid for the filter and sort it was created with, value is normalized
+// the same way as personFilterQuery and personSortKey so equivalent request share the cursor
+func personCursorSignature(filter model.PersonFilter) string {
+	ageRange := []string{"", ""}
+	if filter.MinAge != nil {
+		ageRange[0] = strconv.Itoa(*filter.MinAge)
+	}
+	if filter.MaxAge != nil {
+		ageRange[1] = strconv.Itoa(*filter.MaxAge)
+	}
+	columns := []string{}
+	for _, column := range personSortKey(filter, nil) {
+		if column.Desc {
+			columns = append(columns, "-"+column.Expr)
+			continue
+		}
+		columns = append(columns, column.Expr)
+	}
+	return fmt.Sprintf("%q", []string{searchQuery(filter.Search), ageRange[0], ageRange[1], strings.Join(columns, ",")})
+}
+
+func newPersonKey(person model.Person) personKey {
+	return personKey{ID: person.ID, Name: person.Name, Age: person.Age, Address: person.Address}
+}
+
+// searchQuery: every word of the input is a prefix match and all words must match,
+// punctuation is dropped so user input can not break tsquery syntax
+func searchQuery(search string) string {
+	words := strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for index := range words {
+		words[index] = words[index] + ":*"
+	}
+	return strings.Join(words, " & ")
+}
@@ -1,8 +1,11 @@
 package usecase
 
 import (
+	"errors"
+	"fmt"
 	"math"
 
+	"github.com/novalwardhana/golang-boilerplate/config/env"
 	"github.com/novalwardhana/golang-boilerplate/module/crud/model"
 	"github.com/novalwardhana/golang-boilerplate/module/crud/repository"
 )
@@ -13,10 +16,13 @@ type usecase struct {
 
 type Usecase interface {
 	Create(params *model.Person) <-chan model.Result
-	GetData(page, limit int) <-chan model.Result
-	Detail(id int) <-chan model.Result
-	Update(params *model.Person) <-chan model.Result
-	Delete(id int) <-chan model.Result
+	GetData(page, limit int, filter model.PersonFilter) <-chan model.Result
+	GetDataCursor(limit int, after string, estimate bool, filter model.PersonFilter) <-chan model.Result
+	Detail(organizationID, id int) <-chan model.Result
+	Update(params *model.Person, version int) <-chan model.Result
+	Patch(organizationID, id, version int, patch model.PersonPatch) <-chan model.Result
+	Delete(organizationID, id, version int) <-chan model.Result
+	Batch(organizationID int, request model.BatchRequest) <-chan model.Result
 }
 
 func NewUsecase(repo repository.Repository) Usecase {
@@ -44,13 +50,13 @@ func (uc *usecase) Create(params *model.Person) <-chan model.Result {
 }
 
 // GetData:
-func (uc *usecase) GetData(page, limit int) <-chan model.Result {
+func (uc *usecase) GetData(page, limit int, filter model.PersonFilter) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Count data process */
-		processCountData := <-uc.repo.CountData()
+		processCountData := <-uc.repo.CountData(filter)
 		if processCountData.Error != nil {
 			result <- model.Result{Error: processCountData.Error}
 			return
@@ -59,7 +65,7 @@ func (uc *usecase) GetData(page, limit int) <-chan model.Result {
 		numberOfPage := int(math.Ceil(float64(totalData) / float64(limit)))
 
 		/* Get data process */
-		processGetData := <-uc.repo.GetData(page, limit)
+		processGetData := <-uc.repo.GetData(page, limit, filter)
 		if processGetData.Error != nil {
 			result <- model.Result{Error: processGetData.Error}
 			return
@@ -76,14 +82,45 @@ func (uc *usecase) GetData(page, limit int) <-chan model.Result {
 	return result
 }
 
+// GetDataCursor: total is not counted, estimate is the cheap replacement of it
+func (uc *usecase) GetDataCursor(limit int, after string, estimate bool, filter model.PersonFilter) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get data process */
+		processGetData := <-uc.repo.GetDataCursor(limit, after, filter)
+		if processGetData.Error != nil {
+			result <- model.Result{Error: processGetData.Error}
+			return
+		}
+		pagination := processGetData.Data.(model.Pagination)
+
+		/* Estimate data process */
+		if estimate {
+			processEstimateData := <-uc.repo.EstimateData(filter)
+			if processEstimateData.Error != nil {
+				result <- model.Result{Error: processEstimateData.Error}
+				return
+			}
+			estimatedTotal := processEstimateData.Data.(int)
+			pagination.EstimatedTotal = &estimatedTotal
+		}
+
+		result <- model.Result{Data: pagination}
+
+	}()
+	return result
+}
+
 // Detail:
-func (uc *usecase) Detail(id int) <-chan model.Result {
+func (uc *usecase) Detail(organizationID, id int) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Detail process */
-		process := <-uc.repo.Detail(id)
+		process := <-uc.repo.Detail(organizationID, id)
 		if process.Error != nil {
 			result <- model.Result{Error: process.Error}
 			return
@@ -94,14 +131,32 @@ func (uc *usecase) Detail(id int) <-chan model.Result {
 	return result
 }
 
-// Update:
-func (uc *usecase) Update(params *model.Person) <-chan model.Result {
+// Update: version is the expected current version, zero when the caller does not send a precondition
+func (uc *usecase) Update(params *model.Person, version int) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Update process */
-		process := <-uc.repo.Update(params)
+		process := <-uc.repo.Update(params, version)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		result <- model.Result{Data: process.Data}
+
+	}()
+	return result
+}
+
+// Patch:
+func (uc *usecase) Patch(organizationID, id, version int, patch model.PersonPatch) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Patch process */
+		process := <-uc.repo.Patch(organizationID, id, version, patch)
 		if process.Error != nil {
 			result <- model.Result{Error: process.Error}
 			return
@@ -113,13 +168,13 @@ func (uc *usecase) Update(params *model.Person) <-chan model.Result {
 }
 
 // Delete:
-func (uc *usecase) Delete(id int) <-chan model.Result {
+func (uc *usecase) Delete(organizationID, id, version int) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Delete process */
-		process := <-uc.repo.Delete(id)
+		process := <-uc.repo.Delete(organizationID, id, version)
 		if process.Error != nil {
 			result <- model.Result{Error: process.Error}
 			return
@@ -129,3 +184,31 @@ func (uc *usecase) Delete(id int) <-chan model.Result {
 	}()
 	return result
 }
+
+// Batch: size of the batch is limited so the transaction does not hold the row lock too long
+func (uc *usecase) Batch(organizationID int, request model.BatchRequest) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Validate batch size */
+		if len(request.Operations) == 0 {
+			result <- model.Result{Error: errors.New("Batch must have at least one operation")}
+			return
+		}
+		if maxSize := env.GetInt(env.EnvCrudBatchMaxSize, 100); len(request.Operations) > maxSize {
+			result <- model.Result{Error: fmt.Errorf("Batch can not have more than %d operations", maxSize)}
+			return
+		}
+
+		/* Batch process */
+		process := <-uc.repo.Batch(organizationID, request.Operations, request.ContinueOnError)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		result <- model.Result{Data: process.Data}
+
+	}()
+	return result
+}
@@ -60,7 +60,7 @@ func (r *repository) SendMailDefault(email, subject, text string) <-chan model.R
 		defer close(result)
 
 		/* Net dial */
-		conn, err := net.Dial("tcp", fmt.Sprintf("%s:%s", os.Getenv(env.EnvEmailHost), os.Getenv(env.EnvEmailPort)))
+		conn, err := net.Dial("tcp", net.JoinHostPort(os.Getenv(env.EnvEmailHost), os.Getenv(env.EnvEmailPort)))
 		if err != nil {
 			result <- model.Result{Error: err}
 			return
@@ -116,7 +116,7 @@ func (r *repository) SendMailDefault(email, subject, text string) <-chan model.R
 		}
 
 		/* Send email */
-		address := fmt.Sprintf("%s:%s", os.Getenv(env.EnvEmailHost), os.Getenv(env.EnvEmailPort))
+		address := net.JoinHostPort(os.Getenv(env.EnvEmailHost), os.Getenv(env.EnvEmailPort))
 		from := os.Getenv(env.EnvEmailUser)
 		to := []string{
 			email,
@@ -7,6 +7,7 @@ import (
 
 	"github.com/labstack/echo"
 	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"github.com/novalwardhana/golang-boilerplate/middleware/auth"
 	"github.com/novalwardhana/golang-boilerplate/module/file/model"
 	"github.com/novalwardhana/golang-boilerplate/module/file/usecase"
 )
@@ -22,12 +23,15 @@ func NewHandler(usecase usecase.Usecase) *Handler {
 }
 
 func (h *Handler) Mount(g *echo.Group) {
-	g.POST("/upload", h.upload)
-	g.GET("/download", h.download)
+	g.POST("/upload", h.upload, auth.CheckAuth())
+	g.GET("/get-data", h.getData, auth.CheckAuth())
+	g.GET("/download", h.download, auth.CheckAuth())
 }
 
 func (h *Handler) upload(c echo.Context) error {
 
+	mc := c.(auth.NewContext)
+
 	/* File validation */
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -35,23 +39,45 @@ func (h *Handler) upload(c echo.Context) error {
 	}
 
 	/* Process */
-	result := <-h.usecase.Upload(file)
+	result := <-h.usecase.Upload(mc.OrganizationID, mc.User.ID, file)
 	if result.Error != nil {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
 	}
-	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success upload new file"})
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success upload new file", Data: result.Data})
+}
+
+// GetData:
+func (h *Handler) getData(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* Process */
+	result := <-h.usecase.GetData(mc.OrganizationID)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get file data", Data: result.Data})
 }
 
 // Download:
 func (h *Handler) download(c echo.Context) error {
 
+	mc := c.(auth.NewContext)
+
 	/* filename parameter validation */
 	filename := c.QueryParam("filename")
 	if len(filename) == 0 {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Filename must filled"})
 	}
 
+	/* Get file metadata, only file of the organization can be downloaded */
+	result := <-h.usecase.GetFile(mc.OrganizationID, filename)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	file := result.Data.(model.File)
+
 	/* Download file */
 	filedir := os.Getenv(env.EnvFileDirectory)
-	return c.Attachment(filepath.Join(filedir, filename), filename)
+	return c.Attachment(filepath.Join(filedir, file.Filename), file.OriginalName)
 }
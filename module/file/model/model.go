@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type Response struct {
 	Status  int         `json:"status"`
 	Message string      `json:"message"`
@@ -10,3 +12,19 @@ type Result struct {
 	Data  interface{} `json:"data"`
 	Error error       `json:"error"`
 }
+
+// File: metadata of uploaded file, the file itself is stored in file directory
+type File struct {
+	ID             int       `json:"id" gorm:"id"`
+	OrganizationID int       `json:"organization_id" gorm:"organization_id"`
+	Filename       string    `json:"filename" gorm:"filename"`
+	OriginalName   string    `json:"original_name" gorm:"original_name"`
+	ContentType    string    `json:"content_type" gorm:"content_type"`
+	Size           int64     `json:"size" gorm:"size"`
+	UploadedBy     *int      `json:"uploaded_by" gorm:"uploaded_by"`
+	CreatedAt      time.Time `json:"created_at" gorm:"created_at"`
+}
+
+func (f *File) TableName() string {
+	return "files"
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"github.com/novalwardhana/golang-boilerplate/module/file/model"
 	"gorm.io/gorm"
 )
 
@@ -9,6 +10,9 @@ type repository struct {
 }
 
 type Repository interface {
+	Create(file *model.File) <-chan model.Result
+	GetData(organizationID int) <-chan model.Result
+	GetFile(organizationID int, filename string) <-chan model.Result
 }
 
 func NewRepository(dbMaster *gorm.DB) Repository {
@@ -16,3 +20,55 @@ func NewRepository(dbMaster *gorm.DB) Repository {
 		dbMaster: dbMaster,
 	}
 }
+
+// Create:
+func (r *repository) Create(file *model.File) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process create file */
+		if err := r.dbMaster.Create(file).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: *file}
+	}()
+	return result
+}
+
+// GetData: latest upload first
+func (r *repository) GetData(organizationID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get data */
+		files := []model.File{}
+		sql := `select * from files where organization_id = ? order by id desc`
+		if err := r.dbMaster.Raw(sql, organizationID).Scan(&files).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: files}
+	}()
+	return result
+}
+
+// GetFile: file of other organization is not found
+func (r *repository) GetFile(organizationID int, filename string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get file */
+		var file model.File
+		sql := `select * from files where filename = ? and organization_id = ?`
+		if err := r.dbMaster.Raw(sql, filename, organizationID).First(&file).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: file}
+	}()
+	return result
+}
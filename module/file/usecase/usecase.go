@@ -5,9 +5,9 @@ import (
 	"mime/multipart"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"github.com/novalwardhana/golang-boilerplate/helper/token"
 	"github.com/novalwardhana/golang-boilerplate/module/file/model"
 	"github.com/novalwardhana/golang-boilerplate/module/file/repository"
 )
@@ -17,7 +17,9 @@ type usecase struct {
 }
 
 type Usecase interface {
-	Upload(file *multipart.FileHeader) <-chan model.Result
+	Upload(organizationID, uploadedBy int, file *multipart.FileHeader) <-chan model.Result
+	GetData(organizationID int) <-chan model.Result
+	GetFile(organizationID int, filename string) <-chan model.Result
 }
 
 func NewUsecase(repo repository.Repository) Usecase {
@@ -26,8 +28,8 @@ func NewUsecase(repo repository.Repository) Usecase {
 	}
 }
 
-// Upload:
-func (u *usecase) Upload(file *multipart.FileHeader) <-chan model.Result {
+// Upload: file belong to the organization of the uploader
+func (u *usecase) Upload(organizationID, uploadedBy int, file *multipart.FileHeader) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
@@ -39,31 +41,80 @@ func (u *usecase) Upload(file *multipart.FileHeader) <-chan model.Result {
 			return
 		}
 
-		/* Create file target */
-		filename := time.Now().Format("2006_01_02_15_04_05") + "_" + file.Filename
-		fileTarget, err := os.Create(filepath.Join(filedir, filename))
-		defer fileTarget.Close()
+		/* Create file target, stored name is random so upload of other request is never overwritten */
+		id, err := token.NewID()
 		if err != nil {
 			result <- model.Result{Error: err}
 			return
 		}
+		filename := id + filepath.Ext(filepath.Base(file.Filename))
+		filePath := filepath.Join(filedir, filename)
+		fileTarget, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		defer fileTarget.Close()
 
 		/* Create file source */
 		fileSource, err := file.Open()
-		defer fileSource.Close()
 		if err != nil {
+			os.Remove(filePath)
 			result <- model.Result{Error: err}
 			return
 		}
+		defer fileSource.Close()
 
 		/* Copy file source to file target */
-		_, err = io.Copy(fileTarget, fileSource)
+		size, err := io.Copy(fileTarget, fileSource)
 		if err != nil {
+			os.Remove(filePath)
 			result <- model.Result{Error: err}
 			return
 		}
 
-		result <- model.Result{}
+		/* Create file metadata, the file can not be downloaded without it so it is removed on failure */
+		processCreate := <-u.repo.Create(&model.File{
+			OrganizationID: organizationID,
+			Filename:       filename,
+			OriginalName:   file.Filename,
+			ContentType:    file.Header.Get("Content-Type"),
+			Size:           size,
+			UploadedBy:     &uploadedBy,
+		})
+		if processCreate.Error != nil {
+			os.Remove(filePath)
+			result <- model.Result{Error: processCreate.Error}
+			return
+		}
+
+		result <- model.Result{Data: processCreate.Data}
+	}()
+	return result
+}
+
+// GetData:
+func (u *usecase) GetData(organizationID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get data process */
+		processGetData := <-u.repo.GetData(organizationID)
+		result <- processGetData
+	}()
+	return result
+}
+
+// GetFile:
+func (u *usecase) GetFile(organizationID int, filename string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get file process */
+		processGetFile := <-u.repo.GetFile(organizationID, filename)
+		result <- processGetFile
 	}()
 	return result
 }
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"errors"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -8,6 +10,7 @@ import (
 
 	"github.com/labstack/echo"
 	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"github.com/novalwardhana/golang-boilerplate/middleware/auth"
 	"github.com/novalwardhana/golang-boilerplate/module/http-client/model"
 	"github.com/novalwardhana/golang-boilerplate/module/http-client/usecase"
 )
@@ -25,6 +28,10 @@ func NewHandler(usecase usecase.Usecase) *Handler {
 func (h *Handler) Mount(group *echo.Group) {
 	group.POST("/crud/create", h.crudCreate)
 	group.GET("/crud/get-data", h.crudGetData)
+	group.GET("/crud/detail", h.crudDetail)
+	group.PUT("/crud/update/:id", h.crudUpdate)
+	group.PATCH("/crud/update/:id", h.crudPatch)
+	group.DELETE("/crud/delete/:id", h.crudDelete)
 	group.POST("/advance-crud/bulk-insert", h.advanceCrudBulkInsert)
 	group.GET("/advance-crud/download-csv", h.advanceDownloadCsv)
 }
@@ -39,7 +46,7 @@ func (h *Handler) crudCreate(c echo.Context) error {
 	}
 
 	/* Process */
-	result := <-h.usecase.Create(payload)
+	result := <-h.usecase.Create(credential(c), payload)
 	if result.Error != nil {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
 	}
@@ -50,6 +57,25 @@ func (h *Handler) crudCreate(c echo.Context) error {
 // CrudGetData:
 func (h *Handler) crudGetData(c echo.Context) error {
 
+	/* Limit parameter not valid */
+	paramLimit := c.QueryParam("limit")
+	limit, err := strconv.Atoi(paramLimit)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Limit parameter not valid"})
+	}
+	if limit <= 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Limit parameter not valid"})
+	}
+
+	/* Cursor mode of crud service, cursor is passed as is */
+	if _, ok := c.QueryParams()["cursor"]; ok {
+		result := <-h.usecase.GetDataCursor(credential(c), limit, c.QueryParam("cursor"), c.QueryParam("estimate") == "true")
+		if result.Error != nil {
+			return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: result.Error.Error()})
+		}
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get data", Data: result.Data})
+	}
+
 	/* Page parameter validation */
 	paramPage := c.QueryParam("page")
 	page, err := strconv.Atoi(paramPage)
@@ -60,23 +86,81 @@ func (h *Handler) crudGetData(c echo.Context) error {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Page parameter not valid"})
 	}
 
-	/* Limit parameter not valid */
-	paramLimit := c.QueryParam("limit")
-	limit, err := strconv.Atoi(paramLimit)
+	/* Process */
+	result := <-h.usecase.GetData(credential(c), page, limit)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get data", Data: result.Data})
+}
+
+// CrudDetail: ETag of crud service is returned so the caller can send it back as If-Match
+func (h *Handler) crudDetail(c echo.Context) error {
+
+	/* ID parameter validation */
+	id, err := strconv.Atoi(c.QueryParam("id"))
 	if err != nil {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Limit parameter not valid"})
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "ID parameter not valid"})
 	}
-	if limit <= 0 {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Limit parameter not valid"})
+
+	/* Process */
+	result := <-h.usecase.Detail(credential(c), id)
+	return proxyResponse(c, result, "Success get data")
+}
+
+// CrudUpdate:
+func (h *Handler) crudUpdate(c echo.Context) error {
+
+	/* ID parameter validation */
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "ID parameter not valid"})
+	}
+
+	/* Payload verify */
+	var payload = new(model.Person)
+	if err := c.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
 	}
 
 	/* Process */
-	result := <-h.usecase.GetData(page, limit)
-	if result.Error != nil {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: result.Error.Error()})
+	result := <-h.usecase.Update(credential(c), id, c.Request().Header.Get(headerIfMatch), payload)
+	return proxyResponse(c, result, "Success update data")
+}
+
+// CrudPatch:
+func (h *Handler) crudPatch(c echo.Context) error {
+
+	/* ID parameter validation */
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "ID parameter not valid"})
 	}
 
-	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get data", Data: result.Data})
+	/* Payload verify */
+	payload, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process */
+	result := <-h.usecase.Patch(credential(c), id, c.Request().Header.Get(headerIfMatch), c.QueryParam("fields"), payload)
+	return proxyResponse(c, result, "Success update data")
+}
+
+// CrudDelete:
+func (h *Handler) crudDelete(c echo.Context) error {
+
+	/* ID parameter validation */
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "ID parameter not valid"})
+	}
+
+	/* Process */
+	result := <-h.usecase.Delete(credential(c), id, c.Request().Header.Get(headerIfMatch))
+	return proxyResponse(c, result, "Success delete data")
 }
 
 // AdvanceCrudInsertBulk
@@ -89,7 +173,7 @@ func (h *Handler) advanceCrudBulkInsert(c echo.Context) error {
 	}
 
 	/* Process */
-	result := <-h.usecase.BulkInsert(file)
+	result := <-h.usecase.BulkInsert(credential(c), file)
 	if result.Error != nil {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
 	}
@@ -101,7 +185,7 @@ func (h *Handler) advanceCrudBulkInsert(c echo.Context) error {
 func (h *Handler) advanceDownloadCsv(c echo.Context) error {
 
 	/* process */
-	result := <-h.usecase.DownloadCSV()
+	result := <-h.usecase.DownloadCSV(credential(c))
 	if result.Error != nil {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
 	}
@@ -109,3 +193,30 @@ func (h *Handler) advanceDownloadCsv(c echo.Context) error {
 
 	return c.Attachment(filepath.Join(os.Getenv(env.EnvHTTPClientDirectory), filename), filename)
 }
+
+// credential: downstream service authorize the caller, not this service
+func credential(c echo.Context) model.Credential {
+	return model.Credential{
+		Authorization:  c.Request().Header.Get(echo.HeaderAuthorization),
+		OrganizationID: c.Request().Header.Get(auth.HeaderOrganization),
+	}
+}
+
+const headerIfMatch string = "If-Match"
+
+const headerETag string = "ETag"
+
+// proxyResponse: failed precondition keep the 412 status of crud service
+func proxyResponse(c echo.Context, result model.Result, message string) error {
+	if result.Error != nil {
+		if errors.Is(result.Error, model.ErrPreconditionFailed) {
+			return c.JSON(http.StatusPreconditionFailed, model.Response{Status: http.StatusPreconditionFailed, Message: result.Error.Error()})
+		}
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	proxyResult := result.Data.(model.ProxyResult)
+	if len(proxyResult.ETag) > 0 {
+		c.Response().Header().Set(headerETag, proxyResult.ETag)
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: message, Data: proxyResult.Data})
+}
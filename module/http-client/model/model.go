@@ -1,5 +1,9 @@
 package model
 
+import "errors"
+
+var ErrPreconditionFailed = errors.New("Data has been changed by another request")
+
 type Response struct {
 	Status  int         `json:"status"`
 	Message string      `json:"message"`
@@ -11,9 +15,22 @@ type Result struct {
 	Error error       `json:"error"`
 }
 
+// Credential: authorization of the caller forwarded to the downstream service, data is scoped by its organization
+type Credential struct {
+	Authorization  string
+	OrganizationID string
+}
+
 type Person struct {
 	ID      int    `json:"id"`
 	Name    string `json:"name"`
 	Age     int    `json:"age"`
 	Address string `json:"address"`
+	Version int    `json:"version"`
+}
+
+// ProxyResult: data of downstream response with its ETag
+type ProxyResult struct {
+	ETag string
+	Data interface{}
 }
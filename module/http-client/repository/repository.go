@@ -12,9 +12,11 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"github.com/novalwardhana/golang-boilerplate/middleware/auth"
 	"github.com/novalwardhana/golang-boilerplate/module/http-client/model"
 )
 
@@ -22,10 +24,15 @@ type repository struct {
 }
 
 type Repository interface {
-	Create(payload *model.Person) <-chan model.Result
-	GetData(page, limit int) <-chan model.Result
-	BulkInsert(filedir, filename string) <-chan model.Result
-	DownloadCSV() <-chan model.Result
+	Create(credential model.Credential, payload *model.Person) <-chan model.Result
+	GetData(credential model.Credential, page, limit int) <-chan model.Result
+	GetDataCursor(credential model.Credential, limit int, cursor string, estimate bool) <-chan model.Result
+	BulkInsert(credential model.Credential, filedir, filename string) <-chan model.Result
+	DownloadCSV(credential model.Credential) <-chan model.Result
+	Detail(credential model.Credential, id int) <-chan model.Result
+	Update(credential model.Credential, id int, ifMatch string, payload *model.Person) <-chan model.Result
+	Patch(credential model.Credential, id int, ifMatch, fields string, payload []byte) <-chan model.Result
+	Delete(credential model.Credential, id int, ifMatch string) <-chan model.Result
 }
 
 func NewRepository() Repository {
@@ -33,7 +40,7 @@ func NewRepository() Repository {
 }
 
 // CrudCreate:
-func (r *repository) Create(payload *model.Person) <-chan model.Result {
+func (r *repository) Create(credential model.Credential, payload *model.Person) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
@@ -53,6 +60,7 @@ func (r *repository) Create(payload *model.Person) <-chan model.Result {
 		/* Prepare http request */
 		httpHeader := http.Header{}
 		httpHeader.Add("Content-Type", "application/json")
+		setCredential(httpHeader, credential)
 		httpRequest := http.Request{}
 		httpRequest.Header = httpHeader
 		httpRequest.URL, _ = url.Parse(fmt.Sprintf("%s/%s/%s", os.Getenv(env.EnvHTTPClientURL), "crud", "create"))
@@ -94,7 +102,25 @@ func (r *repository) Create(payload *model.Person) <-chan model.Result {
 }
 
 // GetData:
-func (r *repository) GetData(page, limit int) <-chan model.Result {
+func (r *repository) GetData(credential model.Credential, page, limit int) <-chan model.Result {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("limit", strconv.Itoa(limit))
+	return r.getData(credential, query)
+}
+
+// GetDataCursor: empty cursor read the first page of crud cursor mode
+func (r *repository) GetDataCursor(credential model.Credential, limit int, cursor string, estimate bool) <-chan model.Result {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("cursor", cursor)
+	if estimate {
+		query.Set("estimate", "true")
+	}
+	return r.getData(credential, query)
+}
+
+func (r *repository) getData(credential model.Credential, query url.Values) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
@@ -107,9 +133,10 @@ func (r *repository) GetData(page, limit int) <-chan model.Result {
 		/* Prepare http request */
 		httpHeader := http.Header{}
 		httpHeader.Add("Content-Type", "application/json")
+		setCredential(httpHeader, credential)
 		httpRequest := http.Request{}
 		httpRequest.Header = httpHeader
-		httpRequest.URL, _ = url.Parse(fmt.Sprintf("%s/%s/%s?page=%d&limit=%d", os.Getenv(env.EnvHTTPClientURL), "crud", "get-data", page, limit))
+		httpRequest.URL, _ = url.Parse(fmt.Sprintf("%s/%s/%s?%s", os.Getenv(env.EnvHTTPClientURL), "crud", "get-data", query.Encode()))
 		httpRequest.Method = "GET"
 		httpRequest.Body = nil
 
@@ -148,7 +175,7 @@ func (r *repository) GetData(page, limit int) <-chan model.Result {
 }
 
 // BulkInsert:
-func (r *repository) BulkInsert(filedir, filename string) <-chan model.Result {
+func (r *repository) BulkInsert(credential model.Credential, filedir, filename string) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
@@ -169,6 +196,7 @@ func (r *repository) BulkInsert(filedir, filename string) <-chan model.Result {
 		/* Prepare http headers */
 		httpHeader := http.Header{}
 		httpHeader.Add("Content-Type", "application/json")
+		setCredential(httpHeader, credential)
 		httpRequest := http.Request{}
 		httpRequest.Header = httpHeader
 		httpRequest.URL, _ = url.Parse(fmt.Sprintf("%s/%s/%s", os.Getenv(env.EnvHTTPClientURL), "advance-crud", "bulk-insert"))
@@ -220,7 +248,7 @@ func (r *repository) BulkInsert(filedir, filename string) <-chan model.Result {
 }
 
 // ExportCSV:
-func (r *repository) DownloadCSV() <-chan model.Result {
+func (r *repository) DownloadCSV(credential model.Credential) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
@@ -235,6 +263,7 @@ func (r *repository) DownloadCSV() <-chan model.Result {
 		//httpHeader.Add("Content-Type", "application/json")
 
 		/* http request */
+		setCredential(httpHeader, credential)
 		httpRequest := http.Request{}
 		httpRequest.Header = httpHeader
 		httpRequest.URL, _ = url.Parse(fmt.Sprintf("%s/%s/%s", os.Getenv(env.EnvHTTPClientURL), "advance-crud", "download-csv"))
@@ -263,3 +292,156 @@ func (r *repository) DownloadCSV() <-chan model.Result {
 	}()
 	return result
 }
+
+// setCredential:
+func setCredential(httpHeader http.Header, credential model.Credential) {
+	if len(credential.Authorization) > 0 {
+		httpHeader.Set("Authorization", credential.Authorization)
+	}
+	if len(credential.OrganizationID) > 0 {
+		httpHeader.Set(auth.HeaderOrganization, credential.OrganizationID)
+	}
+}
+
+// Detail:
+func (r *repository) Detail(credential model.Credential, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process */
+		path := fmt.Sprintf("crud/detail?id=%d", id)
+		proxyResult, err := crudRequest(http.MethodGet, path, credential, "", nil)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		result <- model.Result{Data: proxyResult}
+	}()
+	return result
+}
+
+// Update:
+func (r *repository) Update(credential model.Credential, id int, ifMatch string, payload *model.Person) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Prepare payload to byte */
+		payloadByte, err := json.Marshal(payload)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process */
+		path := fmt.Sprintf("crud/update/%d", id)
+		proxyResult, err := crudRequest(http.MethodPut, path, credential, ifMatch, payloadByte)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		result <- model.Result{Data: proxyResult}
+	}()
+	return result
+}
+
+// Patch: payload is forwarded as is, it is validated by crud service
+func (r *repository) Patch(credential model.Credential, id int, ifMatch, fields string, payload []byte) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process */
+		path := fmt.Sprintf("crud/update/%d", id)
+		if len(fields) > 0 {
+			path += "?fields=" + url.QueryEscape(fields)
+		}
+		proxyResult, err := crudRequest(http.MethodPatch, path, credential, ifMatch, payload)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		result <- model.Result{Data: proxyResult}
+	}()
+	return result
+}
+
+// Delete:
+func (r *repository) Delete(credential model.Credential, id int, ifMatch string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process */
+		path := fmt.Sprintf("crud/delete/%d", id)
+		proxyResult, err := crudRequest(http.MethodDelete, path, credential, ifMatch, nil)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		result <- model.Result{Data: proxyResult}
+	}()
+	return result
+}
+
+// crudRequest: If-Match is passed through and ETag of the response is returned, failed precondition of crud service is ErrPreconditionFailed
+func crudRequest(method, path string, credential model.Credential, ifMatch string, payload []byte) (model.ProxyResult, error) {
+	var proxyResult model.ProxyResult
+
+	/* Prepare http client */
+	httpClient := http.Client{
+		Timeout: 50 * time.Second,
+	}
+
+	/* Prepare http request */
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewBuffer(payload)
+	}
+	httpRequest, err := http.NewRequest(method, fmt.Sprintf("%s/%s", os.Getenv(env.EnvHTTPClientURL), path), body)
+	if err != nil {
+		return proxyResult, err
+	}
+	httpRequest.Header.Add("Content-Type", "application/json")
+	setCredential(httpRequest.Header, credential)
+	if len(ifMatch) > 0 {
+		httpRequest.Header.Set("If-Match", ifMatch)
+	}
+
+	/* Process */
+	httpResponse, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return proxyResult, err
+	}
+	defer httpResponse.Body.Close()
+
+	/* Check response */
+	if httpResponse.StatusCode == http.StatusPreconditionFailed {
+		return proxyResult, model.ErrPreconditionFailed
+	}
+	if httpResponse.StatusCode != 200 {
+		return proxyResult, fmt.Errorf("Failed process %s %s", method, path)
+	}
+	httpResponseBody, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return proxyResult, err
+	}
+
+	/* Check response body */
+	var response = new(model.Response)
+	if err := json.Unmarshal(httpResponseBody, response); err != nil {
+		return proxyResult, err
+	}
+	if response.Status != 200 {
+		return proxyResult, errors.New(response.Message)
+	}
+
+	proxyResult.ETag = httpResponse.Header.Get("ETag")
+	proxyResult.Data = response.Data
+	return proxyResult, nil
+}
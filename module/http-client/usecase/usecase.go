@@ -18,10 +18,15 @@ type usecase struct {
 }
 
 type Usecase interface {
-	Create(payload *model.Person) <-chan model.Result
-	GetData(page, limit int) <-chan model.Result
-	BulkInsert(file *multipart.FileHeader) <-chan model.Result
-	DownloadCSV() <-chan model.Result
+	Create(credential model.Credential, payload *model.Person) <-chan model.Result
+	GetData(credential model.Credential, page, limit int) <-chan model.Result
+	GetDataCursor(credential model.Credential, limit int, cursor string, estimate bool) <-chan model.Result
+	BulkInsert(credential model.Credential, file *multipart.FileHeader) <-chan model.Result
+	DownloadCSV(credential model.Credential) <-chan model.Result
+	Detail(credential model.Credential, id int) <-chan model.Result
+	Update(credential model.Credential, id int, ifMatch string, payload *model.Person) <-chan model.Result
+	Patch(credential model.Credential, id int, ifMatch, fields string, payload []byte) <-chan model.Result
+	Delete(credential model.Credential, id int, ifMatch string) <-chan model.Result
 }
 
 func NewUsecase(repo repository.Repository) Usecase {
@@ -31,13 +36,13 @@ func NewUsecase(repo repository.Repository) Usecase {
 }
 
 // CrudCreate:
-func (u *usecase) Create(payload *model.Person) <-chan model.Result {
+func (u *usecase) Create(credential model.Credential, payload *model.Person) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Process create */
-		processCrudCreate := <-u.repo.Create(payload)
+		processCrudCreate := <-u.repo.Create(credential, payload)
 		if processCrudCreate.Error != nil {
 			result <- model.Result{Error: processCrudCreate.Error}
 			return
@@ -49,13 +54,31 @@ func (u *usecase) Create(payload *model.Person) <-chan model.Result {
 }
 
 // GetData
-func (u *usecase) GetData(page, limit int) <-chan model.Result {
+func (u *usecase) GetData(credential model.Credential, page, limit int) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Process get data */
-		processGetData := <-u.repo.GetData(page, limit)
+		processGetData := <-u.repo.GetData(credential, page, limit)
+		if processGetData.Error != nil {
+			result <- model.Result{Error: processGetData.Error}
+			return
+		}
+
+		result <- model.Result{Data: processGetData.Data}
+	}()
+	return result
+}
+
+// GetDataCursor
+func (u *usecase) GetDataCursor(credential model.Credential, limit int, cursor string, estimate bool) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get data */
+		processGetData := <-u.repo.GetDataCursor(credential, limit, cursor, estimate)
 		if processGetData.Error != nil {
 			result <- model.Result{Error: processGetData.Error}
 			return
@@ -67,7 +90,7 @@ func (u *usecase) GetData(page, limit int) <-chan model.Result {
 }
 
 // BulkInsert:
-func (u *usecase) BulkInsert(file *multipart.FileHeader) <-chan model.Result {
+func (u *usecase) BulkInsert(credential model.Credential, file *multipart.FileHeader) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
@@ -103,7 +126,7 @@ func (u *usecase) BulkInsert(file *multipart.FileHeader) <-chan model.Result {
 		}
 
 		/* Process bulk insert */
-		processBulkInsert := <-u.repo.BulkInsert(filedir, filename)
+		processBulkInsert := <-u.repo.BulkInsert(credential, filedir, filename)
 		if processBulkInsert.Error != nil {
 			result <- model.Result{Error: processBulkInsert.Error}
 			return
@@ -115,13 +138,13 @@ func (u *usecase) BulkInsert(file *multipart.FileHeader) <-chan model.Result {
 }
 
 // ExportCSV:
-func (u *usecase) DownloadCSV() <-chan model.Result {
+func (u *usecase) DownloadCSV(credential model.Credential) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Process export csv */
-		processDownloadCSV := <-u.repo.DownloadCSV()
+		processDownloadCSV := <-u.repo.DownloadCSV(credential)
 		if processDownloadCSV.Error != nil {
 			result <- model.Result{Error: processDownloadCSV.Error}
 			return
@@ -140,3 +163,55 @@ func (u *usecase) DownloadCSV() <-chan model.Result {
 	}()
 	return result
 }
+
+// Detail:
+func (u *usecase) Detail(credential model.Credential, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process detail */
+		processDetail := <-u.repo.Detail(credential, id)
+		result <- processDetail
+	}()
+	return result
+}
+
+// Update: if match is the precondition of the caller, empty when the caller does not send it
+func (u *usecase) Update(credential model.Credential, id int, ifMatch string, payload *model.Person) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process update */
+		processUpdate := <-u.repo.Update(credential, id, ifMatch, payload)
+		result <- processUpdate
+	}()
+	return result
+}
+
+// Patch:
+func (u *usecase) Patch(credential model.Credential, id int, ifMatch, fields string, payload []byte) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process patch */
+		processPatch := <-u.repo.Patch(credential, id, ifMatch, fields, payload)
+		result <- processPatch
+	}()
+	return result
+}
+
+// Delete:
+func (u *usecase) Delete(credential model.Credential, id int, ifMatch string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process delete */
+		processDelete := <-u.repo.Delete(credential, id, ifMatch)
+		result <- processDelete
+	}()
+	return result
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/novalwardhana/golang-boilerplate/middleware/auth"
+	"github.com/novalwardhana/golang-boilerplate/module/organization-management/model"
+	"github.com/novalwardhana/golang-boilerplate/module/organization-management/usecase"
+)
+
+type Handler struct {
+	usecase usecase.Usecase
+}
+
+func NewHandler(usecase usecase.Usecase) *Handler {
+	return &Handler{
+		usecase: usecase,
+	}
+}
+
+// Mount: organization permissions is only held by root
+func (h *Handler) Mount(group *echo.Group) {
+	group.POST("/create", h.Create, auth.CheckAuth(), auth.Require("organizations:write"), auth.RefuseImpersonation())
+	group.GET("/get-data", h.GetData, auth.CheckAuth(), auth.Require("organizations:read"))
+	group.GET("/detail/:id", h.Detail, auth.CheckAuth(), auth.Require("organizations:read"))
+	group.PUT("/update/:id", h.Update, auth.CheckAuth(), auth.Require("organizations:write"), auth.RefuseImpersonation())
+	group.GET("/members/:id", h.GetMembers, auth.CheckAuth(), auth.Require("organizations:read", "users:read"))
+	group.POST("/members/:id", h.AddMember, auth.CheckAuth(), auth.Require("organizations:write"), auth.RefuseImpersonation())
+	group.DELETE("/members/:id/:user_id", h.RemoveMember, auth.CheckAuth(), auth.Require("organizations:write"), auth.RefuseImpersonation())
+}
+
+// Create:
+func (h *Handler) Create(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* Payload validation */
+	payload := new(model.Organization)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.Code) == 0 || len(payload.Name) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Code and name must be filled"})
+	}
+
+	/* Process create organization */
+	result := <-h.usecase.Create(payload)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success add new organization", Data: result.Data})
+}
+
+// GetData:
+func (h *Handler) GetData(c echo.Context) error {
+
+	/* Process get data */
+	result := <-h.usecase.GetData()
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get organization data", Data: result.Data})
+}
+
+// Detail:
+func (h *Handler) Detail(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process get detail */
+	result := <-h.usecase.Detail(id)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get organization detail", Data: result.Data})
+}
+
+// Update:
+func (h *Handler) Update(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Payload validation */
+	payload := new(model.Organization)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.Code) == 0 || len(payload.Name) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Code and name must be filled"})
+	}
+	payload.ID = id
+
+	/* Process update organization */
+	result := <-h.usecase.Update(payload)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success update organization", Data: result.Data})
+}
+
+// GetMembers:
+func (h *Handler) GetMembers(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Page parameter validation */
+	paramPage := mc.QueryParam("page")
+	page, err := strconv.Atoi(paramPage)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Limit parameter validation */
+	paramLimit := mc.QueryParam("limit")
+	limit, err := strconv.Atoi(paramLimit)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if page < 1 || limit < 1 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Page and limit must be greater than 0"})
+	}
+
+	/* Process get members */
+	result := <-h.usecase.GetMembers(id, page, limit)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get organization members", Data: result.Data})
+}
+
+// AddMember:
+func (h *Handler) AddMember(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Payload validation */
+	payload := new(model.MemberRequest)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if payload.UserID == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "User id must be filled"})
+	}
+
+	/* Process add member */
+	result := <-h.usecase.AddMember(id, payload.UserID)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success add organization member"})
+}
+
+// RemoveMember:
+func (h *Handler) RemoveMember(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	id, err := strconv.Atoi(mc.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	userID, err := strconv.Atoi(mc.Param("user_id"))
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process remove member */
+	result := <-h.usecase.RemoveMember(id, userID)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success remove organization member"})
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+type Result struct {
+	Data  interface{} `json:"data"`
+	Error error       `json:"error"`
+}
+
+type Response struct {
+	Status  int         `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// OrganizationDefault: organization joined by provisioned user, its code can not be changed
+const OrganizationDefault string = "default"
+
+var ErrOrganizationNotFound = errors.New("Organization not found")
+
+type Organization struct {
+	ID        int       `json:"id" gorm:"id"`
+	Code      string    `json:"code" gorm:"code"`
+	Name      string    `json:"name" gorm:"name"`
+	CreatedAt time.Time `json:"created_at" gorm:"created_at"`
+}
+
+func (o *Organization) TableName() string {
+	return "organizations"
+}
+
+type OrganizationWithTotal struct {
+	ID        int       `json:"id" gorm:"id"`
+	Code      string    `json:"code" gorm:"code"`
+	Name      string    `json:"name" gorm:"name"`
+	TotalUser int       `json:"total_user" gorm:"total_user"`
+	CreatedAt time.Time `json:"created_at" gorm:"created_at"`
+}
+
+type MemberRequest struct {
+	UserID int `json:"user_id"`
+}
+
+type Member struct {
+	ID       int       `json:"id" gorm:"id"`
+	Name     string    `json:"name" gorm:"name"`
+	Email    string    `json:"email" gorm:"email"`
+	JoinedAt time.Time `json:"joined_at" gorm:"joined_at"`
+}
+
+type Pagination struct {
+	Page         int      `json:"page"`
+	Limit        int      `json:"limit"`
+	TotalData    int      `json:"total_data"`
+	NumberOfPage int      `json:"number_of_page"`
+	Data         []Member `json:"data"`
+}
@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/novalwardhana/golang-boilerplate/module/organization-management/model"
+	"gorm.io/gorm"
+)
+
+type repository struct {
+	dbMaster *gorm.DB
+}
+
+type Repository interface {
+	Create(organization *model.Organization) <-chan model.Result
+	GetData() <-chan model.Result
+	GetOrganization(id int) <-chan model.Result
+	Update(organization *model.Organization) <-chan model.Result
+	CountMembers(id int) <-chan model.Result
+	GetMembers(id, page, limit int) <-chan model.Result
+	AddMember(id, userID int) <-chan model.Result
+	RemoveMember(id, userID int) <-chan model.Result
+}
+
+func NewRepository(dbMaster *gorm.DB) Repository {
+	return &repository{
+		dbMaster: dbMaster,
+	}
+}
+
+const organizationWithTotalSQL string = `select
+		o.id,
+		o.code,
+		o.name,
+		o.created_at,
+		(select count(1) from organization_users ou inner join users u on u.id = ou.user_id
+			where ou.organization_id = o.id and u.deleted_at is null) as total_user
+	from organizations o`
+
+// Create:
+func (r *repository) Create(organization *model.Organization) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process create organization */
+		if err := r.dbMaster.Create(organization).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: *organization}
+
+	}()
+	return result
+}
+
+// GetData:
+func (r *repository) GetData() <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get data */
+		list := []model.OrganizationWithTotal{}
+		sql := organizationWithTotalSQL + ` order by o.id asc`
+		if err := r.dbMaster.Raw(sql).Scan(&list).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: list}
+
+	}()
+	return result
+}
+
+// GetOrganization:
+func (r *repository) GetOrganization(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get organization */
+		var organization model.OrganizationWithTotal
+		sql := organizationWithTotalSQL + ` where o.id = ?`
+		if err := r.dbMaster.Raw(sql, id).Scan(&organization).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		if organization.ID == 0 {
+			result <- model.Result{Error: model.ErrOrganizationNotFound}
+			return
+		}
+		result <- model.Result{Data: organization}
+
+	}()
+	return result
+}
+
+// Update:
+func (r *repository) Update(organization *model.Organization) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process update organization */
+		sql := `update organizations set code = ?, name = ? where id = ?`
+		process := r.dbMaster.Exec(sql, organization.Code, organization.Name, organization.ID)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: model.ErrOrganizationNotFound}
+			return
+		}
+		result <- model.Result{Data: *organization}
+
+	}()
+	return result
+}
+
+// CountMembers:
+func (r *repository) CountMembers(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process count members */
+		var count int64
+		sql := `select count(1)
+			from organization_users ou
+			inner join users u on u.id = ou.user_id
+			where ou.organization_id = ? and u.deleted_at is null`
+		if err := r.dbMaster.Raw(sql, id).Scan(&count).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: count}
+
+	}()
+	return result
+}
+
+// GetMembers:
+func (r *repository) GetMembers(id, page, limit int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get members */
+		members := []model.Member{}
+		offset := (page - 1) * limit
+		sql := `select u.id, u.name, u.email, ou.created_at as joined_at
+			from organization_users ou
+			inner join users u on u.id = ou.user_id
+			where ou.organization_id = ? and u.deleted_at is null
+			order by ou.created_at desc, u.id desc
+			offset ? limit ?`
+		if err := r.dbMaster.Raw(sql, id, offset, limit).Scan(&members).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: members}
+
+	}()
+	return result
+}
+
+// AddMember:
+func (r *repository) AddMember(id, userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* User check */
+		var exists bool
+		sql := `select exists(select 1 from users where id = ? and deleted_at is null)`
+		if err := r.dbMaster.Raw(sql, userID).Scan(&exists).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		if !exists {
+			result <- model.Result{Error: errors.New("User not found")}
+			return
+		}
+
+		/* Process add member */
+		sql = `insert into organization_users (organization_id, user_id) values (?, ?) on conflict do nothing`
+		process := r.dbMaster.Exec(sql, id, userID)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: errors.New("User already member of the organization")}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// RemoveMember: user must stay in at least one organization to login, access token carry the organization so it is revoked.
+// Session of the organization fallback to the default organization of the user on refresh
+func (r *repository) RemoveMember(id, userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Lock memberships of the user */
+		tx := r.dbMaster.Begin()
+		var organizationIDs []int
+		sql := `select organization_id from organization_users where user_id = ? for update`
+		if err := tx.Raw(sql, userID).Scan(&organizationIDs).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		isMember := false
+		for _, organizationID := range organizationIDs {
+			if organizationID == id {
+				isMember = true
+			}
+		}
+		if !isMember {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("User not member of the organization")}
+			return
+		}
+		if len(organizationIDs) == 1 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("User must belong to at least one organization")}
+			return
+		}
+
+		/* Process remove member */
+		sql = `delete from organization_users where organization_id = ? and user_id = ?`
+		if err := tx.Exec(sql, id, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Revoke access tokens of the user */
+		sql = `insert into user_token_revocations (user_id, revoked_at) values (?, now())
+			on conflict (user_id) do update set revoked_at = excluded.revoked_at`
+		if err := tx.Exec(sql, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
@@ -0,0 +1,190 @@
+package usecase
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/novalwardhana/golang-boilerplate/module/organization-management/model"
+	"github.com/novalwardhana/golang-boilerplate/module/organization-management/repository"
+)
+
+type usecase struct {
+	repo repository.Repository
+}
+
+type Usecase interface {
+	Create(organization *model.Organization) <-chan model.Result
+	GetData() <-chan model.Result
+	Detail(id int) <-chan model.Result
+	Update(organization *model.Organization) <-chan model.Result
+	GetMembers(id, page, limit int) <-chan model.Result
+	AddMember(id, userID int) <-chan model.Result
+	RemoveMember(id, userID int) <-chan model.Result
+}
+
+func NewUsecase(repo repository.Repository) Usecase {
+	return &usecase{
+		repo: repo,
+	}
+}
+
+// Create:
+func (u *usecase) Create(organization *model.Organization) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Create organization process */
+		organization.ID = 0
+		organization.Code = strings.TrimSpace(organization.Code)
+		processCreate := <-u.repo.Create(organization)
+		if processCreate.Error != nil {
+			result <- model.Result{Error: processCreate.Error}
+			return
+		}
+
+		/* Get organization process */
+		processGetOrganization := <-u.repo.GetOrganization(organization.ID)
+		result <- processGetOrganization
+
+	}()
+	return result
+}
+
+// GetData:
+func (u *usecase) GetData() <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get data process */
+		processGetData := <-u.repo.GetData()
+		result <- processGetData
+
+	}()
+	return result
+}
+
+// Detail:
+func (u *usecase) Detail(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get organization process */
+		processGetOrganization := <-u.repo.GetOrganization(id)
+		result <- processGetOrganization
+
+	}()
+	return result
+}
+
+// Update: code of default organization can not be changed, other organization can not take it
+func (u *usecase) Update(organization *model.Organization) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get current organization process */
+		processGetOrganization := <-u.repo.GetOrganization(organization.ID)
+		if processGetOrganization.Error != nil {
+			result <- model.Result{Error: processGetOrganization.Error}
+			return
+		}
+		currentOrganization := processGetOrganization.Data.(model.OrganizationWithTotal)
+		organization.Code = strings.TrimSpace(organization.Code)
+		if (currentOrganization.Code == model.OrganizationDefault || organization.Code == model.OrganizationDefault) && currentOrganization.Code != organization.Code {
+			result <- model.Result{Error: errors.New("Code of default organization can not be changed")}
+			return
+		}
+
+		/* Update organization process */
+		processUpdate := <-u.repo.Update(organization)
+		if processUpdate.Error != nil {
+			result <- model.Result{Error: processUpdate.Error}
+			return
+		}
+
+		/* Get organization process */
+		processGetOrganization = <-u.repo.GetOrganization(organization.ID)
+		result <- processGetOrganization
+
+	}()
+	return result
+}
+
+// GetMembers:
+func (u *usecase) GetMembers(id, page, limit int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get organization process */
+		processGetOrganization := <-u.repo.GetOrganization(id)
+		if processGetOrganization.Error != nil {
+			result <- model.Result{Error: processGetOrganization.Error}
+			return
+		}
+
+		/* Count members process */
+		processCountMembers := <-u.repo.CountMembers(id)
+		if processCountMembers.Error != nil {
+			result <- model.Result{Error: processCountMembers.Error}
+			return
+		}
+		totalData := int(processCountMembers.Data.(int64))
+		numberOfPage := int(math.Ceil(float64(totalData) / float64(limit)))
+
+		/* Get members process */
+		processGetMembers := <-u.repo.GetMembers(id, page, limit)
+		if processGetMembers.Error != nil {
+			result <- model.Result{Error: processGetMembers.Error}
+			return
+		}
+		result <- model.Result{Data: model.Pagination{
+			Page:         page,
+			Limit:        limit,
+			TotalData:    totalData,
+			NumberOfPage: numberOfPage,
+			Data:         processGetMembers.Data.([]model.Member),
+		}}
+
+	}()
+	return result
+}
+
+// AddMember:
+func (u *usecase) AddMember(id, userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get organization process */
+		processGetOrganization := <-u.repo.GetOrganization(id)
+		if processGetOrganization.Error != nil {
+			result <- model.Result{Error: processGetOrganization.Error}
+			return
+		}
+
+		/* Add member process */
+		processAddMember := <-u.repo.AddMember(id, userID)
+		result <- processAddMember
+
+	}()
+	return result
+}
+
+// RemoveMember:
+func (u *usecase) RemoveMember(id, userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Remove member process */
+		processRemoveMember := <-u.repo.RemoveMember(id, userID)
+		result <- processRemoveMember
+
+	}()
+	return result
+}
@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/novalwardhana/golang-boilerplate/middleware/auth"
+	"github.com/novalwardhana/golang-boilerplate/module/role-management/model"
+	"github.com/novalwardhana/golang-boilerplate/module/role-management/usecase"
+)
+
+type Handler struct {
+	usecase usecase.Usecase
+}
+
+func NewHandler(usecase usecase.Usecase) *Handler {
+	return &Handler{
+		usecase: usecase,
+	}
+}
+
+func (h *Handler) Mount(group *echo.Group) {
+	group.POST("/create", h.Create, auth.CheckAuth(), auth.Require("roles:write"), auth.RefuseImpersonation())
+	group.GET("/get-data", h.GetData, auth.CheckAuth(), auth.Require("roles:read"))
+	group.GET("/detail/:id", h.Detail, auth.CheckAuth(), auth.Require("roles:read"))
+	group.PUT("/update/:id", h.Update, auth.CheckAuth(), auth.Require("roles:write"), auth.RefuseImpersonation())
+	group.DELETE("/delete/:id", h.Delete, auth.CheckAuth(), auth.Require("roles:write"), auth.RefuseImpersonation())
+	group.PUT("/permissions/:id", h.SetPermissions, auth.CheckAuth(), auth.Require("roles:write"), auth.RefuseImpersonation())
+	group.GET("/permissions", h.GetPermissions, auth.CheckAuth(), auth.Require("roles:read"))
+	group.GET("/users/:id", h.GetUsers, auth.CheckAuth(), auth.Require("roles:read", "users:read"))
+}
+
+// Create:
+func (h *Handler) Create(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* Payload validation */
+	payload := new(model.NewRole)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.Code) == 0 || len(payload.Name) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Code and name must be filled"})
+	}
+
+	/* Process create role */
+	result := <-h.usecase.Create(payload)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success add new role", Data: result.Data})
+}
+
+// GetData:
+func (h *Handler) GetData(c echo.Context) error {
+
+	/* Process get data */
+	result := <-h.usecase.GetData()
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get role data", Data: result.Data})
+}
+
+// Detail:
+func (h *Handler) Detail(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process get detail */
+	result := <-h.usecase.Detail(id)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get role detail", Data: result.Data})
+}
+
+// Update:
+func (h *Handler) Update(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Payload validation */
+	payload := new(model.Role)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.Code) == 0 || len(payload.Name) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Code and name must be filled"})
+	}
+	payload.ID = id
+
+	/* Process update role */
+	result := <-h.usecase.Update(payload)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success update role", Data: result.Data})
+}
+
+// Delete:
+func (h *Handler) Delete(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process delete role */
+	result := <-h.usecase.Delete(id)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success delete role"})
+}
+
+// SetPermissions:
+func (h *Handler) SetPermissions(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Payload validation */
+	payload := new(model.PermissionRequest)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process set permissions */
+	result := <-h.usecase.SetPermissions(id, payload.Permissions)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success assign role permissions", Data: result.Data})
+}
+
+// GetPermissions:
+func (h *Handler) GetPermissions(c echo.Context) error {
+
+	/* Process get permissions */
+	result := <-h.usecase.GetPermissions()
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get permissions", Data: result.Data})
+}
+
+// GetUsers:
+func (h *Handler) GetUsers(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Page parameter validation */
+	paramPage := mc.QueryParam("page")
+	page, err := strconv.Atoi(paramPage)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Limit parameter validation */
+	paramLimit := mc.QueryParam("limit")
+	limit, err := strconv.Atoi(paramLimit)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if page < 1 || limit < 1 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Page and limit must be greater than 0"})
+	}
+
+	/* Process get users */
+	result := <-h.usecase.GetUsers(mc.OrganizationID, id, page, limit)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get role users", Data: result.Data})
+}
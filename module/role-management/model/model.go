@@ -0,0 +1,68 @@
+package model
+
+import "errors"
+
+type Result struct {
+	Data  interface{} `json:"data"`
+	Error error       `json:"error"`
+}
+
+type Response struct {
+	Status  int         `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+const RoleRoot string = "root"
+
+var ErrRoleNotFound = errors.New("Role not found")
+
+type Role struct {
+	ID          int    `json:"id" gorm:"id"`
+	Code        string `json:"code" gorm:"code"`
+	Name        string `json:"name" gorm:"name"`
+	MFARequired bool   `json:"mfa_required" gorm:"mfa_required"`
+}
+
+func (r *Role) TableName() string {
+	return "roles"
+}
+
+type Permission struct {
+	ID   int    `json:"id" gorm:"id"`
+	Code string `json:"code" gorm:"code"`
+	Name string `json:"name" gorm:"name"`
+}
+
+type RoleWithPermissions struct {
+	ID              int      `json:"id" gorm:"id"`
+	Code            string   `json:"code" gorm:"code"`
+	Name            string   `json:"name" gorm:"name"`
+	MFARequired     bool     `json:"mfa_required" gorm:"mfa_required"`
+	TotalUser       int      `json:"total_user" gorm:"total_user"`
+	Permissions     string   `json:"-" gorm:"permissions"`
+	JsonPermissions []string `json:"permissions" gorm:"-"`
+}
+
+type NewRole struct {
+	Role
+	Permissions []string `json:"permissions"`
+}
+
+type PermissionRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+type User struct {
+	ID    int    `json:"id" gorm:"id"`
+	Name  string `json:"name" gorm:"name"`
+	Email string `json:"email" gorm:"email"`
+}
+
+type Pagination struct {
+	Page         int    `json:"page"`
+	Limit        int    `json:"limit"`
+	TotalData    int    `json:"total_data"`
+	NumberOfPage int    `json:"number_of_page"`
+	Data         []User `json:"data"`
+}
@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/novalwardhana/golang-boilerplate/module/role-management/model"
+	"gorm.io/gorm"
+)
+
+type repository struct {
+	dbMaster *gorm.DB
+}
+
+type Repository interface {
+	Create(role *model.Role, permissions []string) <-chan model.Result
+	GetData() <-chan model.Result
+	GetRole(id int) <-chan model.Result
+	Update(role *model.Role) <-chan model.Result
+	Delete(id int) <-chan model.Result
+	SetPermissions(id int, permissions []string) <-chan model.Result
+	GetPermissions() <-chan model.Result
+	CountUsers(organizationID, id int) <-chan model.Result
+	GetUsers(organizationID, id, page, limit int) <-chan model.Result
+}
+
+func NewRepository(dbMaster *gorm.DB) Repository {
+	return &repository{
+		dbMaster: dbMaster,
+	}
+}
+
+const roleWithPermissionsSQL string = `select
+		r.id,
+		r.code,
+		r.name,
+		r.mfa_required,
+		(select count(1) from user_has_roles uhr where uhr.role_id = r.id) as total_user,
+		coalesce((
+			select string_agg(p.code, ',' order by p.code)
+			from role_has_permissions rhp
+			inner join permissions p on p.id = rhp.permission_id
+			where rhp.role_id = r.id
+		), '') as permissions
+	from roles r`
+
+// Create:
+func (r *repository) Create(role *model.Role, permissions []string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process create role */
+		tx := r.dbMaster.Begin()
+		if err := tx.Create(role).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process assign permissions */
+		if err := assignPermissions(tx, role.ID, permissions); err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: *role}
+
+	}()
+	return result
+}
+
+// GetData:
+func (r *repository) GetData() <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get data */
+		var list []model.RoleWithPermissions
+		sql := roleWithPermissionsSQL + ` order by r.id asc`
+		if err := r.dbMaster.Raw(sql).Scan(&list).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		for index := range list {
+			list[index].JsonPermissions = splitPermissions(list[index].Permissions)
+		}
+		result <- model.Result{Data: list}
+
+	}()
+	return result
+}
+
+// GetRole:
+func (r *repository) GetRole(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get role */
+		var role model.RoleWithPermissions
+		sql := roleWithPermissionsSQL + ` where r.id = ?`
+		if err := r.dbMaster.Raw(sql, id).Scan(&role).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		if role.ID == 0 {
+			result <- model.Result{Error: model.ErrRoleNotFound}
+			return
+		}
+		role.JsonPermissions = splitPermissions(role.Permissions)
+		result <- model.Result{Data: role}
+
+	}()
+	return result
+}
+
+// Update:
+func (r *repository) Update(role *model.Role) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process update role */
+		sql := `update roles set code = ?, name = ?, mfa_required = ? where id = ?`
+		process := r.dbMaster.Exec(sql, role.Code, role.Name, role.MFARequired, role.ID)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: model.ErrRoleNotFound}
+			return
+		}
+		result <- model.Result{Data: *role}
+
+	}()
+	return result
+}
+
+// Delete: role that still assigned to user can not be deleted
+func (r *repository) Delete(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Lock role and check assignment */
+		tx := r.dbMaster.Begin()
+		var roleID int
+		sql := `select id from roles where id = ? for update`
+		if err := tx.Raw(sql, id).Scan(&roleID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		if roleID == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: model.ErrRoleNotFound}
+			return
+		}
+		var totalUser int64
+		sql = `select count(1) from user_has_roles where role_id = ?`
+		if err := tx.Raw(sql, id).Scan(&totalUser).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		if totalUser > 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("Role still assigned to users")}
+			return
+		}
+
+		/* Delete role has permissions and role */
+		sql = `delete from role_has_permissions where role_id = ?`
+		if err := tx.Exec(sql, id).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		sql = `delete from roles where id = ?`
+		if err := tx.Exec(sql, id).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		tx.Commit()
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// SetPermissions: replace permissions of the role, token of the role holders carry the old permissions so it is revoked
+func (r *repository) SetPermissions(id int, permissions []string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Delete current role has permissions */
+		tx := r.dbMaster.Begin()
+		sql := `delete from role_has_permissions where role_id = ?`
+		if err := tx.Exec(sql, id).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Insert new role has permissions */
+		if err := assignPermissions(tx, id, permissions); err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Revoke access tokens of role holders */
+		sql = `insert into user_token_revocations (user_id, revoked_at)
+			select user_id, now() from user_has_roles where role_id = ?
+			on conflict (user_id) do update set revoked_at = excluded.revoked_at`
+		if err := tx.Exec(sql, id).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		tx.Commit()
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// GetPermissions:
+func (r *repository) GetPermissions() <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get permissions */
+		var permissions []model.Permission
+		sql := `select id, code, name from permissions order by code asc`
+		if err := r.dbMaster.Raw(sql).Scan(&permissions).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: permissions}
+
+	}()
+	return result
+}
+
+// CountUsers: role is shared by every organization, only user of the organization is counted
+func (r *repository) CountUsers(organizationID, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process count users */
+		var count int64
+		sql := `select count(1)
+			from user_has_roles uhr
+			inner join users u on u.id = uhr.user_id
+			inner join organization_users ou on ou.user_id = u.id and ou.organization_id = ?
+			where uhr.role_id = ? and u.deleted_at is null`
+		if err := r.dbMaster.Raw(sql, organizationID, id).Scan(&count).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: count}
+
+	}()
+	return result
+}
+
+// GetUsers:
+func (r *repository) GetUsers(organizationID, id, page, limit int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get users */
+		var users []model.User
+		offset := (page - 1) * limit
+		sql := `select u.id, u.name, u.email
+			from users u
+			inner join user_has_roles uhr on uhr.user_id = u.id
+			inner join organization_users ou on ou.user_id = u.id and ou.organization_id = ?
+			where uhr.role_id = ? and u.deleted_at is null
+			order by u.id desc
+			offset ? limit ?`
+		if err := r.dbMaster.Raw(sql, organizationID, id, offset, limit).Scan(&users).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: users}
+
+	}()
+	return result
+}
+
+// assignPermissions: every permission code must exist
+func assignPermissions(tx *gorm.DB, roleID int, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+	sql := `insert into role_has_permissions (role_id, permission_id)
+		select ?, id from permissions where code in ?
+		on conflict do nothing`
+	process := tx.Exec(sql, roleID, permissions)
+	if process.Error != nil {
+		return process.Error
+	}
+	if int(process.RowsAffected) != len(permissions) {
+		return errors.New("Permission not found")
+	}
+	return nil
+}
+
+func splitPermissions(permissions string) []string {
+	if len(permissions) == 0 {
+		return []string{}
+	}
+	return strings.Split(permissions, ",")
+}
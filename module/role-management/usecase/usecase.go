@@ -0,0 +1,246 @@
+package usecase
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/novalwardhana/golang-boilerplate/module/role-management/model"
+	"github.com/novalwardhana/golang-boilerplate/module/role-management/repository"
+)
+
+type usecase struct {
+	repo repository.Repository
+}
+
+type Usecase interface {
+	Create(role *model.NewRole) <-chan model.Result
+	GetData() <-chan model.Result
+	Detail(id int) <-chan model.Result
+	Update(role *model.Role) <-chan model.Result
+	Delete(id int) <-chan model.Result
+	SetPermissions(id int, permissions []string) <-chan model.Result
+	GetPermissions() <-chan model.Result
+	GetUsers(organizationID, id, page, limit int) <-chan model.Result
+}
+
+func NewUsecase(repo repository.Repository) Usecase {
+	return &usecase{
+		repo: repo,
+	}
+}
+
+// Create:
+func (u *usecase) Create(payload *model.NewRole) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Create role process */
+		role := payload.Role
+		role.Code = strings.TrimSpace(role.Code)
+		if role.Code == model.RoleRoot {
+			result <- model.Result{Error: errors.New("Role code root already reserved")}
+			return
+		}
+		processCreate := <-u.repo.Create(&role, uniquePermissions(payload.Permissions))
+		if processCreate.Error != nil {
+			result <- model.Result{Error: processCreate.Error}
+			return
+		}
+		role = processCreate.Data.(model.Role)
+
+		/* Get role process */
+		processGetRole := <-u.repo.GetRole(role.ID)
+		result <- processGetRole
+
+	}()
+	return result
+}
+
+// GetData:
+func (u *usecase) GetData() <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get data process */
+		processGetData := <-u.repo.GetData()
+		result <- processGetData
+
+	}()
+	return result
+}
+
+// Detail:
+func (u *usecase) Detail(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get role process */
+		processGetRole := <-u.repo.GetRole(id)
+		result <- processGetRole
+
+	}()
+	return result
+}
+
+// Update: code of root role can not be changed, other role can not take root code
+func (u *usecase) Update(role *model.Role) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get current role process */
+		processGetRole := <-u.repo.GetRole(role.ID)
+		if processGetRole.Error != nil {
+			result <- model.Result{Error: processGetRole.Error}
+			return
+		}
+		currentRole := processGetRole.Data.(model.RoleWithPermissions)
+		role.Code = strings.TrimSpace(role.Code)
+		if (currentRole.Code == model.RoleRoot || role.Code == model.RoleRoot) && currentRole.Code != role.Code {
+			result <- model.Result{Error: errors.New("Code of root role can not be changed")}
+			return
+		}
+
+		/* Update role process */
+		processUpdate := <-u.repo.Update(role)
+		if processUpdate.Error != nil {
+			result <- model.Result{Error: processUpdate.Error}
+			return
+		}
+
+		/* Get role process */
+		processGetRole = <-u.repo.GetRole(role.ID)
+		result <- processGetRole
+
+	}()
+	return result
+}
+
+// Delete:
+func (u *usecase) Delete(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get role process */
+		processGetRole := <-u.repo.GetRole(id)
+		if processGetRole.Error != nil {
+			result <- model.Result{Error: processGetRole.Error}
+			return
+		}
+		if processGetRole.Data.(model.RoleWithPermissions).Code == model.RoleRoot {
+			result <- model.Result{Error: errors.New("Root role can not be deleted")}
+			return
+		}
+
+		/* Delete role process */
+		processDelete := <-u.repo.Delete(id)
+		result <- processDelete
+
+	}()
+	return result
+}
+
+// SetPermissions: root role always hold every permission so it is not assigned
+func (u *usecase) SetPermissions(id int, permissions []string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get role process */
+		processGetRole := <-u.repo.GetRole(id)
+		if processGetRole.Error != nil {
+			result <- model.Result{Error: processGetRole.Error}
+			return
+		}
+		if processGetRole.Data.(model.RoleWithPermissions).Code == model.RoleRoot {
+			result <- model.Result{Error: errors.New("Root role always hold every permission")}
+			return
+		}
+
+		/* Set permissions process */
+		processSetPermissions := <-u.repo.SetPermissions(id, uniquePermissions(permissions))
+		if processSetPermissions.Error != nil {
+			result <- model.Result{Error: processSetPermissions.Error}
+			return
+		}
+
+		/* Get role process */
+		processGetRole = <-u.repo.GetRole(id)
+		result <- processGetRole
+
+	}()
+	return result
+}
+
+// GetPermissions:
+func (u *usecase) GetPermissions() <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get permissions process */
+		processGetPermissions := <-u.repo.GetPermissions()
+		result <- processGetPermissions
+
+	}()
+	return result
+}
+
+// GetUsers:
+func (u *usecase) GetUsers(organizationID, id, page, limit int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get role process */
+		processGetRole := <-u.repo.GetRole(id)
+		if processGetRole.Error != nil {
+			result <- model.Result{Error: processGetRole.Error}
+			return
+		}
+
+		/* Count users process */
+		processCountUsers := <-u.repo.CountUsers(organizationID, id)
+		if processCountUsers.Error != nil {
+			result <- model.Result{Error: processCountUsers.Error}
+			return
+		}
+		totalData := int(processCountUsers.Data.(int64))
+		numberOfPage := int(math.Ceil(float64(totalData) / float64(limit)))
+
+		/* Get users process */
+		processGetUsers := <-u.repo.GetUsers(organizationID, id, page, limit)
+		if processGetUsers.Error != nil {
+			result <- model.Result{Error: processGetUsers.Error}
+			return
+		}
+		result <- model.Result{Data: model.Pagination{
+			Page:         page,
+			Limit:        limit,
+			TotalData:    totalData,
+			NumberOfPage: numberOfPage,
+			Data:         processGetUsers.Data.([]model.User),
+		}}
+
+	}()
+	return result
+}
+
+func uniquePermissions(permissions []string) []string {
+	unique := []string{}
+	exists := map[string]bool{}
+	for _, permission := range permissions {
+		permission = strings.TrimSpace(permission)
+		if len(permission) == 0 || exists[permission] {
+			continue
+		}
+		exists[permission] = true
+		unique = append(unique, permission)
+	}
+	return unique
+}
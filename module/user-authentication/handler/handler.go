@@ -2,8 +2,12 @@ package handler
 
 import (
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 
 	"github.com/labstack/echo"
+	"github.com/novalwardhana/golang-boilerplate/config/jwtkey"
 	"github.com/novalwardhana/golang-boilerplate/middleware/auth"
 	"github.com/novalwardhana/golang-boilerplate/module/user-authentication/model"
 	"github.com/novalwardhana/golang-boilerplate/module/user-authentication/usecase"
@@ -21,9 +25,37 @@ func NewHandler(uc usecase.Usecase) *Handler {
 
 func (h *Handler) Mount(group *echo.Group) {
 	group.POST("/login", h.login)
+	group.POST("/refresh", h.refresh)
+	group.POST("/logout", h.logout)
+	group.POST("/forgot-password", h.forgotPassword)
+	group.POST("/reset-password", h.resetPassword)
+	group.POST("/verify-email", h.verifyEmail)
+	group.POST("/accept-invitation", h.acceptInvitation)
+	group.POST("/login/mfa", h.loginMFA)
+	group.POST("/login/mfa/enroll", h.loginMFAEnroll)
+	group.GET("/oidc/login", h.oidcLogin)
+	group.GET("/oidc/callback", h.oidcCallback)
+	group.POST("/mfa/enroll", h.enrollMFA, auth.CheckAuth(), auth.RefuseImpersonation())
+	group.POST("/mfa/activate", h.activateMFA, auth.CheckAuth(), auth.RefuseImpersonation())
+	group.POST("/mfa/disable", h.disableMFA, auth.CheckAuth(), auth.RefuseImpersonation())
+	group.GET("/me", h.getProfile, auth.CheckAuth())
+	group.PUT("/me", h.updateProfile, auth.CheckAuth(), auth.RefuseImpersonation())
+	group.PUT("/me/password", h.changePassword, auth.CheckAuth(), auth.RefuseImpersonation())
+	group.GET("/me/organizations", h.getOrganizations, auth.CheckAuth())
+	group.POST("/me/organization", h.switchOrganization, auth.CheckAuth(), auth.RefuseImpersonation())
+	group.GET("/me/sessions", h.getSessions, auth.CheckAuth())
+	group.DELETE("/me/sessions/:id", h.revokeSession, auth.CheckAuth(), auth.RefuseImpersonation())
+	group.POST("/api-keys", h.createAPIKey, auth.CheckAuth(), auth.RefuseImpersonation())
+	group.GET("/api-keys", h.getAPIKeys, auth.CheckAuth())
+	group.DELETE("/api-keys/:id", h.revokeAPIKey, auth.CheckAuth(), auth.RefuseImpersonation())
+	group.POST("/impersonate", h.impersonate, auth.CheckAuth(), auth.Require("users:impersonate"), auth.RefuseImpersonation())
 	group.POST("/login-test", h.loginTest, auth.CheckAuth())
 }
 
+func (h *Handler) MountWellKnown(group *echo.Group) {
+	group.GET("/jwks.json", h.jwks)
+}
+
 // Login:
 func (h *Handler) login(c echo.Context) error {
 
@@ -37,14 +69,580 @@ func (h *Handler) login(c echo.Context) error {
 	}
 
 	/* Login process */
-	result := <-h.uc.UserLogin(user.Email, user.Password)
+	result := <-h.uc.UserLogin(user.Email, user.Password, model.Client{IP: auth.ClientIP(c), UserAgent: c.Request().UserAgent()})
+	if result.Error == model.ErrLoginLocked {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusTooManyRequests, Message: result.Error.Error()})
+	}
 	if result.Error != nil {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: result.Error.Error()})
+	}
+	if _, ok := result.Data.(model.MFAChallenge); ok {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "MFA verification required", Data: result.Data})
 	}
 
 	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success login and generate JSON Web Token", Data: result.Data})
 }
 
+// Refresh:
+func (h *Handler) refresh(c echo.Context) error {
+
+	/* Payload validation */
+	payload := new(model.RefreshTokenRequest)
+	if err := c.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.RefreshToken) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Refresh token must be filled"})
+	}
+
+	/* Refresh process */
+	result := <-h.uc.RefreshToken(payload.RefreshToken)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success refresh JSON Web Token", Data: result.Data})
+}
+
+// Logout:
+func (h *Handler) logout(c echo.Context) error {
+
+	/* Payload validation */
+	payload := new(model.RefreshTokenRequest)
+	if err := c.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.RefreshToken) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Refresh token must be filled"})
+	}
+
+	/* Access token from bearer is optional, when filled it is revoked together with the refresh token */
+	var accessToken string
+	authorization := strings.Split(c.Request().Header.Get("authorization"), " ")
+	if len(authorization) == 2 && authorization[0] == "Bearer" {
+		accessToken = authorization[1]
+	}
+
+	/* Logout process */
+	result := <-h.uc.Logout(payload.RefreshToken, accessToken)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success logout"})
+}
+
+// ForgotPassword:
+func (h *Handler) forgotPassword(c echo.Context) error {
+
+	/* Payload validation */
+	payload := new(model.ForgotPasswordRequest)
+	if err := c.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.Email) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Email must be filled"})
+	}
+
+	/* Forgot password process */
+	result := <-h.uc.ForgotPassword(payload.Email)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusInternalServerError, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "If the email is registered, a reset password link has been sent"})
+}
+
+// ResetPassword:
+func (h *Handler) resetPassword(c echo.Context) error {
+
+	/* Payload validation */
+	payload := new(model.ResetPasswordRequest)
+	if err := c.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.Token) == 0 || len(payload.Password) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Token and password must be filled"})
+	}
+	if len(payload.Password) < 8 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Password must be at least 8 characters"})
+	}
+
+	/* Reset password process */
+	result := <-h.uc.ResetPassword(payload.Token, payload.Password)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success reset password"})
+}
+
+// AcceptInvitation:
+func (h *Handler) acceptInvitation(c echo.Context) error {
+
+	/* Payload validation */
+	payload := new(model.AcceptInvitationRequest)
+	if err := c.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.Token) == 0 || len(strings.TrimSpace(payload.Name)) == 0 || len(payload.Password) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Token, name, and password must be filled"})
+	}
+	if len(payload.Password) < 8 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Password must be at least 8 characters"})
+	}
+
+	/* Accept invitation process */
+	result := <-h.uc.AcceptInvitation(*payload)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success accept invitation"})
+}
+
+// VerifyEmail:
+func (h *Handler) verifyEmail(c echo.Context) error {
+
+	/* Payload validation */
+	payload := new(model.VerifyEmailRequest)
+	if err := c.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.Token) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Token must be filled"})
+	}
+
+	/* Verify email process */
+	result := <-h.uc.VerifyEmail(payload.Token)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success verify email address"})
+}
+
+// LoginMFA:
+func (h *Handler) loginMFA(c echo.Context) error {
+
+	/* Payload validation */
+	payload := new(model.MFARequest)
+	if err := c.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.MFAToken) == 0 || (len(payload.Code) == 0 && len(payload.RecoveryCode) == 0) {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "MFA token and code or recovery code must be filled"})
+	}
+
+	/* Login MFA process */
+	result := <-h.uc.LoginMFA(payload.MFAToken, payload.Code, payload.RecoveryCode, model.Client{IP: auth.ClientIP(c), UserAgent: c.Request().UserAgent()})
+	if result.Error == model.ErrLoginLocked {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusTooManyRequests, Message: result.Error.Error()})
+	}
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success login and generate JSON Web Token", Data: result.Data})
+}
+
+// LoginMFAEnroll:
+func (h *Handler) loginMFAEnroll(c echo.Context) error {
+
+	/* Payload validation */
+	payload := new(model.MFARequest)
+	if err := c.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.MFAToken) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "MFA token must be filled"})
+	}
+
+	/* Enroll process, first call without email code only send the code */
+	result := <-h.uc.LoginMFAEnroll(payload.MFAToken, payload.EmailCode)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: result.Error.Error()})
+	}
+	if len(payload.EmailCode) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Enrollment code sent to email, enroll again with the email code"})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success enroll MFA, confirm with the first code", Data: result.Data})
+}
+
+// OIDCLogin: redirect browser to identity provider
+func (h *Handler) oidcLogin(c echo.Context) error {
+
+	/* Authorize process */
+	result := <-h.uc.OIDCAuthorize()
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusInternalServerError, Message: result.Error.Error()})
+	}
+
+	/* State cookie is scoped to the oidc path, lax so it is sent on the redirect back from identity provider */
+	authorization := result.Data.(model.OIDCAuthorization)
+	c.SetCookie(&http.Cookie{
+		Name:     model.OIDCStateCookie,
+		Value:    authorization.StateCookie,
+		Path:     path.Dir(c.Path()),
+		MaxAge:   int(authorization.ExpiresIn),
+		Secure:   c.Scheme() == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return c.Redirect(http.StatusFound, authorization.AuthorizationURL)
+}
+
+// OIDCCallback:
+func (h *Handler) oidcCallback(c echo.Context) error {
+
+	/* Param validation */
+	if errorParam := c.QueryParam("error"); len(errorParam) > 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: "Identity provider error: " + errorParam + " " + c.QueryParam("error_description")})
+	}
+	code := c.QueryParam("code")
+	state := c.QueryParam("state")
+	if len(code) == 0 || len(state) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Code and state must be filled"})
+	}
+	stateCookie, err := c.Cookie(model.OIDCStateCookie)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: "OIDC state not valid"})
+	}
+
+	/* State cookie is single use */
+	c.SetCookie(&http.Cookie{
+		Name:     model.OIDCStateCookie,
+		Path:     path.Dir(c.Path()),
+		MaxAge:   -1,
+		Secure:   c.Scheme() == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	/* Callback process */
+	result := <-h.uc.OIDCCallback(code, state, stateCookie.Value, model.Client{IP: auth.ClientIP(c), UserAgent: c.Request().UserAgent()})
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: result.Error.Error()})
+	}
+	if _, ok := result.Data.(model.MFAChallenge); ok {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "MFA verification required", Data: result.Data})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success login and generate JSON Web Token", Data: result.Data})
+}
+
+// EnrollMFA:
+func (h *Handler) enrollMFA(c echo.Context) error {
+	mc := c.(auth.NewContext)
+
+	/* Enroll process */
+	result := <-h.uc.EnrollMFA(mc.User.ID)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success enroll MFA, confirm with the first code", Data: result.Data})
+}
+
+// ActivateMFA:
+func (h *Handler) activateMFA(c echo.Context) error {
+	mc := c.(auth.NewContext)
+
+	/* Payload validation */
+	payload := new(model.MFARequest)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.Code) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Code must be filled"})
+	}
+
+	/* Activate process */
+	result := <-h.uc.ActivateMFA(mc.User.ID, payload.Code)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success activate MFA, keep the recovery codes in a safe place", Data: map[string]interface{}{
+		"recovery_codes": result.Data,
+	}})
+}
+
+// DisableMFA:
+func (h *Handler) disableMFA(c echo.Context) error {
+	mc := c.(auth.NewContext)
+
+	/* Payload validation */
+	payload := new(model.MFARequest)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.Code) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Code must be filled"})
+	}
+
+	/* Disable process */
+	result := <-h.uc.DisableMFA(mc.User.ID, payload.Code)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success disable MFA"})
+}
+
+// GetProfile:
+func (h *Handler) getProfile(c echo.Context) error {
+	mc := c.(auth.NewContext)
+
+	/* Get process */
+	result := <-h.uc.GetProfile(mc.User.ID, mc.Permissions)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get profile", Data: result.Data})
+}
+
+// UpdateProfile: role is not part of the payload, user can not change their own roles
+func (h *Handler) updateProfile(c echo.Context) error {
+	mc := c.(auth.NewContext)
+
+	/* Payload validation */
+	payload := new(model.ProfileRequest)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(strings.TrimSpace(payload.Name)) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Name must be filled"})
+	}
+
+	/* Update process */
+	result := <-h.uc.UpdateProfile(mc.User.ID, *payload, mc.Permissions)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success update profile", Data: result.Data})
+}
+
+// ChangePassword: only the account owner with the current password, not API key
+func (h *Handler) changePassword(c echo.Context) error {
+	mc := c.(auth.NewContext)
+	if mc.AuthType == auth.AuthTypeAPIKey {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusForbidden, Message: "API key can not change password"})
+	}
+
+	/* Payload validation */
+	payload := new(model.ChangePasswordRequest)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.CurrentPassword) == 0 || len(payload.NewPassword) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Current password and new password must be filled"})
+	}
+	if len(payload.NewPassword) < 8 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Password must be at least 8 characters"})
+	}
+	if payload.NewPassword == payload.CurrentPassword {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "New password must be different from current password"})
+	}
+
+	/* Change password process */
+	result := <-h.uc.ChangePassword(mc.User.ID, mc.SessionID, *payload, model.Client{IP: auth.ClientIP(c), UserAgent: c.Request().UserAgent()})
+	if result.Error == model.ErrLoginLocked {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusTooManyRequests, Message: result.Error.Error()})
+	}
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success change password"})
+}
+
+// GetOrganizations:
+func (h *Handler) getOrganizations(c echo.Context) error {
+	mc := c.(auth.NewContext)
+
+	/* Get process */
+	result := <-h.uc.GetOrganizations(mc.User.ID, mc.OrganizationID)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusInternalServerError, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get organizations", Data: result.Data})
+}
+
+// SwitchOrganization: the active organization belong to the session, API key always use the default organization
+func (h *Handler) switchOrganization(c echo.Context) error {
+	mc := c.(auth.NewContext)
+	if len(mc.SessionID) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusForbidden, Message: "Organization can only be switched in a login session"})
+	}
+
+	/* Payload validation */
+	payload := new(model.SwitchOrganizationRequest)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if payload.OrganizationID == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Organization id must be filled"})
+	}
+
+	/* Switch process */
+	result := <-h.uc.SwitchOrganization(mc.User.ID, mc.SessionID, payload.OrganizationID)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success switch organization", Data: result.Data})
+}
+
+// GetSessions:
+func (h *Handler) getSessions(c echo.Context) error {
+	mc := c.(auth.NewContext)
+
+	/* Get process */
+	result := <-h.uc.GetSessions(mc.User.ID, mc.SessionID)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusInternalServerError, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get sessions", Data: result.Data})
+}
+
+// RevokeSession: user can only end their own session
+func (h *Handler) revokeSession(c echo.Context) error {
+	mc := c.(auth.NewContext)
+
+	/* Revoke process */
+	result := <-h.uc.RevokeSession(mc.Param("id"), mc.User.ID)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success revoke session"})
+}
+
+// CreateAPIKey: key for other user (service account) need users:write permission
+func (h *Handler) createAPIKey(c echo.Context) error {
+	mc := c.(auth.NewContext)
+	if mc.AuthType == auth.AuthTypeAPIKey {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusForbidden, Message: "API key can not manage API keys"})
+	}
+
+	/* Payload validation */
+	payload := new(model.APIKeyRequest)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.Name) == 0 || len(payload.Scopes) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Name and scopes must be filled"})
+	}
+	if payload.UserID == 0 {
+		payload.UserID = mc.User.ID
+	}
+	if payload.UserID != mc.User.ID && !mc.HasPermission("users:write") {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: "User not have permission users:write"})
+	}
+
+	/* Create process */
+	result := <-h.uc.CreateAPIKey(mc.User.ID, mc.OrganizationID, *payload)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success create API key, keep the key in a safe place", Data: result.Data})
+}
+
+// GetAPIKeys: key of other user need users:read permission
+func (h *Handler) getAPIKeys(c echo.Context) error {
+	mc := c.(auth.NewContext)
+	if mc.AuthType == auth.AuthTypeAPIKey {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusForbidden, Message: "API key can not manage API keys"})
+	}
+
+	/* Param validation */
+	userID := mc.User.ID
+	if paramUserID := mc.QueryParam("user_id"); len(paramUserID) > 0 {
+		id, err := strconv.Atoi(paramUserID)
+		if err != nil {
+			return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+		}
+		userID = id
+	}
+	if userID != mc.User.ID && !mc.HasPermission("users:read") {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: "User not have permission users:read"})
+	}
+
+	/* Get process */
+	result := <-h.uc.GetAPIKeys(mc.OrganizationID, userID)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get API keys", Data: result.Data})
+}
+
+// RevokeAPIKey: key of other user need users:write permission
+func (h *Handler) revokeAPIKey(c echo.Context) error {
+	mc := c.(auth.NewContext)
+	if mc.AuthType == auth.AuthTypeAPIKey {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusForbidden, Message: "API key can not manage API keys"})
+	}
+
+	/* Param validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Ownership check */
+	processGetAPIKey := <-h.uc.GetAPIKey(mc.OrganizationID, id)
+	if processGetAPIKey.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: "API key not found"})
+	}
+	if processGetAPIKey.Data.(model.APIKey).UserID != mc.User.ID && !mc.HasPermission("users:write") {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: "User not have permission users:write"})
+	}
+
+	/* Revoke process */
+	result := <-h.uc.RevokeAPIKey(id)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success revoke API key"})
+}
+
+// Impersonate: API key can not be used to start impersonation
+func (h *Handler) impersonate(c echo.Context) error {
+	mc := c.(auth.NewContext)
+	if mc.AuthType == auth.AuthTypeAPIKey {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusForbidden, Message: "API key can not impersonate user"})
+	}
+
+	/* Payload validation */
+	payload := new(model.ImpersonationRequest)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if payload.UserID == 0 || len(strings.TrimSpace(payload.Reason)) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "User id and reason must be filled"})
+	}
+
+	/* Impersonate process */
+	actor := model.JWTActor{ID: mc.User.ID, Name: mc.User.Name, Email: mc.User.Email}
+	result := <-h.uc.Impersonate(actor, mc.IsRoot(), mc.OrganizationID, *payload, model.Client{IP: auth.ClientIP(c), UserAgent: c.Request().UserAgent()})
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success generate impersonation token", Data: result.Data})
+}
+
 // LoginTest:
 func (h *Handler) loginTest(c echo.Context) error {
 	mc := c.(auth.NewContext)
@@ -60,8 +658,15 @@ func (h *Handler) loginTest(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success login test", Data: map[string]interface{}{
-		"user":    mc.User,
-		"roles":   mc.Roles,
-		"payload": testPayload,
+		"user":        mc.User,
+		"real_user":   mc.RealUser,
+		"roles":       mc.Roles,
+		"permissions": mc.Permissions,
+		"payload":     testPayload,
 	}})
 }
+
+// JWKS:
+func (h *Handler) jwks(c echo.Context) error {
+	return c.JSON(http.StatusOK, jwtkey.JWKS())
+}
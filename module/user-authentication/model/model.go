@@ -1,14 +1,20 @@
 package model
 
 import (
+	"errors"
+	"time"
+
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
 type User struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Email      string     `json:"email"`
+	Password   string     `json:"password"`
+	VerifiedAt *time.Time `json:"-"`
+	Status     string     `json:"-"`
+	DeletedAt  *time.Time `json:"-"`
 }
 
 type Role struct {
@@ -28,16 +34,272 @@ type Response struct {
 	Data    interface{} `json:"data"`
 }
 
-var JWTSignatureKey = []byte("novalwardhana")
+var ErrInvalidCredential = errors.New("Email or password not valid")
+var ErrLoginLocked = errors.New("Too many failed login attempts, try again later")
+var ErrUserDisabled = errors.New("User account disabled")
+var ErrRefreshTokenReused = errors.New("Refresh token reuse detected")
+
+const UserStatusDisabled string = "disabled"
+
+const LoginFailureKindEmail string = "email"
+const LoginFailureKindIP string = "ip"
+
+const AudienceAccess string = "access"
+const AudienceMFA string = "mfa"
+const AudienceOIDCState string = "oidc_state"
+
+const OIDCStateCookie string = "oidc_state"
 
 type JWTData struct {
-	Data JWTUserData `json:"data"`
+	Data           JWTUserData `json:"data"`
+	SessionID      string      `json:"sid,omitempty"`
+	OrganizationID int         `json:"org,omitempty"`
+	Actor          *JWTActor   `json:"act,omitempty"`
 	jwt.StandardClaims
 }
 
-type JWTUserData struct {
+// JWTActor: real user of impersonation token
+type JWTActor struct {
 	ID    int    `json:"id"`
 	Name  string `json:"name"`
 	Email string `json:"email"`
-	Roles []Role `json:"roles"`
+}
+
+type JWTUserData struct {
+	ID            int      `json:"id"`
+	Name          string   `json:"name"`
+	Email         string   `json:"email"`
+	Roles         []Role   `json:"roles"`
+	Permissions   []string `json:"permissions"`
+	EmailVerified bool     `json:"email_verified"`
+}
+
+type Token struct {
+	AccessToken   string   `json:"access_token"`
+	TokenType     string   `json:"token_type"`
+	ExpiresIn     int64    `json:"expires_in"`
+	RefreshToken  string   `json:"refresh_token"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type RefreshToken struct {
+	ID        int        `json:"id" gorm:"id"`
+	UserID    int        `json:"user_id" gorm:"user_id"`
+	FamilyID  string     `json:"family_id" gorm:"family_id"`
+	TokenHash string     `json:"-" gorm:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"expires_at"`
+	UsedAt    *time.Time `json:"used_at" gorm:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at" gorm:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"created_at"`
+}
+
+func (r *RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type PasswordReset struct {
+	ID        int        `json:"id" gorm:"id"`
+	UserID    int        `json:"user_id" gorm:"user_id"`
+	TokenHash string     `json:"-" gorm:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"expires_at"`
+	UsedAt    *time.Time `json:"used_at" gorm:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"created_at"`
+}
+
+func (p *PasswordReset) TableName() string {
+	return "password_resets"
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type EmailVerification struct {
+	ID        int        `json:"id" gorm:"id"`
+	UserID    int        `json:"user_id" gorm:"user_id"`
+	TokenHash string     `json:"-" gorm:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"expires_at"`
+	UsedAt    *time.Time `json:"used_at" gorm:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"created_at"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type UserMFA struct {
+	UserID       int        `json:"user_id" gorm:"user_id"`
+	Secret       string     `json:"-" gorm:"secret"`
+	EnabledAt    *time.Time `json:"enabled_at" gorm:"enabled_at"`
+	LastUsedStep int64      `json:"-" gorm:"last_used_step"`
+	ChallengeID  string     `json:"-" gorm:"challenge_id"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"created_at"`
+}
+
+// MFAEnrollmentCode: proof of mailbox ownership before the first enrollment during login
+type MFAEnrollmentCode struct {
+	ChallengeID string    `gorm:"challenge_id"`
+	UserID      int       `gorm:"user_id"`
+	CodeHash    string    `gorm:"code_hash"`
+	ExpiresAt   time.Time `gorm:"expires_at"`
+}
+
+func (m *MFAEnrollmentCode) TableName() string {
+	return "user_mfa_enrollment_codes"
+}
+
+type MFAChallenge struct {
+	MFARequired        bool   `json:"mfa_required"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	MFAToken           string `json:"mfa_token"`
+	ExpiresIn          int64  `json:"expires_in"`
+}
+
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFARequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	EmailCode    string `json:"email_code"`
+}
+
+type Client struct {
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+}
+
+type APIKey struct {
+	ID         int        `json:"id" gorm:"id"`
+	UserID     int        `json:"user_id" gorm:"user_id"`
+	Name       string     `json:"name" gorm:"name"`
+	Prefix     string     `json:"prefix" gorm:"prefix"`
+	KeyHash    string     `json:"-" gorm:"key_hash"`
+	Scopes     string     `json:"scopes" gorm:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at" gorm:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at" gorm:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at" gorm:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"created_at"`
+}
+
+func (a *APIKey) TableName() string {
+	return "api_keys"
+}
+
+type APIKeyRequest struct {
+	UserID    int        `json:"user_id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type UserIdentity struct {
+	ID          int        `json:"id" gorm:"id"`
+	UserID      int        `json:"user_id" gorm:"user_id"`
+	Provider    string     `json:"provider" gorm:"provider"`
+	Subject     string     `json:"subject" gorm:"subject"`
+	Email       string     `json:"email" gorm:"email"`
+	LastLoginAt *time.Time `json:"last_login_at" gorm:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"created_at"`
+}
+
+func (u *UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+type OIDCState struct {
+	ID           int        `json:"id" gorm:"id"`
+	StateHash    string     `json:"-" gorm:"state_hash"`
+	CodeVerifier string     `json:"-" gorm:"code_verifier"`
+	Nonce        string     `json:"-" gorm:"nonce"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"expires_at"`
+	UsedAt       *time.Time `json:"used_at" gorm:"used_at"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"created_at"`
+}
+
+func (o *OIDCState) TableName() string {
+	return "oidc_states"
+}
+
+type OIDCAuthorization struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+	StateCookie      string `json:"-"`
+	ExpiresIn        int64  `json:"-"`
+}
+
+type Session struct {
+	ID             string     `json:"id" gorm:"id"`
+	UserID         int        `json:"user_id" gorm:"user_id"`
+	OrganizationID int        `json:"organization_id" gorm:"organization_id"`
+	UserAgent      string     `json:"user_agent" gorm:"user_agent"`
+	IP             string     `json:"ip" gorm:"ip"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"created_at"`
+	LastSeenAt     time.Time  `json:"last_seen_at" gorm:"last_seen_at"`
+	RevokedAt      *time.Time `json:"revoked_at" gorm:"revoked_at"`
+	Current        bool       `json:"current" gorm:"-"`
+}
+
+func (s *Session) TableName() string {
+	return "sessions"
+}
+
+type Organization struct {
+	ID      int    `json:"id" gorm:"id"`
+	Code    string `json:"code" gorm:"code"`
+	Name    string `json:"name" gorm:"name"`
+	Current bool   `json:"current" gorm:"-"`
+}
+
+type SwitchOrganizationRequest struct {
+	OrganizationID int `json:"organization_id"`
+}
+
+var ErrNoOrganization = errors.New("User not member of any organization")
+
+type Profile struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Email       string     `json:"email"`
+	VerifiedAt  *time.Time `json:"verified_at"`
+	MFAEnabled  bool       `json:"mfa_enabled"`
+	Roles       []Role     `json:"roles"`
+	Permissions []string   `json:"permissions"`
+}
+
+type ProfileRequest struct {
+	Name string `json:"name"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ImpersonationRequest struct {
+	UserID int    `json:"user_id"`
+	Reason string `json:"reason"`
 }
@@ -1,6 +1,10 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
+	"github.com/novalwardhana/golang-boilerplate/middleware/auth"
 	"github.com/novalwardhana/golang-boilerplate/module/user-authentication/model"
 	"gorm.io/gorm"
 )
@@ -11,7 +15,54 @@ type repository struct {
 
 type Repository interface {
 	GetUser(email string) <-chan model.Result
+	GetUserByID(id int) <-chan model.Result
 	GetRole(id int) <-chan model.Result
+	GetPermissions(id int) <-chan model.Result
+	UpdatePassword(id int, passwordHash string) <-chan model.Result
+	UpdateProfile(id int, name string) <-chan model.Result
+	ChangePassword(userID int, passwordHash, currentSessionID string) <-chan model.Result
+	CreateSession(session *model.Session, refreshToken *model.RefreshToken) <-chan model.Result
+	GetRefreshToken(tokenHash string) <-chan model.Result
+	RotateRefreshToken(id int, refreshToken *model.RefreshToken) <-chan model.Result
+	RevokeRefreshTokenFamily(familyID string) <-chan model.Result
+	RevokeAccessToken(jti string, userID int, expiresAt time.Time) <-chan model.Result
+	CreatePasswordReset(passwordReset *model.PasswordReset) <-chan model.Result
+	GetPasswordReset(tokenHash string) <-chan model.Result
+	ResetPassword(passwordResetID, userID int, passwordHash string) <-chan model.Result
+	GetEmailVerification(tokenHash string) <-chan model.Result
+	VerifyEmail(emailVerificationID, userID int) <-chan model.Result
+	IsMFARequired(userID int) <-chan model.Result
+	GetUserMFA(userID int) <-chan model.Result
+	SaveUserMFA(userID int, secret, challengeID string, pendingTTL time.Duration) <-chan model.Result
+	CreateMFAEnrollmentCode(enrollmentCode *model.MFAEnrollmentCode) <-chan model.Result
+	UseMFAEnrollmentCode(challengeID string, userID int, codeHash string) <-chan model.Result
+	EnableUserMFA(userID int, recoveryCodeHashes []string) <-chan model.Result
+	DisableUserMFA(userID int) <-chan model.Result
+	UseMFAStep(userID int, step int64) <-chan model.Result
+	UseRecoveryCode(userID int, codeHash string) <-chan model.Result
+	GetLoginLockout(email, ip string) <-chan model.Result
+	RecordLoginFailure(kind, value string, window time.Duration) <-chan model.Result
+	LockLogin(kind, value string, lockedUntil time.Time) <-chan model.Result
+	ClearLoginFailure(kind, value string) <-chan model.Result
+	CreateAPIKey(apiKey *model.APIKey) <-chan model.Result
+	GetAPIKeys(userID int) <-chan model.Result
+	GetAPIKey(id int) <-chan model.Result
+	RevokeAPIKey(id int) <-chan model.Result
+	CreateOIDCState(oidcState *model.OIDCState) <-chan model.Result
+	UseOIDCState(stateHash string) <-chan model.Result
+	GetUserIdentity(provider, subject string) <-chan model.Result
+	LinkUserIdentity(userIdentity *model.UserIdentity) <-chan model.Result
+	TouchUserIdentity(id int) <-chan model.Result
+	ProvisionUser(user *model.User, roleCodes []string, userIdentity *model.UserIdentity) <-chan model.Result
+	AcceptInvitation(tokenHash string, user *model.User) <-chan model.Result
+	GetSessions(userID int) <-chan model.Result
+	GetDefaultOrganization(userID int) <-chan model.Result
+	GetSessionOrganization(sessionID string) <-chan model.Result
+	SetSessionOrganization(sessionID string, userID, organizationID int) <-chan model.Result
+	GetOrganizations(userID int) <-chan model.Result
+	IsOrganizationMember(organizationID, userID int) <-chan model.Result
+	RevokeSession(sessionID string, userID int) <-chan model.Result
+	CreateImpersonationAudit(audit *auth.ImpersonationAudit) <-chan model.Result
 }
 
 func NewRepository(dbMaster *gorm.DB) Repository {
@@ -20,7 +71,7 @@ func NewRepository(dbMaster *gorm.DB) Repository {
 	}
 }
 
-// GetUser:
+// GetUser: email is compared case insensitive, user created before normalization may be stored in mixed case
 func (repo *repository) GetUser(email string) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
@@ -28,7 +79,7 @@ func (repo *repository) GetUser(email string) <-chan model.Result {
 
 		/* Process get user */
 		var user model.User
-		sql := `select * from users where email = ?`
+		sql := `select * from users where lower(email) = lower(?) and deleted_at is null`
 		if err := repo.dbMaster.Raw(sql, email).First(&user).Error; err != nil {
 			result <- model.Result{Error: err}
 			return
@@ -39,6 +90,25 @@ func (repo *repository) GetUser(email string) <-chan model.Result {
 	return result
 }
 
+// GetUserByID:
+func (repo *repository) GetUserByID(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get user */
+		var user model.User
+		sql := `select * from users where id = ? and deleted_at is null`
+		if err := repo.dbMaster.Raw(sql, id).First(&user).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: user}
+
+	}()
+	return result
+}
+
 // GetRole:
 func (repo *repository) GetRole(id int) <-chan model.Result {
 	result := make(chan model.Result)
@@ -65,3 +135,1259 @@ func (repo *repository) GetRole(id int) <-chan model.Result {
 	}()
 	return result
 }
+
+// GetPermissions: root role hold every permission
+func (repo *repository) GetPermissions(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get permissions */
+		var permissions []string
+		sql := `select permissions.code
+			from permissions
+			where exists (
+				select 1 from user_has_roles
+				inner join roles on roles.id = user_has_roles.role_id
+				where user_has_roles.user_id = ? and roles.code = 'root'
+			) or permissions.id in (
+				select role_has_permissions.permission_id from user_has_roles
+				inner join role_has_permissions on role_has_permissions.role_id = user_has_roles.role_id
+				where user_has_roles.user_id = ?
+			)
+			order by permissions.code asc
+		`
+		if err := repo.dbMaster.Raw(sql, id, id).Scan(&permissions).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: permissions}
+
+	}()
+	return result
+}
+
+// UpdatePassword:
+func (repo *repository) UpdatePassword(id int, passwordHash string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process update password */
+		sql := `update users set password = ? where id = ?`
+		if err := repo.dbMaster.Exec(sql, passwordHash, id).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// UpdateProfile:
+func (repo *repository) UpdateProfile(id int, name string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process update profile */
+		sql := `update users set name = ? where id = ? and deleted_at is null`
+		if err := repo.dbMaster.Exec(sql, name, id).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// ChangePassword: update password, end every other session of the user, and revoke access tokens issued until now,
+// the current session is kept
+func (repo *repository) ChangePassword(userID int, passwordHash, currentSessionID string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Update password */
+		tx := repo.dbMaster.Begin()
+		sql := `update users set password = ? where id = ?`
+		if err := tx.Exec(sql, passwordHash, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Revoke other sessions and their refresh tokens, access token of the session is refused by sid */
+		sql = `update refresh_tokens set revoked_at = now() where user_id = ? and family_id <> ? and revoked_at is null`
+		if err := tx.Exec(sql, userID, currentSessionID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		sql = `update sessions set revoked_at = now() where user_id = ? and id <> ? and revoked_at is null`
+		if err := tx.Exec(sql, userID, currentSessionID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Revoke access tokens without session such as impersonation token, current session continue with refresh token */
+		sql = `insert into user_token_revocations (user_id, revoked_at) values (?, now())
+			on conflict (user_id) do update set revoked_at = excluded.revoked_at`
+		if err := tx.Exec(sql, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		tx.Commit()
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// CreateSession: a login start a session with the first refresh token of the family
+func (repo *repository) CreateSession(session *model.Session, refreshToken *model.RefreshToken) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process create session */
+		tx := repo.dbMaster.Begin()
+		if err := tx.Create(session).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process create refresh token */
+		if err := tx.Create(refreshToken).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: session}
+
+	}()
+	return result
+}
+
+// GetRefreshToken:
+func (repo *repository) GetRefreshToken(tokenHash string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get refresh token */
+		var refreshToken model.RefreshToken
+		sql := `select * from refresh_tokens where token_hash = ?`
+		if err := repo.dbMaster.Raw(sql, tokenHash).First(&refreshToken).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: refreshToken}
+
+	}()
+	return result
+}
+
+// RotateRefreshToken:
+func (repo *repository) RotateRefreshToken(id int, refreshToken *model.RefreshToken) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Mark current refresh token as used, only one request can win the rotation */
+		tx := repo.dbMaster.Begin()
+		if tx.Error != nil {
+			result <- model.Result{Error: tx.Error}
+			return
+		}
+		sql := `update refresh_tokens set used_at = ? where id = ? and used_at is null and revoked_at is null`
+		process := tx.Exec(sql, time.Now(), id)
+		if process.Error != nil {
+			tx.Rollback()
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: model.ErrRefreshTokenReused}
+			return
+		}
+
+		/* Create next refresh token */
+		if err := tx.Create(refreshToken).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Update session last seen */
+		sql = `update sessions set last_seen_at = now() where id = ?`
+		if err := tx.Exec(sql, refreshToken.FamilyID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: refreshToken}
+
+	}()
+	return result
+}
+
+// RevokeRefreshTokenFamily:
+func (repo *repository) RevokeRefreshTokenFamily(familyID string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process revoke all refresh token in the family */
+		tx := repo.dbMaster.Begin()
+		sql := `update refresh_tokens set revoked_at = ? where family_id = ? and revoked_at is null`
+		if err := tx.Exec(sql, time.Now(), familyID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process end session, access tokens of the session is rejected by auth middleware */
+		sql = `update sessions set revoked_at = now() where id = ? and revoked_at is null`
+		if err := tx.Exec(sql, familyID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		tx.Commit()
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// RevokeAccessToken:
+func (repo *repository) RevokeAccessToken(jti string, userID int, expiresAt time.Time) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process revoke access token */
+		sql := `insert into revoked_tokens (jti, user_id, expires_at) values (?, ?, ?) on conflict (jti) do nothing`
+		if err := repo.dbMaster.Exec(sql, jti, userID, expiresAt).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// CreatePasswordReset: previous reset token that not used yet is invalidated
+func (repo *repository) CreatePasswordReset(passwordReset *model.PasswordReset) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Invalidate previous reset token */
+		tx := repo.dbMaster.Begin()
+		sql := `update password_resets set used_at = now() where user_id = ? and used_at is null`
+		if err := tx.Exec(sql, passwordReset.UserID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Create reset token */
+		if err := tx.Create(passwordReset).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		tx.Commit()
+		result <- model.Result{Data: passwordReset}
+
+	}()
+	return result
+}
+
+// GetPasswordReset: only unused and not expired token
+func (repo *repository) GetPasswordReset(tokenHash string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get password reset */
+		var passwordReset model.PasswordReset
+		sql := `select * from password_resets where token_hash = ? and used_at is null and expires_at > now()`
+		if err := repo.dbMaster.Raw(sql, tokenHash).First(&passwordReset).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: passwordReset}
+
+	}()
+	return result
+}
+
+// ResetPassword: consume reset token, update password, and end every session of the user
+func (repo *repository) ResetPassword(passwordResetID, userID int, passwordHash string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Consume reset token, only one request can use the token */
+		tx := repo.dbMaster.Begin()
+		sql := `update password_resets set used_at = now() where id = ? and used_at is null and expires_at > now()`
+		process := tx.Exec(sql, passwordResetID)
+		if process.Error != nil {
+			tx.Rollback()
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("Reset token not valid")}
+			return
+		}
+
+		/* Update password, the reset link was sent to the email address so the address is verified too */
+		sql = `update users set password = ?, verified_at = coalesce(verified_at, now()) where id = ?`
+		if err := tx.Exec(sql, passwordHash, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Revoke refresh tokens and access tokens */
+		sql = `update refresh_tokens set revoked_at = now() where user_id = ? and revoked_at is null`
+		if err := tx.Exec(sql, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		sql = `update sessions set revoked_at = now() where user_id = ? and revoked_at is null`
+		if err := tx.Exec(sql, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		sql = `insert into user_token_revocations (user_id, revoked_at) values (?, now())
+			on conflict (user_id) do update set revoked_at = excluded.revoked_at`
+		if err := tx.Exec(sql, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		tx.Commit()
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// GetEmailVerification: only unused and not expired token
+func (repo *repository) GetEmailVerification(tokenHash string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get email verification */
+		var emailVerification model.EmailVerification
+		sql := `select * from email_verifications where token_hash = ? and used_at is null and expires_at > now()`
+		if err := repo.dbMaster.Raw(sql, tokenHash).First(&emailVerification).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: emailVerification}
+
+	}()
+	return result
+}
+
+// VerifyEmail:
+func (repo *repository) VerifyEmail(emailVerificationID, userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Consume verification token */
+		tx := repo.dbMaster.Begin()
+		sql := `update email_verifications set used_at = now() where id = ? and used_at is null and expires_at > now()`
+		process := tx.Exec(sql, emailVerificationID)
+		if process.Error != nil {
+			tx.Rollback()
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("Verification token not valid")}
+			return
+		}
+
+		/* Mark user as verified */
+		sql = `update users set verified_at = now() where id = ? and verified_at is null`
+		if err := tx.Exec(sql, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		tx.Commit()
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// IsMFARequired: MFA is required when one of user roles require it
+func (repo *repository) IsMFARequired(userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process check roles */
+		var required bool
+		sql := `select exists(
+				select 1 from user_has_roles
+				inner join roles on roles.id = user_has_roles.role_id
+				where user_has_roles.user_id = ? and roles.mfa_required = true
+			)`
+		if err := repo.dbMaster.Raw(sql, userID).Scan(&required).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: required}
+
+	}()
+	return result
+}
+
+// GetUserMFA: user id is 0 when user not enroll MFA yet
+func (repo *repository) GetUserMFA(userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get user MFA */
+		var userMFA model.UserMFA
+		sql := `select user_id, secret, enabled_at, last_used_step, coalesce(challenge_id, '') as challenge_id, created_at from user_mfa where user_id = ?`
+		if err := repo.dbMaster.Raw(sql, userID).Scan(&userMFA).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: userMFA}
+
+	}()
+	return result
+}
+
+// SaveUserMFA: create or replace pending enrollment. Pending secret of other challenge is only replaced after it expire,
+// so a second login can not take over an enrollment in progress
+func (repo *repository) SaveUserMFA(userID int, secret, challengeID string, pendingTTL time.Duration) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process save user MFA */
+		sql := `insert into user_mfa (user_id, secret, enabled_at, last_used_step, challenge_id, created_at) values (?, ?, null, 0, nullif(?, ''), now())
+			on conflict (user_id) do update set secret = excluded.secret, enabled_at = null, last_used_step = 0, challenge_id = excluded.challenge_id, created_at = now()
+			where user_mfa.enabled_at is null
+				and (coalesce(user_mfa.challenge_id, '') = coalesce(excluded.challenge_id, '') or user_mfa.created_at < ?)`
+		process := repo.dbMaster.Exec(sql, userID, secret, challengeID, time.Now().Add(-pendingTTL))
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: errors.New("MFA already enabled or enrollment in progress")}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// CreateMFAEnrollmentCode: new code of the same challenge replace the previous one
+func (repo *repository) CreateMFAEnrollmentCode(enrollmentCode *model.MFAEnrollmentCode) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process create enrollment code, expired code no need to be kept */
+		tx := repo.dbMaster.Begin()
+		sql := `delete from user_mfa_enrollment_codes where expires_at < now() or challenge_id = ?`
+		if err := tx.Exec(sql, enrollmentCode.ChallengeID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		if err := tx.Create(enrollmentCode).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// UseMFAEnrollmentCode: code is single use and only valid for the challenge it was sent for
+func (repo *repository) UseMFAEnrollmentCode(challengeID string, userID int, codeHash string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process use enrollment code */
+		sql := `delete from user_mfa_enrollment_codes where challenge_id = ? and user_id = ? and code_hash = ? and expires_at > now()`
+		process := repo.dbMaster.Exec(sql, challengeID, userID, codeHash)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: errors.New("Enrollment code not valid")}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// EnableUserMFA: activate enrollment and replace recovery codes
+func (repo *repository) EnableUserMFA(userID int, recoveryCodeHashes []string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process enable MFA */
+		tx := repo.dbMaster.Begin()
+		sql := `update user_mfa set enabled_at = now() where user_id = ? and enabled_at is null`
+		process := tx.Exec(sql, userID)
+		if process.Error != nil {
+			tx.Rollback()
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("MFA enrollment not found")}
+			return
+		}
+
+		/* Replace recovery codes */
+		sql = `delete from user_mfa_recovery_codes where user_id = ?`
+		if err := tx.Exec(sql, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		sql = `insert into user_mfa_recovery_codes (user_id, code_hash) values (?, ?)`
+		for _, codeHash := range recoveryCodeHashes {
+			if err := tx.Exec(sql, userID, codeHash).Error; err != nil {
+				tx.Rollback()
+				result <- model.Result{Error: err}
+				return
+			}
+		}
+
+		tx.Commit()
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// DisableUserMFA:
+func (repo *repository) DisableUserMFA(userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process disable MFA */
+		tx := repo.dbMaster.Begin()
+		sql := `delete from user_mfa_recovery_codes where user_id = ?`
+		if err := tx.Exec(sql, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		sql = `delete from user_mfa where user_id = ?`
+		if err := tx.Exec(sql, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		tx.Commit()
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// UseMFAStep: code of the same or older time step can not be used again
+func (repo *repository) UseMFAStep(userID int, step int64) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process update last used step */
+		sql := `update user_mfa set last_used_step = ? where user_id = ? and last_used_step < ?`
+		process := repo.dbMaster.Exec(sql, step, userID, step)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: errors.New("MFA code already used")}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// UseRecoveryCode: recovery code can only be used once
+func (repo *repository) UseRecoveryCode(userID int, codeHash string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process use recovery code */
+		sql := `update user_mfa_recovery_codes set used_at = now() where user_id = ? and code_hash = ? and used_at is null`
+		process := repo.dbMaster.Exec(sql, userID, codeHash)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: errors.New("Recovery code not valid")}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// GetLoginLockout: latest locked until of the email or the ip, zero time when not locked
+func (repo *repository) GetLoginLockout(email, ip string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get lockout */
+		var lockedUntil *time.Time
+		sql := `select max(locked_until) from login_failures
+			where locked_until > now() and ((kind = ? and value = ?) or (kind = ? and value = ?))`
+		if err := repo.dbMaster.Raw(sql, model.LoginFailureKindEmail, email, model.LoginFailureKindIP, ip).Scan(&lockedUntil).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		if lockedUntil == nil {
+			result <- model.Result{Data: time.Time{}}
+			return
+		}
+		result <- model.Result{Data: *lockedUntil}
+
+	}()
+	return result
+}
+
+// RecordLoginFailure: failure counter restart when the last failure is older than the window
+func (repo *repository) RecordLoginFailure(kind, value string, window time.Duration) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process record failure */
+		var failures int
+		sql := `insert into login_failures (kind, value, failures, last_failed_at) values (?, ?, 1, now())
+			on conflict (kind, value) do update set
+				failures = case when login_failures.last_failed_at < now() - (? * interval '1 second') then 1 else login_failures.failures + 1 end,
+				last_failed_at = now()
+			returning failures`
+		if err := repo.dbMaster.Raw(sql, kind, value, int64(window.Seconds())).Scan(&failures).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: failures}
+
+	}()
+	return result
+}
+
+// LockLogin:
+func (repo *repository) LockLogin(kind, value string, lockedUntil time.Time) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process lock */
+		sql := `update login_failures set locked_until = ? where kind = ? and value = ?`
+		if err := repo.dbMaster.Exec(sql, lockedUntil, kind, value).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// ClearLoginFailure:
+func (repo *repository) ClearLoginFailure(kind, value string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process clear failure */
+		sql := `delete from login_failures where kind = ? and value = ?`
+		if err := repo.dbMaster.Exec(sql, kind, value).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// CreateAPIKey:
+func (repo *repository) CreateAPIKey(apiKey *model.APIKey) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process create api key */
+		if err := repo.dbMaster.Create(apiKey).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: *apiKey}
+
+	}()
+	return result
+}
+
+// GetAPIKeys:
+func (repo *repository) GetAPIKeys(userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get api keys */
+		var apiKeys []model.APIKey
+		sql := `select id, user_id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+			from api_keys where user_id = ? order by id desc`
+		if err := repo.dbMaster.Raw(sql, userID).Scan(&apiKeys).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: apiKeys}
+
+	}()
+	return result
+}
+
+// GetAPIKey:
+func (repo *repository) GetAPIKey(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get api key */
+		var apiKey model.APIKey
+		sql := `select id, user_id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+			from api_keys where id = ?`
+		if err := repo.dbMaster.Raw(sql, id).First(&apiKey).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: apiKey}
+
+	}()
+	return result
+}
+
+// RevokeAPIKey:
+func (repo *repository) RevokeAPIKey(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process revoke api key */
+		sql := `update api_keys set revoked_at = now() where id = ? and revoked_at is null`
+		process := repo.dbMaster.Exec(sql, id)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: errors.New("API key already revoked")}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// CreateOIDCState:
+func (repo *repository) CreateOIDCState(oidcState *model.OIDCState) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process create oidc state */
+		if err := repo.dbMaster.Create(oidcState).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: *oidcState}
+
+	}()
+	return result
+}
+
+// UseOIDCState: state can only be used once
+func (repo *repository) UseOIDCState(stateHash string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process use oidc state */
+		var oidcStates []model.OIDCState
+		sql := `update oidc_states set used_at = now()
+			where state_hash = ? and used_at is null and expires_at > now()
+			returning *`
+		if err := repo.dbMaster.Raw(sql, stateHash).Scan(&oidcStates).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		if len(oidcStates) == 0 {
+			result <- model.Result{Error: errors.New("OIDC state not valid")}
+			return
+		}
+		result <- model.Result{Data: oidcStates[0]}
+
+	}()
+	return result
+}
+
+// GetUserIdentity: return empty identity when not linked yet
+func (repo *repository) GetUserIdentity(provider, subject string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get user identity */
+		var userIdentity model.UserIdentity
+		sql := `select * from user_identities where provider = ? and subject = ?`
+		if err := repo.dbMaster.Raw(sql, provider, subject).Scan(&userIdentity).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: userIdentity}
+
+	}()
+	return result
+}
+
+// LinkUserIdentity: email of linked user is verified by identity provider
+func (repo *repository) LinkUserIdentity(userIdentity *model.UserIdentity) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process create user identity */
+		tx := repo.dbMaster.Begin()
+		if err := tx.Create(userIdentity).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Mark user as verified */
+		sql := `update users set verified_at = now() where id = ? and verified_at is null`
+		if err := tx.Exec(sql, userIdentity.UserID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: *userIdentity}
+
+	}()
+	return result
+}
+
+// TouchUserIdentity:
+func (repo *repository) TouchUserIdentity(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process update last login */
+		sql := `update user_identities set last_login_at = now() where id = ?`
+		if err := repo.dbMaster.Exec(sql, id).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// ProvisionUser: create user from external identity with default roles
+func (repo *repository) ProvisionUser(user *model.User, roleCodes []string, userIdentity *model.UserIdentity) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process create user */
+		tx := repo.dbMaster.Begin()
+		sql := `insert into users (name, email, password, verified_at) values (?, ?, ?, ?) returning id`
+		if err := tx.Raw(sql, user.Name, user.Email, user.Password, user.VerifiedAt).Scan(&user.ID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process create user has roles */
+		sql = `insert into user_has_roles (user_id, role_id) select ?, id from roles where code in ?`
+		process := tx.Exec(sql, user.ID, roleCodes)
+		if process.Error != nil {
+			tx.Rollback()
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("Default role not found")}
+			return
+		}
+
+		/* Process join default organization */
+		sql = `insert into organization_users (organization_id, user_id) select id, ? from organizations where code = 'default'`
+		if err := tx.Exec(sql, user.ID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process create user identity */
+		userIdentity.UserID = user.ID
+		if err := tx.Create(userIdentity).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: *user}
+
+	}()
+	return result
+}
+
+// AcceptInvitation: consume invitation token and create the invited user with the invitation roles,
+// the invitation link was sent to the email address so the address is verified
+func (repo *repository) AcceptInvitation(tokenHash string, user *model.User) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Lock invitation, only one request can use the token */
+		tx := repo.dbMaster.Begin()
+		var invitation struct {
+			ID             int
+			Email          string
+			OrganizationID int
+		}
+		sql := `select id, email, organization_id from user_invitations
+			where token_hash = ? and accepted_at is null and revoked_at is null and expires_at > now()
+			for update`
+		if err := tx.Raw(sql, tokenHash).Scan(&invitation).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		if invitation.ID == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("Invitation token not valid")}
+			return
+		}
+
+		/* Registered email check */
+		var count int64
+		sql = `select count(1) from users where lower(email) = lower(?)`
+		if err := tx.Raw(sql, invitation.Email).Scan(&count).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		if count > 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("Email already registered")}
+			return
+		}
+
+		/* Process create user */
+		user.Email = invitation.Email
+		sql = `insert into users (name, email, password, verified_at) values (?, ?, ?, now()) returning id`
+		if err := tx.Raw(sql, user.Name, user.Email, user.Password).Scan(&user.ID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process create user has roles */
+		sql = `insert into user_has_roles (user_id, role_id) select ?, role_id from user_invitation_roles where invitation_id = ?`
+		process := tx.Exec(sql, user.ID, invitation.ID)
+		if process.Error != nil {
+			tx.Rollback()
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("Invitation role not found")}
+			return
+		}
+
+		/* Process join organization of the invitation */
+		sql = `insert into organization_users (organization_id, user_id) values (?, ?)`
+		if err := tx.Exec(sql, invitation.OrganizationID, user.ID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Mark invitation accepted */
+		sql = `update user_invitations set accepted_at = now(), user_id = ? where id = ?`
+		if err := tx.Exec(sql, user.ID, invitation.ID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: *user}
+
+	}()
+	return result
+}
+
+// GetSessions: active session of the user, latest seen first
+func (repo *repository) GetSessions(userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get sessions */
+		var sessions []model.Session
+		sql := `select * from sessions where user_id = ? and revoked_at is null order by last_seen_at desc`
+		if err := repo.dbMaster.Raw(sql, userID).Scan(&sessions).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: sessions}
+
+	}()
+	return result
+}
+
+// RevokeSession: end session of the user together with its refresh token family
+func (repo *repository) RevokeSession(sessionID string, userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process end session */
+		tx := repo.dbMaster.Begin()
+		sql := `update sessions set revoked_at = now() where id = ? and user_id = ? and revoked_at is null`
+		process := tx.Exec(sql, sessionID, userID)
+		if process.Error != nil {
+			tx.Rollback()
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("Session not found")}
+			return
+		}
+
+		/* Process revoke refresh token family */
+		sql = `update refresh_tokens set revoked_at = now() where family_id = ? and revoked_at is null`
+		if err := tx.Exec(sql, sessionID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		tx.Commit()
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// CreateImpersonationAudit:
+func (repo *repository) CreateImpersonationAudit(audit *auth.ImpersonationAudit) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process create audit */
+		if err := repo.dbMaster.Create(audit).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// GetDefaultOrganization: first organization the user joined, zero when the user has no organization
+func (repo *repository) GetDefaultOrganization(userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get organization */
+		var organizationID int
+		sql := `select organization_id from organization_users where user_id = ? order by created_at asc, organization_id asc limit 1`
+		if err := repo.dbMaster.Raw(sql, userID).Scan(&organizationID).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: organizationID}
+
+	}()
+	return result
+}
+
+// GetSessionOrganization: active organization of the session, zero when the user already left the organization
+func (repo *repository) GetSessionOrganization(sessionID string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get organization */
+		var organizationID int
+		sql := `select s.organization_id from sessions s
+			inner join organization_users ou on ou.organization_id = s.organization_id and ou.user_id = s.user_id
+			where s.id = ?`
+		if err := repo.dbMaster.Raw(sql, sessionID).Scan(&organizationID).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: organizationID}
+
+	}()
+	return result
+}
+
+// SetSessionOrganization:
+func (repo *repository) SetSessionOrganization(sessionID string, userID, organizationID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process update session */
+		sql := `update sessions set organization_id = ? where id = ? and user_id = ? and revoked_at is null`
+		process := repo.dbMaster.Exec(sql, organizationID, sessionID, userID)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: errors.New("Session not found")}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// GetOrganizations: organization the user belong to
+func (repo *repository) GetOrganizations(userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get organizations */
+		organizations := []model.Organization{}
+		sql := `select o.id, o.code, o.name from organizations o
+			inner join organization_users ou on ou.organization_id = o.id
+			where ou.user_id = ?
+			order by o.name asc`
+		if err := repo.dbMaster.Raw(sql, userID).Scan(&organizations).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: organizations}
+
+	}()
+	return result
+}
+
+// IsOrganizationMember:
+func (repo *repository) IsOrganizationMember(organizationID, userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process check member */
+		var exists bool
+		sql := `select exists(select 1 from organization_users where organization_id = ? and user_id = ?)`
+		if err := repo.dbMaster.Raw(sql, organizationID, userID).Scan(&exists).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: exists}
+
+	}()
+	return result
+}
@@ -1,52 +1,487 @@
 package usecase
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"crypto/subtle"
 	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"github.com/novalwardhana/golang-boilerplate/config/jwtkey"
+	"github.com/novalwardhana/golang-boilerplate/helper/oidc"
+	"github.com/novalwardhana/golang-boilerplate/helper/password"
+	"github.com/novalwardhana/golang-boilerplate/helper/token"
+	"github.com/novalwardhana/golang-boilerplate/helper/totp"
+	"github.com/novalwardhana/golang-boilerplate/middleware/auth"
+	emailRepository "github.com/novalwardhana/golang-boilerplate/module/email/repository"
 	"github.com/novalwardhana/golang-boilerplate/module/user-authentication/model"
 	"github.com/novalwardhana/golang-boilerplate/module/user-authentication/repository"
+	"gorm.io/gorm"
 )
 
 type usecase struct {
-	repo repository.Repository
+	repo         repository.Repository
+	hasher       password.Hasher
+	emailRepo    emailRepository.Repository
+	oidcProvider *oidc.Provider
+	dummyHash    string
 }
 
 type Usecase interface {
-	UserLogin(username, password string) <-chan model.Result
+	UserLogin(username, password string, client model.Client) <-chan model.Result
+	RefreshToken(refreshToken string) <-chan model.Result
+	Logout(refreshToken, accessToken string) <-chan model.Result
+	ForgotPassword(email string) <-chan model.Result
+	ResetPassword(resetToken, newPassword string) <-chan model.Result
+	VerifyEmail(verificationToken string) <-chan model.Result
+	AcceptInvitation(request model.AcceptInvitationRequest) <-chan model.Result
+	LoginMFA(mfaToken, code, recoveryCode string, client model.Client) <-chan model.Result
+	LoginMFAEnroll(mfaToken, emailCode string) <-chan model.Result
+	EnrollMFA(userID int) <-chan model.Result
+	ActivateMFA(userID int, code string) <-chan model.Result
+	DisableMFA(userID int, code string) <-chan model.Result
+	CreateAPIKey(actorID, organizationID int, request model.APIKeyRequest) <-chan model.Result
+	GetAPIKeys(organizationID, userID int) <-chan model.Result
+	GetAPIKey(organizationID, id int) <-chan model.Result
+	RevokeAPIKey(id int) <-chan model.Result
+	OIDCAuthorize() <-chan model.Result
+	OIDCCallback(code, state, stateCookie string, client model.Client) <-chan model.Result
+	GetSessions(userID int, currentSessionID string) <-chan model.Result
+	RevokeSession(sessionID string, userID int) <-chan model.Result
+	Impersonate(actor model.JWTActor, actorIsRoot bool, organizationID int, request model.ImpersonationRequest, client model.Client) <-chan model.Result
+	GetProfile(userID int, permissions []string) <-chan model.Result
+	UpdateProfile(userID int, request model.ProfileRequest, permissions []string) <-chan model.Result
+	ChangePassword(userID int, sessionID string, request model.ChangePasswordRequest, client model.Client) <-chan model.Result
+	GetOrganizations(userID, currentOrganizationID int) <-chan model.Result
+	SwitchOrganization(userID int, sessionID string, organizationID int) <-chan model.Result
 }
 
-func NewUsecase(repo repository.Repository) Usecase {
+func NewUsecase(repo repository.Repository, hasher password.Hasher, emailRepo emailRepository.Repository, oidcProvider *oidc.Provider) Usecase {
+	/* Dummy hash is verified for unknown email so the response time not tell which email is registered */
+	dummyHash, _ := hasher.Hash("golang-boilerplate-dummy-password")
 	return &usecase{
-		repo: repo,
+		repo:         repo,
+		hasher:       hasher,
+		emailRepo:    emailRepo,
+		oidcProvider: oidcProvider,
+		dummyHash:    dummyHash,
 	}
 }
 
 // UserLogin:
-func (uc *usecase) UserLogin(email, password string) <-chan model.Result {
+func (uc *usecase) UserLogin(email, plainPassword string, client model.Client) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
+		/* Lockout check */
+		emailKey := strings.ToLower(strings.TrimSpace(email))
+		if err := uc.checkLoginLockout(emailKey, client.IP); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
 		/* Process get user */
 		processGetUser := <-uc.repo.GetUser(email)
 		if processGetUser.Error != nil {
-			result <- model.Result{Error: processGetUser.Error}
+			uc.hasher.Verify(plainPassword, uc.dummyHash)
+			result <- model.Result{Error: uc.recordLoginFailure(emailKey, client.IP, model.ErrInvalidCredential)}
 			return
 		}
 		user := processGetUser.Data.(model.User)
 
 		/* Password check */
-		passwordByte := []byte(password)
-		passwordHex := md5.Sum(passwordByte)
-		passwordHash := hex.EncodeToString(passwordHex[:])
-		if passwordHash != user.Password {
-			result <- model.Result{Error: errors.New("Password not match")}
+		match, needsRehash, err := uc.hasher.Verify(plainPassword, user.Password)
+		if err != nil || !match {
+			result <- model.Result{Error: uc.recordLoginFailure(emailKey, client.IP, model.ErrInvalidCredential)}
+			return
+		}
+
+		/* Unverified email check */
+		if user.VerifiedAt == nil && unverifiedPolicy() == unverifiedPolicyRefuse {
+			result <- model.Result{Error: errors.New("Email address not verified")}
+			return
+		}
+
+		/* Upgrade legacy or outdated hash while the plain password is known */
+		if needsRehash {
+			passwordHash, err := uc.hasher.Hash(plainPassword)
+			if err != nil {
+				result <- model.Result{Error: err}
+				return
+			}
+			if processUpdatePassword := <-uc.repo.UpdatePassword(user.ID, passwordHash); processUpdatePassword.Error != nil {
+				result <- model.Result{Error: processUpdatePassword.Error}
+				return
+			}
+		}
+
+		/* Complete login, failure counter is only cleared when no second factor is pending */
+		data, err := uc.completeLogin(user, client)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		if _, ok := data.(model.MFAChallenge); !ok {
+			<-uc.repo.ClearLoginFailure(model.LoginFailureKindEmail, emailKey)
+		}
+
+		result <- model.Result{Data: data}
+	}()
+	return result
+}
+
+// RefreshToken:
+func (uc *usecase) RefreshToken(refreshToken string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get refresh token */
+		processGetRefreshToken := <-uc.repo.GetRefreshToken(token.Hash(refreshToken))
+		if processGetRefreshToken.Error != nil {
+			result <- model.Result{Error: errors.New("Refresh token not valid")}
+			return
+		}
+		currentToken := processGetRefreshToken.Data.(model.RefreshToken)
+
+		/* Reuse detection, a used or revoked token means the token was leaked so the whole family is ended */
+		if currentToken.UsedAt != nil || currentToken.RevokedAt != nil {
+			<-uc.repo.RevokeRefreshTokenFamily(currentToken.FamilyID)
+			result <- model.Result{Error: model.ErrRefreshTokenReused}
+			return
+		}
+		if currentToken.ExpiresAt.Before(time.Now()) {
+			result <- model.Result{Error: errors.New("Refresh token expired")}
+			return
+		}
+
+		/* Process get user */
+		processGetUser := <-uc.repo.GetUserByID(currentToken.UserID)
+		if processGetUser.Error != nil {
+			result <- model.Result{Error: processGetUser.Error}
+			return
+		}
+		user := processGetUser.Data.(model.User)
+		if user.Status == model.UserStatusDisabled {
+			result <- model.Result{Error: model.ErrUserDisabled}
+			return
+		}
+		if user.VerifiedAt == nil && unverifiedPolicy() == unverifiedPolicyRefuse {
+			result <- model.Result{Error: errors.New("Email address not verified")}
+			return
+		}
+
+		/* Process get roles */
+		processGetRoles := <-uc.repo.GetRole(user.ID)
+		if processGetRoles.Error != nil {
+			result <- model.Result{Error: errors.New("User role not found")}
+			return
+		}
+		roles := processGetRoles.Data.([]model.Role)
+		if len(roles) == 0 {
+			result <- model.Result{Error: errors.New("User role not found")}
+			return
+		}
+
+		/* Active organization of the session, fallback to default organization when the user left it */
+		processGetOrganization := <-uc.repo.GetSessionOrganization(currentToken.FamilyID)
+		if processGetOrganization.Error != nil {
+			result <- model.Result{Error: processGetOrganization.Error}
+			return
+		}
+		organizationID := processGetOrganization.Data.(int)
+		if organizationID == 0 {
+			processGetDefaultOrganization := <-uc.repo.GetDefaultOrganization(user.ID)
+			if processGetDefaultOrganization.Error != nil {
+				result <- model.Result{Error: processGetDefaultOrganization.Error}
+				return
+			}
+			organizationID = processGetDefaultOrganization.Data.(int)
+			if organizationID == 0 {
+				result <- model.Result{Error: model.ErrNoOrganization}
+				return
+			}
+			<-uc.repo.SetSessionOrganization(currentToken.FamilyID, user.ID, organizationID)
+		}
+
+		/* Generate access token */
+		accessToken, err := uc.generateAccessToken(user, roles, currentToken.FamilyID, organizationID)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Rotate refresh token */
+		nextRefreshToken, nextRefreshTokenHash, err := token.Generate(32)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		processRotate := <-uc.repo.RotateRefreshToken(currentToken.ID, &model.RefreshToken{
+			UserID:    user.ID,
+			FamilyID:  currentToken.FamilyID,
+			TokenHash: nextRefreshTokenHash,
+			ExpiresAt: time.Now().Add(env.GetDuration(env.EnvJWTRefreshTokenTTL, 30*24*time.Hour)),
+		})
+		if errors.Is(processRotate.Error, model.ErrRefreshTokenReused) {
+			<-uc.repo.RevokeRefreshTokenFamily(currentToken.FamilyID)
+			result <- model.Result{Error: processRotate.Error}
+			return
+		}
+		if processRotate.Error != nil {
+			result <- model.Result{Error: processRotate.Error}
+			return
+		}
+
+		accessToken.RefreshToken = nextRefreshToken
+		result <- model.Result{Data: accessToken}
+	}()
+	return result
+}
+
+// Logout:
+func (uc *usecase) Logout(refreshToken, accessToken string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get refresh token */
+		processGetRefreshToken := <-uc.repo.GetRefreshToken(token.Hash(refreshToken))
+		if processGetRefreshToken.Error != nil {
+			result <- model.Result{Error: errors.New("Refresh token not valid")}
+			return
+		}
+		currentToken := processGetRefreshToken.Data.(model.RefreshToken)
+
+		/* Process revoke refresh token family */
+		processRevoke := <-uc.repo.RevokeRefreshTokenFamily(currentToken.FamilyID)
+		if processRevoke.Error != nil {
+			result <- model.Result{Error: processRevoke.Error}
+			return
+		}
+
+		/* Process revoke access token, token that already invalid no need to be revoked */
+		if len(accessToken) > 0 {
+			jwtData := new(model.JWTData)
+			jwtToken, err := jwt.ParseWithClaims(accessToken, jwtData, jwtkey.Keyfunc)
+			if err == nil && jwtToken.Valid && jwtData.Data.ID == currentToken.UserID && len(jwtData.Id) > 0 {
+				processRevokeAccessToken := <-uc.repo.RevokeAccessToken(jwtData.Id, jwtData.Data.ID, time.Unix(jwtData.ExpiresAt, 0))
+				if processRevokeAccessToken.Error != nil {
+					result <- model.Result{Error: processRevokeAccessToken.Error}
+					return
+				}
+			}
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// ForgotPassword: always success so the response not tell which email is registered
+func (uc *usecase) ForgotPassword(email string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get user */
+		processGetUser := <-uc.repo.GetUser(email)
+		if processGetUser.Error != nil {
+			result <- model.Result{}
+			return
+		}
+		user := processGetUser.Data.(model.User)
+
+		/* Create reset token */
+		resetToken, resetTokenHash, err := token.Generate(32)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		processCreatePasswordReset := <-uc.repo.CreatePasswordReset(&model.PasswordReset{
+			UserID:    user.ID,
+			TokenHash: resetTokenHash,
+			ExpiresAt: time.Now().Add(env.GetDuration(env.EnvPasswordResetTTL, time.Hour)),
+		})
+		if processCreatePasswordReset.Error != nil {
+			result <- model.Result{Error: processCreatePasswordReset.Error}
+			return
+		}
+
+		/* Send reset link */
+		link := fmt.Sprintf("%s?token=%s", os.Getenv(env.EnvPasswordResetURL), url.QueryEscape(resetToken))
+		text := fmt.Sprintf("Hi %s, we received a request to reset your password.<br/>"+
+			"Open <a href=\"%s\">this link</a> to choose a new password, the link is valid for one time use only.<br/>"+
+			"Ignore this email if you did not request it.", html.EscapeString(user.Name), html.EscapeString(link))
+		processSendMail := <-uc.emailRepo.SendMailDefault(user.Email, "Reset password", text)
+		if processSendMail.Error != nil {
+			result <- model.Result{Error: processSendMail.Error}
+			return
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// ResetPassword:
+func (uc *usecase) ResetPassword(resetToken, newPassword string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get password reset */
+		processGetPasswordReset := <-uc.repo.GetPasswordReset(token.Hash(resetToken))
+		if processGetPasswordReset.Error != nil {
+			result <- model.Result{Error: errors.New("Reset token not valid")}
+			return
+		}
+		passwordReset := processGetPasswordReset.Data.(model.PasswordReset)
+
+		/* Hash new password */
+		passwordHash, err := uc.hasher.Hash(newPassword)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process reset password */
+		processResetPassword := <-uc.repo.ResetPassword(passwordReset.ID, passwordReset.UserID, passwordHash)
+		if processResetPassword.Error != nil {
+			result <- model.Result{Error: processResetPassword.Error}
+			return
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// AcceptInvitation: invitee set their own name and password, login is done separately
+func (uc *usecase) AcceptInvitation(request model.AcceptInvitationRequest) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Hash password */
+		passwordHash, err := uc.hasher.Hash(request.Password)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process accept invitation */
+		user := model.User{Name: strings.TrimSpace(request.Name), Password: passwordHash}
+		processAcceptInvitation := <-uc.repo.AcceptInvitation(token.Hash(request.Token), &user)
+		if processAcceptInvitation.Error != nil {
+			result <- model.Result{Error: processAcceptInvitation.Error}
+			return
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// VerifyEmail:
+func (uc *usecase) VerifyEmail(verificationToken string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get email verification */
+		processGetEmailVerification := <-uc.repo.GetEmailVerification(token.Hash(verificationToken))
+		if processGetEmailVerification.Error != nil {
+			result <- model.Result{Error: errors.New("Verification token not valid")}
+			return
+		}
+		emailVerification := processGetEmailVerification.Data.(model.EmailVerification)
+
+		/* Process verify email */
+		processVerifyEmail := <-uc.repo.VerifyEmail(emailVerification.ID, emailVerification.UserID)
+		if processVerifyEmail.Error != nil {
+			result <- model.Result{Error: processVerifyEmail.Error}
+			return
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// LoginMFA: second login step, a valid code on pending enrollment also activate the enrollment
+func (uc *usecase) LoginMFA(mfaToken, code, recoveryCode string, client model.Client) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* MFA token validation */
+		userID, challengeID, err := parseMFAChallenge(mfaToken)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process get user */
+		processGetUser := <-uc.repo.GetUserByID(userID)
+		if processGetUser.Error != nil {
+			result <- model.Result{Error: processGetUser.Error}
+			return
+		}
+		user := processGetUser.Data.(model.User)
+		if user.Status == model.UserStatusDisabled {
+			result <- model.Result{Error: model.ErrUserDisabled}
+			return
+		}
+
+		/* Lockout check, wrong MFA code count as failed login attempt */
+		emailKey := strings.ToLower(strings.TrimSpace(user.Email))
+		if err := uc.checkLoginLockout(emailKey, client.IP); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process get user MFA */
+		processGetUserMFA := <-uc.repo.GetUserMFA(user.ID)
+		if processGetUserMFA.Error != nil {
+			result <- model.Result{Error: processGetUserMFA.Error}
 			return
 		}
+		userMFA := processGetUserMFA.Data.(model.UserMFA)
+		if userMFA.UserID == 0 || (userMFA.EnabledAt == nil && userMFA.ChallengeID != challengeID) {
+			result <- model.Result{Error: errors.New("MFA enrollment required")}
+			return
+		}
+
+		/* Code validation, recovery code only for enabled MFA */
+		var recoveryCodes []string
+		if len(recoveryCode) > 0 && userMFA.EnabledAt != nil {
+			processUseRecoveryCode := <-uc.repo.UseRecoveryCode(user.ID, token.Hash(normalizeRecoveryCode(recoveryCode)))
+			if processUseRecoveryCode.Error != nil {
+				result <- model.Result{Error: uc.recordLoginFailure(emailKey, client.IP, processUseRecoveryCode.Error)}
+				return
+			}
+		} else {
+			if err := uc.verifyMFACode(userMFA, code); err != nil {
+				result <- model.Result{Error: uc.recordLoginFailure(emailKey, client.IP, err)}
+				return
+			}
+			if userMFA.EnabledAt == nil {
+				recoveryCodes, err = uc.activateMFA(user.ID)
+				if err != nil {
+					result <- model.Result{Error: err}
+					return
+				}
+			}
+		}
+		<-uc.repo.ClearLoginFailure(model.LoginFailureKindEmail, emailKey)
 
 		/* Process get roles */
 		processGetRoles := <-uc.repo.GetRole(user.ID)
@@ -60,28 +495,1252 @@ func (uc *usecase) UserLogin(email, password string) <-chan model.Result {
 			return
 		}
 
-		/* Generate JWT */
-		jwtData := model.JWTData{
-			StandardClaims: jwt.StandardClaims{
-				Issuer:    "Golang Boilerplate",
-				IssuedAt:  time.Now().Unix(),
-				ExpiresAt: time.Now().AddDate(0, 0, 1).Unix(),
-			},
-			Data: model.JWTUserData{
-				ID:    user.ID,
-				Name:  user.Name,
-				Email: user.Email,
-				Roles: roles,
-			},
+		/* Issue token */
+		issuedToken, err := uc.issueToken(user, roles, client)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		issuedToken.RecoveryCodes = recoveryCodes
+
+		result <- model.Result{Data: issuedToken}
+	}()
+	return result
+}
+
+// LoginMFAEnroll: enrollment during login for user whose role require MFA. The password alone is not enough,
+// without email code a code is sent to the user email, the secret is only returned for the right code
+func (uc *usecase) LoginMFAEnroll(mfaToken, emailCode string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* MFA token validation */
+		userID, challengeID, err := parseMFAChallenge(mfaToken)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process get user */
+		processGetUser := <-uc.repo.GetUserByID(userID)
+		if processGetUser.Error != nil {
+			result <- model.Result{Error: processGetUser.Error}
+			return
+		}
+		user := processGetUser.Data.(model.User)
+		if user.Status == model.UserStatusDisabled {
+			result <- model.Result{Error: model.ErrUserDisabled}
+			return
+		}
+
+		/* Send enrollment code */
+		if len(emailCode) == 0 {
+			if err := uc.sendMFAEnrollmentCode(user, challengeID); err != nil {
+				result <- model.Result{Error: err}
+				return
+			}
+			result <- model.Result{}
+			return
+		}
+
+		/* Enrollment code validation */
+		processUseCode := <-uc.repo.UseMFAEnrollmentCode(challengeID, user.ID, token.Hash(normalizeRecoveryCode(emailCode)))
+		if processUseCode.Error != nil {
+			result <- model.Result{Error: processUseCode.Error}
+			return
 		}
-		jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtData)
-		jwtString, err := jwtToken.SignedString(model.JWTSignatureKey)
+
+		/* Enroll process */
+		enrollment, err := uc.enrollMFA(user, challengeID)
 		if err != nil {
 			result <- model.Result{Error: err}
 			return
 		}
+		result <- model.Result{Data: enrollment}
+	}()
+	return result
+}
+
+// EnrollMFA: create pending secret, MFA is enabled after the first valid code
+func (uc *usecase) EnrollMFA(userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get user */
+		processGetUser := <-uc.repo.GetUserByID(userID)
+		if processGetUser.Error != nil {
+			result <- model.Result{Error: processGetUser.Error}
+			return
+		}
+		user := processGetUser.Data.(model.User)
 
-		result <- model.Result{Data: jwtString}
+		/* Enroll process */
+		enrollment, err := uc.enrollMFA(user, "")
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: enrollment}
 	}()
 	return result
 }
+
+// ActivateMFA:
+func (uc *usecase) ActivateMFA(userID int, code string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get user MFA */
+		processGetUserMFA := <-uc.repo.GetUserMFA(userID)
+		if processGetUserMFA.Error != nil {
+			result <- model.Result{Error: processGetUserMFA.Error}
+			return
+		}
+		userMFA := processGetUserMFA.Data.(model.UserMFA)
+		if userMFA.EnabledAt != nil {
+			result <- model.Result{Error: errors.New("MFA already enabled")}
+			return
+		}
+		if userMFA.UserID == 0 || len(userMFA.ChallengeID) > 0 {
+			result <- model.Result{Error: errors.New("MFA enrollment not found")}
+			return
+		}
+
+		/* Code validation */
+		if err := uc.verifyMFACode(userMFA, code); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Activate process */
+		recoveryCodes, err := uc.activateMFA(userID)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		result <- model.Result{Data: recoveryCodes}
+	}()
+	return result
+}
+
+// DisableMFA: user whose role require MFA can not disable it
+func (uc *usecase) DisableMFA(userID int, code string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Role check */
+		processIsMFARequired := <-uc.repo.IsMFARequired(userID)
+		if processIsMFARequired.Error != nil {
+			result <- model.Result{Error: processIsMFARequired.Error}
+			return
+		}
+		if processIsMFARequired.Data.(bool) {
+			result <- model.Result{Error: errors.New("MFA is required by user role")}
+			return
+		}
+
+		/* Process get user MFA */
+		processGetUserMFA := <-uc.repo.GetUserMFA(userID)
+		if processGetUserMFA.Error != nil {
+			result <- model.Result{Error: processGetUserMFA.Error}
+			return
+		}
+		userMFA := processGetUserMFA.Data.(model.UserMFA)
+		if userMFA.EnabledAt == nil {
+			result <- model.Result{Error: errors.New("MFA not enabled")}
+			return
+		}
+
+		/* Code validation */
+		if err := uc.verifyMFACode(userMFA, code); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Disable process */
+		processDisable := <-uc.repo.DisableUserMFA(userID)
+		if processDisable.Error != nil {
+			result <- model.Result{Error: processDisable.Error}
+			return
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// CreateAPIKey: scopes must be part of both the owner and the actor permissions, the key is only shown once.
+// Key of other user is only created for member of the actor organization whose roles are all held by the actor,
+// the key act with the owner roles so it must not give the actor more than what the actor already has
+func (uc *usecase) CreateAPIKey(actorID, organizationID int, request model.APIKeyRequest) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Expired validation */
+		if request.ExpiresAt != nil && request.ExpiresAt.Before(time.Now()) {
+			result <- model.Result{Error: errors.New("Expired at must be in the future")}
+			return
+		}
+
+		/* Owner validation */
+		if request.UserID != actorID {
+			if err := uc.checkAPIKeyOwner(actorID, organizationID, request.UserID); err != nil {
+				result <- model.Result{Error: err}
+				return
+			}
+		}
+
+		/* Scope validation */
+		for _, userID := range []int{request.UserID, actorID} {
+			processGetPermissions := <-uc.repo.GetPermissions(userID)
+			if processGetPermissions.Error != nil {
+				result <- model.Result{Error: processGetPermissions.Error}
+				return
+			}
+			permissions := processGetPermissions.Data.([]string)
+			for _, scope := range request.Scopes {
+				if !containsString(permissions, scope) {
+					result <- model.Result{Error: fmt.Errorf("User not have permission %s", scope)}
+					return
+				}
+			}
+		}
+
+		/* Generate key */
+		key, prefix, keyHash, err := token.GenerateAPIKey()
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		apiKey := model.APIKey{
+			UserID:    request.UserID,
+			Name:      request.Name,
+			Prefix:    prefix,
+			KeyHash:   keyHash,
+			Scopes:    strings.Join(request.Scopes, ","),
+			ExpiresAt: request.ExpiresAt,
+			CreatedAt: time.Now(),
+		}
+		processCreateAPIKey := <-uc.repo.CreateAPIKey(&apiKey)
+		if processCreateAPIKey.Error != nil {
+			result <- model.Result{Error: processCreateAPIKey.Error}
+			return
+		}
+
+		result <- model.Result{Data: model.NewAPIKey{APIKey: processCreateAPIKey.Data.(model.APIKey), Key: key}}
+	}()
+	return result
+}
+
+// GetAPIKeys: owner must be member of the organization
+func (uc *usecase) GetAPIKeys(organizationID, userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Member check */
+		processIsMember := <-uc.repo.IsOrganizationMember(organizationID, userID)
+		if processIsMember.Error != nil {
+			result <- model.Result{Error: processIsMember.Error}
+			return
+		}
+		if !processIsMember.Data.(bool) {
+			result <- model.Result{Error: errors.New("User not found")}
+			return
+		}
+
+		/* Process get api keys */
+		process := <-uc.repo.GetAPIKeys(userID)
+		result <- process
+	}()
+	return result
+}
+
+// GetAPIKey: key of user outside the organization is not found
+func (uc *usecase) GetAPIKey(organizationID, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get api key */
+		process := <-uc.repo.GetAPIKey(id)
+		if process.Error != nil {
+			result <- process
+			return
+		}
+
+		/* Member check */
+		processIsMember := <-uc.repo.IsOrganizationMember(organizationID, process.Data.(model.APIKey).UserID)
+		if processIsMember.Error != nil {
+			result <- model.Result{Error: processIsMember.Error}
+			return
+		}
+		if !processIsMember.Data.(bool) {
+			result <- model.Result{Error: errors.New("API key not found")}
+			return
+		}
+		result <- process
+	}()
+	return result
+}
+
+// RevokeAPIKey:
+func (uc *usecase) RevokeAPIKey(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process revoke api key */
+		process := <-uc.repo.RevokeAPIKey(id)
+		result <- process
+	}()
+	return result
+}
+
+// GetSessions: current session is marked so client can show "this device"
+func (uc *usecase) GetSessions(userID int, currentSessionID string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get sessions */
+		processGetSessions := <-uc.repo.GetSessions(userID)
+		if processGetSessions.Error != nil {
+			result <- model.Result{Error: processGetSessions.Error}
+			return
+		}
+		sessions := processGetSessions.Data.([]model.Session)
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == currentSessionID
+		}
+
+		result <- model.Result{Data: sessions}
+	}()
+	return result
+}
+
+// RevokeSession:
+func (uc *usecase) RevokeSession(sessionID string, userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process revoke session */
+		process := <-uc.repo.RevokeSession(sessionID, userID)
+		result <- process
+	}()
+	return result
+}
+
+// GetProfile: permissions is taken from the request context, so it follow API key scopes
+func (uc *usecase) GetProfile(userID int, permissions []string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get user */
+		processGetUser := <-uc.repo.GetUserByID(userID)
+		if processGetUser.Error != nil {
+			result <- model.Result{Error: errors.New("User not found")}
+			return
+		}
+		user := processGetUser.Data.(model.User)
+
+		/* Process get roles */
+		processGetRoles := <-uc.repo.GetRole(user.ID)
+		if processGetRoles.Error != nil {
+			result <- model.Result{Error: processGetRoles.Error}
+			return
+		}
+
+		/* Process get user MFA */
+		processGetUserMFA := <-uc.repo.GetUserMFA(user.ID)
+		if processGetUserMFA.Error != nil {
+			result <- model.Result{Error: processGetUserMFA.Error}
+			return
+		}
+
+		if permissions == nil {
+			permissions = []string{}
+		}
+		result <- model.Result{Data: model.Profile{
+			ID:          user.ID,
+			Name:        user.Name,
+			Email:       user.Email,
+			VerifiedAt:  user.VerifiedAt,
+			MFAEnabled:  processGetUserMFA.Data.(model.UserMFA).EnabledAt != nil,
+			Roles:       processGetRoles.Data.([]model.Role),
+			Permissions: permissions,
+		}}
+	}()
+	return result
+}
+
+// UpdateProfile: only name can be changed, email and roles are managed by administrator
+func (uc *usecase) UpdateProfile(userID int, request model.ProfileRequest, permissions []string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process update profile */
+		processUpdateProfile := <-uc.repo.UpdateProfile(userID, strings.TrimSpace(request.Name))
+		if processUpdateProfile.Error != nil {
+			result <- model.Result{Error: processUpdateProfile.Error}
+			return
+		}
+
+		/* Process get profile */
+		result <- <-uc.GetProfile(userID, permissions)
+	}()
+	return result
+}
+
+// ChangePassword: wrong current password count as failed login attempt so it can not be brute forced
+func (uc *usecase) ChangePassword(userID int, sessionID string, request model.ChangePasswordRequest, client model.Client) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get user */
+		processGetUser := <-uc.repo.GetUserByID(userID)
+		if processGetUser.Error != nil {
+			result <- model.Result{Error: errors.New("User not found")}
+			return
+		}
+		user := processGetUser.Data.(model.User)
+
+		/* Lockout check */
+		emailKey := strings.ToLower(strings.TrimSpace(user.Email))
+		if err := uc.checkLoginLockout(emailKey, client.IP); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Current password check */
+		match, _, err := uc.hasher.Verify(request.CurrentPassword, user.Password)
+		if err != nil || !match {
+			result <- model.Result{Error: uc.recordLoginFailure(emailKey, client.IP, errors.New("Current password not valid"))}
+			return
+		}
+		<-uc.repo.ClearLoginFailure(model.LoginFailureKindEmail, emailKey)
+
+		/* Hash new password */
+		passwordHash, err := uc.hasher.Hash(request.NewPassword)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process change password */
+		processChangePassword := <-uc.repo.ChangePassword(user.ID, passwordHash, sessionID)
+		if processChangePassword.Error != nil {
+			result <- model.Result{Error: processChangePassword.Error}
+			return
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// GetOrganizations:
+func (uc *usecase) GetOrganizations(userID, currentOrganizationID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get organizations */
+		processGetOrganizations := <-uc.repo.GetOrganizations(userID)
+		if processGetOrganizations.Error != nil {
+			result <- model.Result{Error: processGetOrganizations.Error}
+			return
+		}
+		organizations := processGetOrganizations.Data.([]model.Organization)
+		for i := range organizations {
+			organizations[i].Current = organizations[i].ID == currentOrganizationID
+		}
+
+		result <- model.Result{Data: organizations}
+	}()
+	return result
+}
+
+// SwitchOrganization: change active organization of the session and return access token of the organization,
+// refresh token of the session keep working and follow the new organization
+func (uc *usecase) SwitchOrganization(userID int, sessionID string, organizationID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Member check */
+		processIsMember := <-uc.repo.IsOrganizationMember(organizationID, userID)
+		if processIsMember.Error != nil {
+			result <- model.Result{Error: processIsMember.Error}
+			return
+		}
+		if !processIsMember.Data.(bool) {
+			result <- model.Result{Error: errors.New("Organization not found")}
+			return
+		}
+
+		/* Process get user and roles */
+		processGetUser := <-uc.repo.GetUserByID(userID)
+		if processGetUser.Error != nil {
+			result <- model.Result{Error: errors.New("User not found")}
+			return
+		}
+		user := processGetUser.Data.(model.User)
+		processGetRoles := <-uc.repo.GetRole(user.ID)
+		if processGetRoles.Error != nil {
+			result <- model.Result{Error: errors.New("User role not found")}
+			return
+		}
+
+		/* Process update session */
+		processSetSessionOrganization := <-uc.repo.SetSessionOrganization(sessionID, user.ID, organizationID)
+		if processSetSessionOrganization.Error != nil {
+			result <- model.Result{Error: processSetSessionOrganization.Error}
+			return
+		}
+
+		/* Generate access token */
+		accessToken, err := uc.generateAccessToken(user, processGetRoles.Data.([]model.Role), sessionID, organizationID)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		result <- model.Result{Data: accessToken}
+	}()
+	return result
+}
+
+// Impersonate: short lived access token of another user without refresh token, the real user is kept in act claim
+// the target must be member of the organization the actor currently act in and not hold any role the actor does not hold
+func (uc *usecase) Impersonate(actor model.JWTActor, actorIsRoot bool, organizationID int, request model.ImpersonationRequest, client model.Client) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Target validation */
+		if request.UserID == actor.ID {
+			result <- model.Result{Error: errors.New("Can not impersonate yourself")}
+			return
+		}
+		processGetUser := <-uc.repo.GetUserByID(request.UserID)
+		if processGetUser.Error != nil {
+			result <- model.Result{Error: errors.New("User not found")}
+			return
+		}
+		user := processGetUser.Data.(model.User)
+		if user.Status == model.UserStatusDisabled {
+			result <- model.Result{Error: model.ErrUserDisabled}
+			return
+		}
+		processIsMember := <-uc.repo.IsOrganizationMember(organizationID, user.ID)
+		if processIsMember.Error != nil {
+			result <- model.Result{Error: processIsMember.Error}
+			return
+		}
+		if !processIsMember.Data.(bool) {
+			result <- model.Result{Error: errors.New("User not found")}
+			return
+		}
+		processGetRoles := <-uc.repo.GetRole(user.ID)
+		if processGetRoles.Error != nil {
+			result <- model.Result{Error: errors.New("User role not found")}
+			return
+		}
+		roles := processGetRoles.Data.([]model.Role)
+		for _, role := range roles {
+			if role.Code == "root" && !actorIsRoot {
+				result <- model.Result{Error: errors.New("Only root can impersonate root user")}
+				return
+			}
+		}
+		roleCode, err := uc.roleOutsideActor(actor.ID, roles)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		if len(roleCode) > 0 {
+			result <- model.Result{Error: fmt.Errorf("Can not impersonate user with role %s", roleCode)}
+			return
+		}
+
+		/* Generate token */
+		ttl := env.GetDuration(env.EnvImpersonationTTL, 15*time.Minute)
+		jwtData, err := uc.accessClaims(user, roles, ttl)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		jwtData.Actor = &actor
+		jwtData.OrganizationID = organizationID
+		jwtString, err := jwtkey.Sign(jwtData)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Audit start of impersonation */
+		processCreateAudit := <-uc.repo.CreateImpersonationAudit(&auth.ImpersonationAudit{
+			ActorID: actor.ID,
+			UserID:  user.ID,
+			JTI:     jwtData.Id,
+			Action:  auth.ImpersonationActionStart,
+			IP:      client.IP,
+			Reason:  request.Reason,
+		})
+		if processCreateAudit.Error != nil {
+			result <- model.Result{Error: processCreateAudit.Error}
+			return
+		}
+
+		result <- model.Result{Data: model.Token{
+			AccessToken: jwtString,
+			TokenType:   "Bearer",
+			ExpiresIn:   int64(ttl.Seconds()),
+		}}
+	}()
+	return result
+}
+
+// OIDCAuthorize: create state, nonce, and PKCE verifier then return authorization url of identity provider
+func (uc *usecase) OIDCAuthorize() <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Generate state, nonce, and code verifier */
+		state, stateHash, err := token.Generate(32)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		nonce, _, err := token.Generate(32)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		codeVerifier, err := oidc.NewCodeVerifier()
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Authorization url */
+		authorizationURL, err := uc.oidcProvider.AuthCodeURL(state, nonce, oidc.CodeChallenge(codeVerifier))
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Process save state */
+		ttl := env.GetDuration(env.EnvOIDCStateTTL, 10*time.Minute)
+		oidcState := model.OIDCState{
+			StateHash:    stateHash,
+			CodeVerifier: codeVerifier,
+			Nonce:        nonce,
+			ExpiresAt:    time.Now().Add(ttl),
+			CreatedAt:    time.Now(),
+		}
+		processCreateOIDCState := <-uc.repo.CreateOIDCState(&oidcState)
+		if processCreateOIDCState.Error != nil {
+			result <- model.Result{Error: processCreateOIDCState.Error}
+			return
+		}
+
+		/* State cookie bind the state to the browser that start the login */
+		stateCookie, err := jwtkey.Sign(jwt.StandardClaims{
+			Audience:  model.AudienceOIDCState,
+			Subject:   stateHash,
+			Issuer:    "Golang Boilerplate",
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		})
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		result <- model.Result{Data: model.OIDCAuthorization{
+			AuthorizationURL: authorizationURL,
+			State:            state,
+			StateCookie:      stateCookie,
+			ExpiresIn:        int64(ttl.Seconds()),
+		}}
+	}()
+	return result
+}
+
+// OIDCCallback: exchange code, map external subject to user (provision when not exists), then continue as normal login
+func (uc *usecase) OIDCCallback(code, state, stateCookie string, client model.Client) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* State validation, state must belong to the browser cookie before it is used */
+		if err := verifyOIDCStateCookie(stateCookie, state); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		processUseOIDCState := <-uc.repo.UseOIDCState(token.Hash(state))
+		if processUseOIDCState.Error != nil {
+			result <- model.Result{Error: processUseOIDCState.Error}
+			return
+		}
+		oidcState := processUseOIDCState.Data.(model.OIDCState)
+
+		/* Exchange code and verify ID token */
+		tokenResponse, err := uc.oidcProvider.Exchange(code, oidcState.CodeVerifier)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		claims, err := uc.oidcProvider.VerifyIDToken(tokenResponse.IDToken, oidcState.Nonce)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Map identity to user */
+		user, err := uc.getOIDCUser(claims)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Complete login */
+		data, err := uc.completeLogin(user, client)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		result <- model.Result{Data: data}
+	}()
+	return result
+}
+
+// getOIDCUser: identity is linked by subject, existing user is only linked by email when identity provider verified the email
+func (uc *usecase) getOIDCUser(claims oidc.Claims) (model.User, error) {
+
+	/* Linked identity */
+	processGetUserIdentity := <-uc.repo.GetUserIdentity(uc.oidcProvider.Name(), claims.Subject)
+	if processGetUserIdentity.Error != nil {
+		return model.User{}, processGetUserIdentity.Error
+	}
+	if userIdentity := processGetUserIdentity.Data.(model.UserIdentity); userIdentity.ID != 0 {
+		processGetUser := <-uc.repo.GetUserByID(userIdentity.UserID)
+		if processGetUser.Error != nil {
+			return model.User{}, processGetUser.Error
+		}
+		<-uc.repo.TouchUserIdentity(userIdentity.ID)
+		return processGetUser.Data.(model.User), nil
+	}
+
+	/* Email validation */
+	claims.Email = strings.ToLower(strings.TrimSpace(claims.Email))
+	if len(claims.Email) == 0 {
+		return model.User{}, errors.New("Identity provider not return email")
+	}
+	if !claims.EmailVerified {
+		return model.User{}, errors.New("Email address not verified by identity provider")
+	}
+	now := time.Now()
+	userIdentity := model.UserIdentity{
+		Provider:    uc.oidcProvider.Name(),
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+		CreatedAt:   now,
+	}
+
+	/* Link existing user, link also mark the user as verified so the user is loaded again */
+	processGetUser := <-uc.repo.GetUser(claims.Email)
+	if processGetUser.Error == nil {
+		userIdentity.UserID = processGetUser.Data.(model.User).ID
+		processLinkUserIdentity := <-uc.repo.LinkUserIdentity(&userIdentity)
+		if processLinkUserIdentity.Error != nil {
+			return model.User{}, processLinkUserIdentity.Error
+		}
+		processGetLinkedUser := <-uc.repo.GetUserByID(userIdentity.UserID)
+		if processGetLinkedUser.Error != nil {
+			return model.User{}, processGetLinkedUser.Error
+		}
+		return processGetLinkedUser.Data.(model.User), nil
+	}
+	if !errors.Is(processGetUser.Error, gorm.ErrRecordNotFound) {
+		return model.User{}, processGetUser.Error
+	}
+
+	/* Provision user, local password is random so the user can only login by identity provider or reset password */
+	randomPassword, _, err := token.Generate(32)
+	if err != nil {
+		return model.User{}, err
+	}
+	passwordHash, err := uc.hasher.Hash(randomPassword)
+	if err != nil {
+		return model.User{}, err
+	}
+	name := claims.Name
+	if len(name) == 0 {
+		name = claims.Email
+	}
+	roleCodes := strings.Split(os.Getenv(env.EnvOIDCDefaultRoles), ",")
+	if len(os.Getenv(env.EnvOIDCDefaultRoles)) == 0 {
+		roleCodes = []string{"user"}
+	}
+	for i := range roleCodes {
+		roleCodes[i] = strings.TrimSpace(roleCodes[i])
+	}
+	user := model.User{
+		Name:       name,
+		Email:      claims.Email,
+		Password:   passwordHash,
+		VerifiedAt: &now,
+	}
+	processProvisionUser := <-uc.repo.ProvisionUser(&user, roleCodes, &userIdentity)
+	if processProvisionUser.Error != nil {
+		return model.User{}, processProvisionUser.Error
+	}
+	return processProvisionUser.Data.(model.User), nil
+}
+
+// verifyMFACode:
+func (uc *usecase) verifyMFACode(userMFA model.UserMFA, code string) error {
+	step, valid := totp.Validate(userMFA.Secret, code, time.Now())
+	if !valid {
+		return errors.New("MFA code not valid")
+	}
+	processUseMFAStep := <-uc.repo.UseMFAStep(userMFA.UserID, step)
+	return processUseMFAStep.Error
+}
+
+// enrollMFA: challenge id is empty for signed in user
+func (uc *usecase) enrollMFA(user model.User, challengeID string) (model.MFAEnrollment, error) {
+
+	/* Generate secret */
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return model.MFAEnrollment{}, err
+	}
+	processSaveUserMFA := <-uc.repo.SaveUserMFA(user.ID, secret, challengeID, env.GetDuration(env.EnvMFAChallengeTTL, 5*time.Minute))
+	if processSaveUserMFA.Error != nil {
+		return model.MFAEnrollment{}, processSaveUserMFA.Error
+	}
+
+	issuer := os.Getenv(env.EnvMFAIssuer)
+	if len(issuer) == 0 {
+		issuer = "Golang Boilerplate"
+	}
+	return model.MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(issuer, user.Email, secret),
+	}, nil
+}
+
+// sendMFAEnrollmentCode: code is valid as long as the challenge
+func (uc *usecase) sendMFAEnrollmentCode(user model.User, challengeID string) error {
+
+	/* MFA already enabled no need enrollment */
+	processGetUserMFA := <-uc.repo.GetUserMFA(user.ID)
+	if processGetUserMFA.Error != nil {
+		return processGetUserMFA.Error
+	}
+	if processGetUserMFA.Data.(model.UserMFA).EnabledAt != nil {
+		return errors.New("MFA already enabled")
+	}
+
+	/* Create enrollment code, same format as recovery code */
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return err
+	}
+	enrollmentCode := strings.ToLower(secret[0:4] + "-" + secret[4:8] + "-" + secret[8:12])
+	processCreate := <-uc.repo.CreateMFAEnrollmentCode(&model.MFAEnrollmentCode{
+		ChallengeID: challengeID,
+		UserID:      user.ID,
+		CodeHash:    token.Hash(enrollmentCode),
+		ExpiresAt:   time.Now().Add(env.GetDuration(env.EnvMFAChallengeTTL, 5*time.Minute)),
+	})
+	if processCreate.Error != nil {
+		return processCreate.Error
+	}
+
+	/* Send enrollment code */
+	text := fmt.Sprintf("Hi %s, your two-factor enrollment code is <b>%s</b>.<br/>"+
+		"Ignore this email and change your password if you are not signing in right now.", html.EscapeString(user.Name), enrollmentCode)
+	processSendMail := <-uc.emailRepo.SendMailDefault(user.Email, "Two-factor enrollment code", text)
+	return processSendMail.Error
+}
+
+// activateMFA: recovery codes only shown once, database only keep the hash
+func (uc *usecase) activateMFA(userID int) ([]string, error) {
+	var recoveryCodes []string
+	var recoveryCodeHashes []string
+	for i := 0; i < 10; i++ {
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			return nil, err
+		}
+		recoveryCode := strings.ToLower(secret[0:4] + "-" + secret[4:8] + "-" + secret[8:12])
+		recoveryCodes = append(recoveryCodes, recoveryCode)
+		recoveryCodeHashes = append(recoveryCodeHashes, token.Hash(recoveryCode))
+	}
+	processEnable := <-uc.repo.EnableUserMFA(userID, recoveryCodeHashes)
+	if processEnable.Error != nil {
+		return nil, processEnable.Error
+	}
+	return recoveryCodes, nil
+}
+
+// completeLogin: user already pass the first factor, return MFA challenge when second factor is needed or issue token
+func (uc *usecase) completeLogin(user model.User, client model.Client) (interface{}, error) {
+
+	/* Status check */
+	if user.Status == model.UserStatusDisabled {
+		return nil, model.ErrUserDisabled
+	}
+
+	/* Process get roles */
+	processGetRoles := <-uc.repo.GetRole(user.ID)
+	if processGetRoles.Error != nil {
+		return nil, errors.New("User role not found")
+	}
+	roles := processGetRoles.Data.([]model.Role)
+	if len(roles) == 0 {
+		return nil, errors.New("User role not found")
+	}
+
+	/* MFA check, second step is required when user enable MFA or one of the roles require it */
+	processGetUserMFA := <-uc.repo.GetUserMFA(user.ID)
+	if processGetUserMFA.Error != nil {
+		return nil, processGetUserMFA.Error
+	}
+	mfaEnabled := processGetUserMFA.Data.(model.UserMFA).EnabledAt != nil
+	processIsMFARequired := <-uc.repo.IsMFARequired(user.ID)
+	if processIsMFARequired.Error != nil {
+		return nil, processIsMFARequired.Error
+	}
+	if mfaEnabled || processIsMFARequired.Data.(bool) {
+		return uc.generateMFAChallenge(user, !mfaEnabled)
+	}
+
+	/* Issue token */
+	return uc.issueToken(user, roles, client)
+}
+
+// generateMFAChallenge: short lived token that only accepted by MFA login endpoint
+func (uc *usecase) generateMFAChallenge(user model.User, enrollmentRequired bool) (model.MFAChallenge, error) {
+	ttl := env.GetDuration(env.EnvMFAChallengeTTL, 5*time.Minute)
+	challengeID, err := token.NewID()
+	if err != nil {
+		return model.MFAChallenge{}, err
+	}
+	mfaToken, err := jwtkey.Sign(jwt.StandardClaims{
+		Id:        challengeID,
+		Audience:  model.AudienceMFA,
+		Subject:   strconv.Itoa(user.ID),
+		Issuer:    "Golang Boilerplate",
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	})
+	if err != nil {
+		return model.MFAChallenge{}, err
+	}
+	return model.MFAChallenge{
+		MFARequired:        true,
+		EnrollmentRequired: enrollmentRequired,
+		MFAToken:           mfaToken,
+		ExpiresIn:          int64(ttl.Seconds()),
+	}, nil
+}
+
+// parseMFAChallenge: return user id and id of the challenge
+func parseMFAChallenge(mfaToken string) (int, string, error) {
+	claims := new(jwt.StandardClaims)
+	jwtToken, err := jwt.ParseWithClaims(mfaToken, claims, jwtkey.Keyfunc)
+	if err != nil || !jwtToken.Valid || claims.Audience != model.AudienceMFA || len(claims.Id) == 0 {
+		return 0, "", errors.New("MFA token not valid")
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, "", errors.New("MFA token not valid")
+	}
+	return userID, claims.Id, nil
+}
+
+// verifyOIDCStateCookie: state cookie is signed and only valid for the state it was issued with, prevent login CSRF
+func verifyOIDCStateCookie(stateCookie, state string) error {
+	claims := new(jwt.StandardClaims)
+	jwtToken, err := jwt.ParseWithClaims(stateCookie, claims, jwtkey.Keyfunc)
+	if err != nil || !jwtToken.Valid || claims.Audience != model.AudienceOIDCState {
+		return errors.New("OIDC state not valid")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Subject), []byte(token.Hash(state))) != 1 {
+		return errors.New("OIDC state not valid")
+	}
+	return nil
+}
+
+func normalizeRecoveryCode(recoveryCode string) string {
+	return strings.ToLower(strings.TrimSpace(recoveryCode))
+}
+
+// checkLoginLockout:
+func (uc *usecase) checkLoginLockout(emailKey, ip string) error {
+	processGetLoginLockout := <-uc.repo.GetLoginLockout(emailKey, ip)
+	if processGetLoginLockout.Error != nil {
+		return processGetLoginLockout.Error
+	}
+	if !processGetLoginLockout.Data.(time.Time).IsZero() {
+		return model.ErrLoginLocked
+	}
+	return nil
+}
+
+// recordLoginFailure: count failure per account and per ip, lock duration is doubled for every failure after the limit.
+// Every failure is answered after a delay that also double with the failure count. err is returned once the failure
+// is recorded, error of recording is returned instead
+func (uc *usecase) recordLoginFailure(emailKey, ip string, err error) error {
+	window := env.GetDuration(env.EnvLoginFailureWindow, time.Hour)
+	baseDuration := env.GetDuration(env.EnvLoginLockoutDuration, time.Minute)
+	maxDuration := env.GetDuration(env.EnvLoginLockoutMaxDuration, time.Hour)
+	limits := []struct {
+		kind        string
+		value       string
+		maxAttempts int
+	}{
+		{kind: model.LoginFailureKindEmail, value: emailKey, maxAttempts: env.GetInt(env.EnvLoginMaxAttempts, 5)},
+		{kind: model.LoginFailureKindIP, value: ip, maxAttempts: env.GetInt(env.EnvLoginMaxAttemptsPerIP, 20)},
+	}
+	maxFailures := 0
+	for _, limit := range limits {
+		if len(limit.value) == 0 {
+			continue
+		}
+		processRecord := <-uc.repo.RecordLoginFailure(limit.kind, limit.value, window)
+		if processRecord.Error != nil {
+			return processRecord.Error
+		}
+		failures := processRecord.Data.(int)
+		if failures > maxFailures {
+			maxFailures = failures
+		}
+		if failures < limit.maxAttempts {
+			continue
+		}
+		duration := baseDuration
+		for i := limit.maxAttempts; i < failures && duration < maxDuration; i++ {
+			duration *= 2
+		}
+		if duration > maxDuration {
+			duration = maxDuration
+		}
+		if processLock := <-uc.repo.LockLogin(limit.kind, limit.value, time.Now().Add(duration)); processLock.Error != nil {
+			return processLock.Error
+		}
+	}
+	time.Sleep(loginFailureDelay(maxFailures))
+	return err
+}
+
+// loginFailureDelay: base delay after the first failure, doubled for every next failure up to the max delay
+func loginFailureDelay(failures int) time.Duration {
+	baseDelay := env.GetDuration(env.EnvLoginFailureDelay, 250*time.Millisecond)
+	maxDelay := env.GetDuration(env.EnvLoginFailureMaxDelay, 5*time.Second)
+	if failures <= 0 || baseDelay <= 0 {
+		return 0
+	}
+	delay := baseDelay
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// issueToken: access token and new refresh token family
+func (uc *usecase) issueToken(user model.User, roles []model.Role, client model.Client) (model.Token, error) {
+
+	/* A login always start a new session, the session id is the refresh token family id */
+	sessionID, err := token.NewID()
+	if err != nil {
+		return model.Token{}, err
+	}
+
+	/* Session start in the default organization of the user */
+	processGetOrganization := <-uc.repo.GetDefaultOrganization(user.ID)
+	if processGetOrganization.Error != nil {
+		return model.Token{}, processGetOrganization.Error
+	}
+	organizationID := processGetOrganization.Data.(int)
+	if organizationID == 0 {
+		return model.Token{}, model.ErrNoOrganization
+	}
+
+	/* Generate access token */
+	accessToken, err := uc.generateAccessToken(user, roles, sessionID, organizationID)
+	if err != nil {
+		return model.Token{}, err
+	}
+
+	/* Generate refresh token */
+	refreshToken, refreshTokenHash, err := token.Generate(32)
+	if err != nil {
+		return model.Token{}, err
+	}
+	now := time.Now()
+	processCreateSession := <-uc.repo.CreateSession(&model.Session{
+		ID:             sessionID,
+		UserID:         user.ID,
+		OrganizationID: organizationID,
+		UserAgent:      client.UserAgent,
+		IP:             client.IP,
+		CreatedAt:      now,
+		LastSeenAt:     now,
+	}, &model.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  sessionID,
+		TokenHash: refreshTokenHash,
+		ExpiresAt: now.Add(env.GetDuration(env.EnvJWTRefreshTokenTTL, 30*24*time.Hour)),
+	})
+	if processCreateSession.Error != nil {
+		return model.Token{}, processCreateSession.Error
+	}
+
+	accessToken.RefreshToken = refreshToken
+	return accessToken, nil
+}
+
+const unverifiedPolicyAllow string = "allow"
+const unverifiedPolicyLimit string = "limit"
+const unverifiedPolicyRefuse string = "refuse"
+
+// unverifiedPolicy: allow, limit (token without permission), or refuse
+func unverifiedPolicy() string {
+	switch policy := os.Getenv(env.EnvLoginUnverifiedPolicy); policy {
+	case unverifiedPolicyLimit, unverifiedPolicyRefuse:
+		return policy
+	}
+	return unverifiedPolicyAllow
+}
+
+// generateAccessToken: permissions are resolved once and embedded in the token
+func (uc *usecase) generateAccessToken(user model.User, roles []model.Role, sessionID string, organizationID int) (model.Token, error) {
+	ttl := env.GetDuration(env.EnvJWTAccessTokenTTL, 15*time.Minute)
+	jwtData, err := uc.accessClaims(user, roles, ttl)
+	if err != nil {
+		return model.Token{}, err
+	}
+	jwtData.SessionID = sessionID
+	jwtData.OrganizationID = organizationID
+	jwtString, err := jwtkey.Sign(jwtData)
+	if err != nil {
+		return model.Token{}, err
+	}
+
+	return model.Token{
+		AccessToken: jwtString,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttl.Seconds()),
+	}, nil
+}
+
+// accessClaims: claims of access token, permission is empty for unverified user when policy is limit
+func (uc *usecase) accessClaims(user model.User, roles []model.Role, ttl time.Duration) (model.JWTData, error) {
+	permissions := []string{}
+	if user.VerifiedAt != nil || unverifiedPolicy() != unverifiedPolicyLimit {
+		processGetPermissions := <-uc.repo.GetPermissions(user.ID)
+		if processGetPermissions.Error != nil {
+			return model.JWTData{}, processGetPermissions.Error
+		}
+		permissions = processGetPermissions.Data.([]string)
+	}
+
+	jti, err := token.NewID()
+	if err != nil {
+		return model.JWTData{}, err
+	}
+	return model.JWTData{
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Audience:  model.AudienceAccess,
+			Issuer:    "Golang Boilerplate",
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+		Data: model.JWTUserData{
+			ID:            user.ID,
+			Name:          user.Name,
+			Email:         user.Email,
+			Roles:         roles,
+			Permissions:   permissions,
+			EmailVerified: user.VerifiedAt != nil,
+		},
+	}, nil
+}
+
+// checkAPIKeyOwner: owner must be member of the organization and not hold any role the actor does not hold
+func (uc *usecase) checkAPIKeyOwner(actorID, organizationID, ownerID int) error {
+	processIsMember := <-uc.repo.IsOrganizationMember(organizationID, ownerID)
+	if processIsMember.Error != nil {
+		return processIsMember.Error
+	}
+	if !processIsMember.Data.(bool) {
+		return errors.New("User not found")
+	}
+	processGetOwnerRoles := <-uc.repo.GetRole(ownerID)
+	if processGetOwnerRoles.Error != nil {
+		return processGetOwnerRoles.Error
+	}
+	roleCode, err := uc.roleOutsideActor(actorID, processGetOwnerRoles.Data.([]model.Role))
+	if err != nil {
+		return err
+	}
+	if len(roleCode) > 0 {
+		return fmt.Errorf("Can not create API key for user with role %s", roleCode)
+	}
+	return nil
+}
+
+// roleOutsideActor: first role the actor does not hold, empty when the actor hold every role or is root
+func (uc *usecase) roleOutsideActor(actorID int, roles []model.Role) (string, error) {
+	processGetActorRoles := <-uc.repo.GetRole(actorID)
+	if processGetActorRoles.Error != nil {
+		return "", processGetActorRoles.Error
+	}
+	actorRoles := []string{}
+	for _, role := range processGetActorRoles.Data.([]model.Role) {
+		if role.Code == "root" {
+			return "", nil
+		}
+		actorRoles = append(actorRoles, role.Code)
+	}
+	for _, role := range roles {
+		if !containsString(actorRoles, role.Code) {
+			return role.Code, nil
+		}
+	}
+	return "", nil
+}
+
+// containsString:
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,11 +1,16 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/labstack/echo"
+	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"github.com/novalwardhana/golang-boilerplate/helper/cursor"
+	"github.com/novalwardhana/golang-boilerplate/helper/spreadsheet"
 	"github.com/novalwardhana/golang-boilerplate/middleware/auth"
 	"github.com/novalwardhana/golang-boilerplate/module/user-management/model"
 	"github.com/novalwardhana/golang-boilerplate/module/user-management/usecase"
@@ -22,11 +27,25 @@ func NewHandler(usecase usecase.Usecase) *Handler {
 }
 
 func (h *Handler) Mount(group *echo.Group) {
-	group.POST("/create", h.Create, auth.CheckAuth())
-	group.GET("/get-data", h.GetData, auth.CheckAuth())
+	group.POST("/create", h.Create, auth.CheckAuth(), auth.Require("users:write"))
+	group.GET("/get-data", h.GetData, auth.CheckAuth(), auth.Require("users:read"))
 	group.GET("/detail/:id", h.Detail, auth.CheckAuth())
-	group.PUT("/update/:id", h.Update, auth.CheckAuth())
-	group.DELETE("/delete/:id", h.Delete, auth.CheckAuth())
+	group.PUT("/update/:id", h.Update, auth.CheckAuth(), auth.Require("users:write"))
+	group.DELETE("/delete/:id", h.Delete, auth.CheckAuth(), auth.Require("users:delete"), auth.RefuseImpersonation())
+	group.POST("/resend-verification/:id", h.ResendVerification, auth.CheckAuth(), auth.Require("users:write"))
+	group.GET("/lockouts", h.GetLockouts, auth.CheckAuth(), auth.Require("users:read"))
+	group.POST("/lockouts/unlock", h.Unlock, auth.CheckAuth(), auth.Require("users:write"))
+	group.POST("/disable/:id", h.Disable, auth.CheckAuth(), auth.Require("users:write"), auth.RefuseImpersonation())
+	group.POST("/enable/:id", h.Enable, auth.CheckAuth(), auth.Require("users:write"), auth.RefuseImpersonation())
+	group.POST("/restore/:id", h.Restore, auth.CheckAuth(), auth.Require("users:delete"), auth.RefuseImpersonation())
+	group.DELETE("/purge/:id", h.Purge, auth.CheckAuth(), auth.RefuseImpersonation())
+	group.POST("/import", h.Import, auth.CheckAuth(), auth.Require("users:import"), auth.RefuseImpersonation())
+	group.POST("/invitations", h.CreateInvitation, auth.CheckAuth(), auth.Require("users:write"), auth.RefuseImpersonation())
+	group.GET("/invitations", h.GetInvitations, auth.CheckAuth(), auth.Require("users:read"))
+	group.POST("/invitations/:id/resend", h.ResendInvitation, auth.CheckAuth(), auth.Require("users:write"), auth.RefuseImpersonation())
+	group.DELETE("/invitations/:id", h.RevokeInvitation, auth.CheckAuth(), auth.Require("users:write"), auth.RefuseImpersonation())
+	group.GET("/sessions/:id", h.GetSessions, auth.CheckAuth(), auth.Require("users:read"))
+	group.POST("/sessions/:id/revoke", h.RevokeSessions, auth.CheckAuth(), auth.Require("users:write"), auth.RefuseImpersonation())
 }
 
 // Create:
@@ -34,18 +53,6 @@ func (h *Handler) Create(c echo.Context) error {
 
 	mc := c.(auth.NewContext)
 
-	/* Role check */
-	var grant bool
-	for _, role := range mc.Roles {
-		if role.Code == "root" || role.Code == "admin" {
-			grant = true
-			break
-		}
-	}
-	if !grant {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: "User not have grant to make new user"})
-	}
-
 	/* Payload validation */
 	payload := new(model.NewUser)
 	if err := mc.Bind(payload); err != nil {
@@ -53,7 +60,7 @@ func (h *Handler) Create(c echo.Context) error {
 	}
 
 	/* Process add new user */
-	result := <-h.usecase.Create(payload)
+	result := <-h.usecase.Create(mc.User.ID, mc.OrganizationID, payload)
 	if result.Error != nil {
 		return c.JSON(http.StatusNotFound, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
 	}
@@ -65,16 +72,45 @@ func (h *Handler) GetData(c echo.Context) error {
 
 	mc := c.(auth.NewContext)
 
-	/* Role check */
-	var grant bool
-	for _, role := range mc.Roles {
-		if role.Code == "root" || role.Code == "admin" {
-			grant = true
-			break
-		}
+	/* Limit parameter validation */
+	paramLimit := mc.QueryParam("limit")
+	limit, err := strconv.Atoi(paramLimit)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
 	}
-	if !grant {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: "User not have grant to access user list"})
+
+	/* Filter parameter validation */
+	filter := model.UserFilter{
+		OrganizationID: mc.OrganizationID,
+		Search:         mc.QueryParam("search"),
+		Role:           mc.QueryParam("role"),
+		Status:         mc.QueryParam("status"),
+		Sort:           mc.QueryParam("sort"),
+		Order:          strings.ToLower(mc.QueryParam("order")),
+	}
+	if len(filter.Sort) > 0 && filter.Sort != "name" && filter.Sort != "email" && filter.Sort != "created_at" {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Sort must be name, email, or created_at"})
+	}
+	if len(filter.Status) > 0 && filter.Status != model.UserStatusActive && filter.Status != model.UserStatusDisabled && filter.Status != "deleted" {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Status must be active, disabled, or deleted"})
+	}
+	if len(filter.Order) > 0 && filter.Order != "asc" && filter.Order != "desc" {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Order must be asc or desc"})
+	}
+
+	/* Cursor mode is used when cursor parameter is sent, empty cursor read the first page */
+	if _, ok := mc.QueryParams()["cursor"]; ok {
+		if limit <= 0 {
+			return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Limit parameter not valid"})
+		}
+		result := <-h.usecase.GetDataCursor(limit, mc.QueryParam("cursor"), mc.QueryParam("estimate") == "true", filter)
+		if errors.Is(result.Error, cursor.ErrInvalidCursor) {
+			return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+		}
+		if result.Error != nil {
+			return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+		}
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get User Data", Data: result.Data})
 	}
 
 	/* Page parameter validation */
@@ -84,15 +120,8 @@ func (h *Handler) GetData(c echo.Context) error {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
 	}
 
-	/* Limit parameter validation */
-	paramLimit := mc.QueryParam("limit")
-	limit, err := strconv.Atoi(paramLimit)
-	if err != nil {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
-	}
-
 	/* Process get data */
-	result := <-h.usecase.GetData(page, limit)
+	result := <-h.usecase.GetData(page, limit, filter)
 	if result.Error != nil {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
 	}
@@ -111,23 +140,13 @@ func (h *Handler) Detail(c echo.Context) error {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
 	}
 
-	/* Role check */
-	var grant bool
-	for _, role := range mc.Roles {
-		if role.Code == "root" || role.Code == "admin" {
-			grant = true
-			break
-		}
-	}
-	if mc.User.ID == id {
-		grant = true
-	}
-	if !grant {
+	/* Permission check, user can always access their own data */
+	if !mc.HasPermission("users:read") && mc.User.ID != id {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: "User not have grant to access user list"})
 	}
 
 	/* Detail process */
-	result := <-h.usecase.Detail(id)
+	result := <-h.usecase.Detail(mc.OrganizationID, id)
 	if result.Error != nil {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
 	}
@@ -146,20 +165,6 @@ func (h *Handler) Update(c echo.Context) error {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
 	}
 
-	/* Role check */
-	var grant bool
-	for _, role := range mc.Roles {
-		if role.Code == "root" || role.Code == "admin" {
-			grant = true
-		}
-	}
-	if mc.User.ID == id {
-		grant = true
-	}
-	if !grant {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: "User not have access to update data"})
-	}
-
 	/* Payload */
 	payload := new(model.NewUser)
 	if err := mc.Bind(payload); err != nil {
@@ -169,7 +174,7 @@ func (h *Handler) Update(c echo.Context) error {
 	payload.ID = id
 
 	/* Process update data */
-	result := <-h.usecase.Update(payload)
+	result := <-h.usecase.Update(mc.User.ID, mc.OrganizationID, payload)
 	if result.Error != nil {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
 	}
@@ -188,22 +193,322 @@ func (h *Handler) Delete(c echo.Context) error {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
 	}
 
+	/* Process delete data */
+	result := <-h.usecase.Delete(mc.User.ID, mc.OrganizationID, id)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success delete user"})
+}
+
+// ResendVerification:
+func (h *Handler) ResendVerification(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process resend verification */
+	result := <-h.usecase.ResendVerification(mc.OrganizationID, id)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success resend verification email"})
+}
+
+// GetLockouts:
+func (h *Handler) GetLockouts(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* Process get lockouts */
+	result := <-h.usecase.GetLockouts(mc.OrganizationID)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get login lockouts", Data: result.Data})
+}
+
+// Unlock:
+func (h *Handler) Unlock(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* Payload validation */
+	payload := new(model.UnlockRequest)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if (payload.Kind != "email" && payload.Kind != "ip") || len(payload.Value) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Kind must be email or ip and value must be filled"})
+	}
+
+	/* Process unlock */
+	result := <-h.usecase.Unlock(mc.OrganizationID, payload.Kind, payload.Value)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success unlock login"})
+}
+
+// GetSessions:
+func (h *Handler) GetSessions(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process get sessions */
+	result := <-h.usecase.GetSessions(mc.OrganizationID, id)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get sessions", Data: result.Data})
+}
+
+// RevokeSessions:
+func (h *Handler) RevokeSessions(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process revoke sessions */
+	result := <-h.usecase.RevokeSessions(mc.User.ID, mc.OrganizationID, id)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success logout user from every session"})
+}
+
+// Disable:
+func (h *Handler) Disable(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if id == mc.User.ID {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Cannot disable yourself"})
+	}
+
+	/* Process update status */
+	result := <-h.usecase.SetStatus(mc.User.ID, mc.OrganizationID, id, model.UserStatusDisabled)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success disable user"})
+}
+
+// Enable:
+func (h *Handler) Enable(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process update status */
+	result := <-h.usecase.SetStatus(mc.User.ID, mc.OrganizationID, id, model.UserStatusActive)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success enable user"})
+}
+
+// Restore:
+func (h *Handler) Restore(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process restore */
+	result := <-h.usecase.Restore(mc.User.ID, mc.OrganizationID, id)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success restore user"})
+}
+
+// Purge: permanent delete is reserved for root
+func (h *Handler) Purge(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
 	/* Role check */
-	var grant bool
-	for _, role := range mc.Roles {
-		if role.Code == "root" || role.Code == "admin" {
-			grant = true
-			break
+	if !mc.IsRoot() {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: "Only root can purge user"})
+	}
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process purge */
+	result := <-h.usecase.Purge(mc.OrganizationID, id)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success purge user"})
+}
+
+// importMaxFileSize: 5 MB
+const importMaxFileSize int64 = 5 << 20
+
+// importMaxColumns: the file only need name, email, and roles, the rest is ignored
+const importMaxColumns int = 100
+
+// importMaxXMLSize: uncompressed size of each xml part of xlsx, 50 MB
+const importMaxXMLSize int64 = 50 << 20
+
+// Import: multipart file field is file, dry_run=true only validate the rows
+func (h *Handler) Import(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* Dry run parameter validation */
+	dryRun := false
+	if paramDryRun := mc.FormValue("dry_run"); len(paramDryRun) > 0 {
+		value, err := strconv.ParseBool(paramDryRun)
+		if err != nil {
+			return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Dry run must be true or false"})
 		}
+		dryRun = value
+	}
+
+	/* File validation */
+	fileHeader, err := mc.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if fileHeader.Size > importMaxFileSize {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "File size must not exceed 5 MB"})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
 	}
-	if !grant {
-		return c.JSON(http.StatusOK, model.Response{Status: http.StatusUnauthorized, Message: "User not have access to delete data"})
+	defer file.Close()
+	maxRows := env.GetInt(env.EnvUserImportMaxRows, 1000)
+	rows, err := spreadsheet.Read(fileHeader.Filename, file, spreadsheet.Limit{MaxRows: maxRows + 1, MaxColumns: importMaxColumns, MaxXMLSize: importMaxXMLSize})
+	if errors.Is(err, spreadsheet.ErrTooManyRows) {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: fmt.Sprintf("File can not have more than %d rows", maxRows)})
+	}
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
 	}
 
-	/* Process delete data */
-	result := <-h.usecase.Delete(id)
+	/* Process import */
+	result := <-h.usecase.Import(mc.User.ID, mc.OrganizationID, rows, dryRun)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success import user", Data: result.Data})
+}
+
+// CreateInvitation:
+func (h *Handler) CreateInvitation(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* Payload validation */
+	payload := new(model.InvitationRequest)
+	if err := mc.Bind(payload); err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+	if len(payload.Email) == 0 {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: "Email must be filled"})
+	}
+
+	/* Process create invitation */
+	result := <-h.usecase.CreateInvitation(mc.OrganizationID, *payload, mc.User.ID)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success invite user", Data: result.Data})
+}
+
+// GetInvitations:
+func (h *Handler) GetInvitations(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* Process get invitations */
+	result := <-h.usecase.GetInvitations(mc.OrganizationID)
 	if result.Error != nil {
 		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
 	}
-	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success delete user"})
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success get invitations", Data: result.Data})
+}
+
+// ResendInvitation:
+func (h *Handler) ResendInvitation(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process resend invitation */
+	result := <-h.usecase.ResendInvitation(mc.OrganizationID, id)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success resend invitation", Data: result.Data})
+}
+
+// RevokeInvitation:
+func (h *Handler) RevokeInvitation(c echo.Context) error {
+
+	mc := c.(auth.NewContext)
+
+	/* ID parameter validation */
+	idParam := mc.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusBadRequest, Message: err.Error()})
+	}
+
+	/* Process revoke invitation */
+	result := <-h.usecase.RevokeInvitation(mc.OrganizationID, id)
+	if result.Error != nil {
+		return c.JSON(http.StatusOK, model.Response{Status: http.StatusNotFound, Message: result.Error.Error()})
+	}
+	return c.JSON(http.StatusOK, model.Response{Status: http.StatusOK, Message: "Success revoke invitation"})
 }
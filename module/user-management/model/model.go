@@ -1,5 +1,10 @@
 package model
 
+import "time"
+
+const UserStatusActive string = "active"
+const UserStatusDisabled string = "disabled"
+
 type Result struct {
 	Data  interface{} `json:"data"`
 	Error error       `json:"error"`
@@ -12,10 +17,12 @@ type Response struct {
 }
 
 type User struct {
-	ID       int    `json:"id" gorm:"id"`
-	Name     string `json:"name" gorm:"name"`
-	Email    string `json:"email" gorm:"email"`
-	Password string `json:"password" gorm:"password"`
+	ID         int        `json:"id" gorm:"id"`
+	Name       string     `json:"name" gorm:"name"`
+	Email      string     `json:"email" gorm:"email"`
+	Password   string     `json:"password" gorm:"password"`
+	VerifiedAt *time.Time `json:"-" gorm:"verified_at"`
+	Status     string     `json:"-" gorm:"status"`
 }
 
 type Role struct {
@@ -29,23 +36,167 @@ type UserHasRole struct {
 	RoleID int `json:"role_id" gorm:"role_id"`
 }
 
+type OrganizationUser struct {
+	OrganizationID int `json:"organization_id" gorm:"organization_id"`
+	UserID         int `json:"user_id" gorm:"user_id"`
+}
+
 type NewUser struct {
 	User
 	Roles []int `json:"roles"`
 }
 
 type UserWithRoles struct {
-	ID        int    `gorm:"id" json:"id"`
-	Name      string `gorm:"name" json:"name"`
-	Email     string `gorm:"email" json:"email"`
-	Roles     []byte `gorm:"roles" json:"-"`
-	JsonRoles []Role `gorm:"-" json:"roles"`
+	ID         int        `gorm:"id" json:"id"`
+	Name       string     `gorm:"name" json:"name"`
+	Email      string     `gorm:"email" json:"email"`
+	VerifiedAt *time.Time `gorm:"verified_at" json:"verified_at"`
+	Status     string     `gorm:"status" json:"status"`
+	CreatedAt  *time.Time `gorm:"created_at" json:"created_at,omitempty"`
+	DeletedAt  *time.Time `gorm:"deleted_at" json:"deleted_at,omitempty"`
+	Roles      []byte     `gorm:"roles" json:"-"`
+	JsonRoles  []Role     `gorm:"-" json:"roles"`
+	EmailError string     `gorm:"-" json:"email_error,omitempty"`
+}
+
+// UserFilter: sort is one of name, email, created_at and order is asc or desc, status is active, disabled, or deleted.
+// Only member of the organization is listed
+type UserFilter struct {
+	OrganizationID int
+	Search         string
+	Role           string
+	Status         string
+	Sort           string
+	Order          string
 }
 
+// Pagination: cursor mode fill next and prev cursor instead of page and total, estimated total is only filled on request
 type Pagination struct {
-	Page         int             `json:"page"`
-	Limit        int             `json:"limit"`
-	TotalData    int             `json:"total_data"`
-	NumberOfPage int             `json:"number_of_page"`
-	Data         []UserWithRoles `json:"data"`
+	Page           int             `json:"page"`
+	Limit          int             `json:"limit"`
+	TotalData      int             `json:"total_data"`
+	NumberOfPage   int             `json:"number_of_page"`
+	Data           []UserWithRoles `json:"data"`
+	NextCursor     string          `json:"next_cursor,omitempty"`
+	PrevCursor     string          `json:"prev_cursor,omitempty"`
+	EstimatedTotal *int            `json:"estimated_total,omitempty"`
+}
+
+type PasswordReset struct {
+	ID        int        `json:"id" gorm:"id"`
+	UserID    int        `json:"user_id" gorm:"user_id"`
+	TokenHash string     `json:"-" gorm:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"expires_at"`
+	UsedAt    *time.Time `json:"used_at" gorm:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"created_at"`
+}
+
+func (p *PasswordReset) TableName() string {
+	return "password_resets"
+}
+
+const ImportRowStatusValid string = "valid"
+const ImportRowStatusCreated string = "created"
+const ImportRowStatusFailed string = "failed"
+
+// ImportRow: row is the line number in the file, header is line 1
+type ImportRow struct {
+	Row        int      `json:"row"`
+	Name       string   `json:"name"`
+	Email      string   `json:"email"`
+	Roles      []string `json:"roles"`
+	Status     string   `json:"status"`
+	Error      string   `json:"error,omitempty"`
+	UserID     int      `json:"user_id,omitempty"`
+	EmailError string   `json:"email_error,omitempty"`
+	RoleIDs    []int    `json:"-"`
+}
+
+// ImportReport: valid count rows that pass validation, failed also count valid rows that fail to be created
+type ImportReport struct {
+	DryRun   bool        `json:"dry_run"`
+	TotalRow int         `json:"total_row"`
+	Valid    int         `json:"valid"`
+	Created  int         `json:"created"`
+	Failed   int         `json:"failed"`
+	Rows     []ImportRow `json:"rows"`
+}
+
+type Invitation struct {
+	ID             int        `json:"id" gorm:"id"`
+	OrganizationID int        `json:"organization_id" gorm:"organization_id"`
+	Email          string     `json:"email" gorm:"email"`
+	TokenHash      string     `json:"-" gorm:"token_hash"`
+	InvitedBy      int        `json:"invited_by" gorm:"invited_by"`
+	UserID         *int       `json:"user_id" gorm:"user_id"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at" gorm:"accepted_at"`
+	RevokedAt      *time.Time `json:"revoked_at" gorm:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"created_at"`
+	EmailError     string     `json:"email_error,omitempty" gorm:"-"`
+}
+
+func (i *Invitation) TableName() string {
+	return "user_invitations"
+}
+
+type InvitationRole struct {
+	InvitationID int `json:"invitation_id" gorm:"invitation_id"`
+	RoleID       int `json:"role_id" gorm:"role_id"`
+}
+
+func (i *InvitationRole) TableName() string {
+	return "user_invitation_roles"
+}
+
+type InvitationRequest struct {
+	Email string `json:"email"`
+	Roles []int  `json:"roles"`
+}
+
+type InvitationWithRoles struct {
+	ID        int       `json:"id" gorm:"id"`
+	Email     string    `json:"email" gorm:"email"`
+	InvitedBy int       `json:"invited_by" gorm:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"expires_at"`
+	Expired   bool      `json:"expired" gorm:"expired"`
+	CreatedAt time.Time `json:"created_at" gorm:"created_at"`
+	Roles     []byte    `json:"-" gorm:"roles"`
+	JsonRoles []Role    `json:"roles" gorm:"-"`
+}
+
+type EmailVerification struct {
+	ID        int        `json:"id" gorm:"id"`
+	UserID    int        `json:"user_id" gorm:"user_id"`
+	TokenHash string     `json:"-" gorm:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"expires_at"`
+	UsedAt    *time.Time `json:"used_at" gorm:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"created_at"`
+}
+
+func (e *EmailVerification) TableName() string {
+	return "email_verifications"
+}
+
+type LoginFailure struct {
+	Kind         string     `json:"kind" gorm:"kind"`
+	Value        string     `json:"value" gorm:"value"`
+	Failures     int        `json:"failures" gorm:"failures"`
+	LastFailedAt time.Time  `json:"last_failed_at" gorm:"last_failed_at"`
+	LockedUntil  *time.Time `json:"locked_until" gorm:"locked_until"`
+}
+
+type UnlockRequest struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type Session struct {
+	ID         string     `json:"id" gorm:"id"`
+	UserID     int        `json:"user_id" gorm:"user_id"`
+	UserAgent  string     `json:"user_agent" gorm:"user_agent"`
+	IP         string     `json:"ip" gorm:"ip"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at" gorm:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at" gorm:"revoked_at"`
 }
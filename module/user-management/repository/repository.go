@@ -2,7 +2,12 @@ package repository
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/novalwardhana/golang-boilerplate/helper/cursor"
 	"github.com/novalwardhana/golang-boilerplate/module/user-management/model"
 	"gorm.io/gorm"
 )
@@ -12,13 +17,35 @@ type repository struct {
 }
 
 type Repository interface {
-	Create(user *model.User, roles []int) <-chan model.Result
-	CountData() <-chan model.Result
-	GetData(page, limit int) <-chan model.Result
+	Create(organizationID int, user *model.User, roles []int) <-chan model.Result
+	CountData(filter model.UserFilter) <-chan model.Result
+	GetData(page, limit int, filter model.UserFilter) <-chan model.Result
+	GetDataCursor(limit int, after string, filter model.UserFilter) <-chan model.Result
+	EstimateData(filter model.UserFilter) <-chan model.Result
 	GetRoles(userID int) <-chan model.Result
 	GetUser(id int) <-chan model.Result
 	Update(payload *model.NewUser) <-chan model.Result
 	Delete(id int) <-chan model.Result
+	RevokeUserTokens(userID int, includeRefreshToken bool) <-chan model.Result
+	CreateEmailVerification(emailVerification *model.EmailVerification) <-chan model.Result
+	GetLoginLockouts(organizationID int) <-chan model.Result
+	UnlockLogin(organizationID int, kind, value string) <-chan model.Result
+	GetSessions(userID int) <-chan model.Result
+	CountRoles(ids []int) <-chan model.Result
+	SetStatus(id int, status string) <-chan model.Result
+	Restore(id int) <-chan model.Result
+	Purge(id int) <-chan model.Result
+	GetRolesByCode(codes []string) <-chan model.Result
+	GetExistingEmails(emails []string) <-chan model.Result
+	CreateBatch(organizationID int, users []model.User, roles [][]int) <-chan model.Result
+	CreatePasswordReset(passwordReset *model.PasswordReset) <-chan model.Result
+	CreateInvitation(invitation *model.Invitation, roles []int) <-chan model.Result
+	GetInvitations(organizationID int) <-chan model.Result
+	GetInvitation(organizationID, id int) <-chan model.Result
+	RenewInvitation(id int, tokenHash string, expiresAt time.Time) <-chan model.Result
+	RevokeInvitation(organizationID, id int) <-chan model.Result
+	IsMember(organizationID, userID int) <-chan model.Result
+	IsMemberOfOtherOrganization(organizationID, userID int) <-chan model.Result
 }
 
 func NewRepository(dbMaster *gorm.DB) Repository {
@@ -27,8 +54,8 @@ func NewRepository(dbMaster *gorm.DB) Repository {
 	}
 }
 
-// Create:
-func (r *repository) Create(user *model.User, roles []int) <-chan model.Result {
+// Create: new user join the organization of the creator
+func (r *repository) Create(organizationID int, user *model.User, roles []int) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
@@ -54,6 +81,13 @@ func (r *repository) Create(user *model.User, roles []int) <-chan model.Result {
 			return
 		}
 
+		/* Process create organization user */
+		if err := tx.Create(&model.OrganizationUser{OrganizationID: organizationID, UserID: user.ID}).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
 		tx.Commit()
 		result <- model.Result{Data: user}
 
@@ -61,16 +95,20 @@ func (r *repository) Create(user *model.User, roles []int) <-chan model.Result {
 	return result
 }
 
-// CountData:
-func (r *repository) CountData() <-chan model.Result {
+// CountData: count over the same filter and join as GetData
+func (r *repository) CountData(filter model.UserFilter) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Process count data */
 		var count int64
-		sql := `select count(id) from users`
-		if err := r.dbMaster.Raw(sql).Count(&count).Error; err != nil {
+		where, args := userFilterQuery(filter)
+		sql := `select count(distinct u.id)
+				from users as u
+				inner join user_has_roles uhr on u.id = uhr.user_id
+				` + where
+		if err := r.dbMaster.Raw(sql, args...).Scan(&count).Error; err != nil {
 			result <- model.Result{Error: err}
 			return
 		}
@@ -81,7 +119,7 @@ func (r *repository) CountData() <-chan model.Result {
 }
 
 // GetData:
-func (r *repository) GetData(page, limit int) <-chan model.Result {
+func (r *repository) GetData(page, limit int, filter model.UserFilter) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
@@ -89,34 +127,111 @@ func (r *repository) GetData(page, limit int) <-chan model.Result {
 		/* Process get data */
 		var list []model.UserWithRoles
 		offset := (page - 1) * limit
-		sql := `select 
-					u.id,
-					u.name,
-					u.email,
-					jsonb_agg(concat('{', 
-						'"id"', ':', r.id , ',',
-						'"code"', ':', '"', r.code , '",',
-						'"name"', ':', '"', r.name , '"',
-					'}')::json) as roles
-				from users as u
-				inner join user_has_roles uhr on u.id = uhr.user_id 
-				inner join roles r on uhr.role_id = r.id
-				group by u.id, u.name, u.email
-				order by u.id desc 
+		where, args := userFilterQuery(filter)
+		sql := userListQuery(where, userSortQuery(filter)) + `
 				offset ? limit ?`
-		if err := r.dbMaster.Raw(sql, offset, limit).Find(&list).Error; err != nil {
+		args = append(args, offset, limit)
+		if err := r.dbMaster.Raw(sql, args...).Find(&list).Error; err != nil {
 			result <- model.Result{Error: err}
 			return
 		}
-		for index := range list {
-			var roles []model.Role
-			if err := json.Unmarshal(list[index].Roles, &roles); err != nil {
+		if err := setUserRoles(list); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: list}
+
+	}()
+	return result
+}
+
+// GetDataCursor: keyset pagination, one more row is read to know whether there is next page.
+// Empty cursor read the first page
+func (r *repository) GetDataCursor(limit int, after string, filter model.UserFilter) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Decode cursor */
+		signature := userCursorSignature(filter)
+		var key *userKey
+		backward := false
+		if len(after) > 0 {
+			key = new(userKey)
+			var err error
+			if backward, err = cursor.Decode(after, signature, key); err != nil {
 				result <- model.Result{Error: err}
 				return
 			}
-			list[index].JsonRoles = roles
 		}
-		result <- model.Result{Data: list}
+
+		/* Process get data */
+		var list []model.UserWithRoles
+		where, args := userFilterQuery(filter)
+		columns := userSortKey(filter, key)
+		if key != nil {
+			condition, conditionArgs := cursor.Condition(columns, backward)
+			where += " and " + condition
+			args = append(args, conditionArgs...)
+		}
+		sql := userListQuery(where, cursor.Order(columns, backward)) + `
+				limit ?`
+		args = append(args, limit+1)
+		if err := r.dbMaster.Raw(sql, args...).Find(&list).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		hasMore := len(list) > limit
+		if hasMore {
+			list = list[:limit]
+		}
+		if backward {
+			for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+				list[i], list[j] = list[j], list[i]
+			}
+		}
+		if err := setUserRoles(list); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Create next and prev cursor */
+		pagination := model.Pagination{Limit: limit, Data: list}
+		if len(list) > 0 {
+			var err error
+			if hasMore || backward {
+				if pagination.NextCursor, err = cursor.Encode(signature, false, newUserKey(list[len(list)-1])); err != nil {
+					result <- model.Result{Error: err}
+					return
+				}
+			}
+			if (backward && hasMore) || (!backward && key != nil) {
+				if pagination.PrevCursor, err = cursor.Encode(signature, true, newUserKey(list[0])); err != nil {
+					result <- model.Result{Error: err}
+					return
+				}
+			}
+		}
+		result <- model.Result{Data: pagination}
+
+	}()
+	return result
+}
+
+// EstimateData: planner estimate over the same filter as GetData
+func (r *repository) EstimateData(filter model.UserFilter) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process estimate data */
+		where, args := userFilterQuery(filter)
+		estimate, err := cursor.Estimate(r.dbMaster, `select u.id from users as u `+where, args...)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: estimate}
 
 	}()
 	return result
@@ -157,7 +272,7 @@ func (r *repository) GetUser(id int) <-chan model.Result {
 
 		/* Process get user */
 		var user model.User
-		sql := "select * from users where id = ?"
+		sql := "select * from users where id = ? and deleted_at is null"
 		if err := r.dbMaster.Raw(sql, id).Find(&user).Error; err != nil {
 			result <- model.Result{Error: err}
 			return
@@ -176,8 +291,13 @@ func (r *repository) Update(payload *model.NewUser) <-chan model.Result {
 
 		/* Process get data */
 		tx := r.dbMaster.Begin()
+		if err := tx.Exec(lockRootRoleSQL).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
 		var user model.User
-		sql := `select * from users where id = ?`
+		sql := `select * from users where id = ? and deleted_at is null`
 		if err := tx.Raw(sql, payload.ID).First(&user).Error; err != nil {
 			tx.Rollback()
 			result <- model.Result{Error: err}
@@ -186,7 +306,9 @@ func (r *repository) Update(payload *model.NewUser) <-chan model.Result {
 
 		/* Process update data */
 		user.Name = payload.Name
-		user.Password = payload.Password
+		if len(payload.Password) > 0 {
+			user.Password = payload.Password
+		}
 		if err := tx.Save(&user).Error; err != nil {
 			tx.Rollback()
 			result <- model.Result{Error: err}
@@ -211,9 +333,23 @@ func (r *repository) Update(payload *model.NewUser) <-chan model.Result {
 			userHasRoles = append(userHasRoles, userHasRole)
 		}
 		if err := tx.Create(&userHasRoles).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Root check, there must be at least one root user left */
+		var totalRoot int64
+		if err := tx.Raw(activeRootUsersSQL).Scan(&totalRoot).Error; err != nil {
+			tx.Rollback()
 			result <- model.Result{Error: err}
 			return
 		}
+		if totalRoot == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("Cannot remove root role from the last root user")}
+			return
+		}
 
 		tx.Commit()
 		result <- model.Result{Data: user}
@@ -222,28 +358,739 @@ func (r *repository) Update(payload *model.NewUser) <-chan model.Result {
 	return result
 }
 
-// Delete:
+// Delete: soft delete, user can be restored until purged
 func (r *repository) Delete(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process soft delete user */
+		sql := `update users set deleted_at = now() where id = ? and deleted_at is null`
+		process := r.dbMaster.Exec(sql, id)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: errors.New("User not found")}
+			return
+		}
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// RevokeUserTokens: access token issued until now is rejected by auth middleware
+func (r *repository) RevokeUserTokens(userID int, includeRefreshToken bool) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Revoke access tokens */
+		tx := r.dbMaster.Begin()
+		sql := `insert into user_token_revocations (user_id, revoked_at) values (?, now())
+			on conflict (user_id) do update set revoked_at = excluded.revoked_at`
+		if err := tx.Exec(sql, userID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Revoke refresh tokens and end sessions */
+		if includeRefreshToken {
+			sql = `update refresh_tokens set revoked_at = now() where user_id = ? and revoked_at is null`
+			if err := tx.Exec(sql, userID).Error; err != nil {
+				tx.Rollback()
+				result <- model.Result{Error: err}
+				return
+			}
+			sql = `update sessions set revoked_at = now() where user_id = ? and revoked_at is null`
+			if err := tx.Exec(sql, userID).Error; err != nil {
+				tx.Rollback()
+				result <- model.Result{Error: err}
+				return
+			}
+		}
+
+		tx.Commit()
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// CreateEmailVerification: previous verification token that not used yet is invalidated
+func (r *repository) CreateEmailVerification(emailVerification *model.EmailVerification) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Invalidate previous verification token */
+		tx := r.dbMaster.Begin()
+		sql := `update email_verifications set used_at = now() where user_id = ? and used_at is null`
+		if err := tx.Exec(sql, emailVerification.UserID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Create verification token */
+		if err := tx.Create(emailVerification).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		tx.Commit()
+		result <- model.Result{Data: emailVerification}
+	}()
+	return result
+}
+
+// GetLoginLockouts: locked ip and locked account of the organization member
+func (r *repository) GetLoginLockouts(organizationID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get lockouts */
+		var lockouts []model.LoginFailure
+		sql := `select * from login_failures lf where lf.locked_until > now() and ` + lockoutMemberSQL + ` order by lf.locked_until desc`
+		if err := r.dbMaster.Raw(sql, organizationID).Scan(&lockouts).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: lockouts}
+	}()
+	return result
+}
+
+// UnlockLogin: remove failure counter so the next login start from zero
+func (r *repository) UnlockLogin(organizationID int, kind, value string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process unlock */
+		sql := `delete from login_failures lf where lf.kind = ? and lf.value = ? and ` + lockoutMemberSQL
+		process := r.dbMaster.Exec(sql, kind, value, organizationID)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: errors.New("Lockout not found")}
+			return
+		}
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// GetSessions: active session of the user, latest seen first
+func (r *repository) GetSessions(userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get sessions */
+		var sessions []model.Session
+		sql := `select * from sessions where user_id = ? and revoked_at is null order by last_seen_at desc`
+		if err := r.dbMaster.Raw(sql, userID).Scan(&sessions).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: sessions}
+
+	}()
+	return result
+}
+
+// CountRoles: number of existing role from the ids
+func (r *repository) CountRoles(ids []int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process count roles */
+		var count int64
+		sql := `select count(1) from roles where id in ?`
+		if err := r.dbMaster.Raw(sql, ids).Scan(&count).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: count}
+
+	}()
+	return result
+}
+
+// SetStatus:
+func (r *repository) SetStatus(id int, status string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process update status */
+		tx := r.dbMaster.Begin()
+		if tx.Error != nil {
+			result <- model.Result{Error: tx.Error}
+			return
+		}
+		if err := tx.Exec(lockRootRoleSQL).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		sql := `update users set status = ? where id = ? and deleted_at is null`
+		process := tx.Exec(sql, status, id)
+		if process.Error != nil {
+			tx.Rollback()
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("User not found")}
+			return
+		}
+
+		/* Root check, there must be at least one active root user left */
+		var totalRoot int64
+		if err := tx.Raw(activeRootUsersSQL).Scan(&totalRoot).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		if totalRoot == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("Cannot disable the last root user")}
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// Restore:
+func (r *repository) Restore(id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process restore user */
+		sql := `update users set deleted_at = null where id = ? and deleted_at is not null`
+		process := r.dbMaster.Exec(sql, id)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: errors.New("Deleted user not found")}
+			return
+		}
+		result <- model.Result{}
+
+	}()
+	return result
+}
+
+// Purge: permanently delete user, only soft deleted user can be purged
+func (r *repository) Purge(id int) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Delete user has roles */
 		tx := r.dbMaster.Begin()
-		sql := `delete from user_has_roles where user_id = ?`
-		if err := tx.Exec(sql, id).Error; err != nil {
+		sql := `delete from user_has_roles where user_id = ? and exists (select 1 from users where id = ? and deleted_at is not null)`
+		if err := tx.Exec(sql, id, id).Error; err != nil {
+			tx.Rollback()
 			result <- model.Result{Error: err}
 			return
 		}
 
 		/* Delete user */
-		if err := tx.Delete(&model.User{}, id).Error; err != nil {
+		sql = `delete from users where id = ? and deleted_at is not null`
+		process := tx.Exec(sql, id)
+		if process.Error != nil {
+			tx.Rollback()
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("Deleted user not found")}
+			return
+		}
+
+		tx.Commit()
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// GetRolesByCode:
+func (r *repository) GetRolesByCode(codes []string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get roles */
+		roles := []model.Role{}
+		if len(codes) == 0 {
+			result <- model.Result{Data: roles}
+			return
+		}
+		sql := `select id, code, name from roles where code in ?`
+		if err := r.dbMaster.Raw(sql, codes).Scan(&roles).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: roles}
+
+	}()
+	return result
+}
+
+// GetExistingEmails: lower case email that already registered, soft deleted user still hold the email
+func (r *repository) GetExistingEmails(emails []string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get emails */
+		existingEmails := []string{}
+		if len(emails) == 0 {
+			result <- model.Result{Data: existingEmails}
+			return
+		}
+		sql := `select lower(email) from users where lower(email) in ?`
+		if err := r.dbMaster.Raw(sql, emails).Scan(&existingEmails).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: existingEmails}
+
+	}()
+	return result
+}
+
+// CreateBatch: one transaction for the batch, every row use a savepoint so a failed row does not cancel the others.
+// Result data is the error of each row, nil for created user
+func (r *repository) CreateBatch(organizationID int, users []model.User, roles [][]int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		tx := r.dbMaster.Begin()
+		if tx.Error != nil {
+			result <- model.Result{Error: tx.Error}
+			return
+		}
+		rowErrors := make([]error, len(users))
+		for index := range users {
+			if err := tx.SavePoint("import_row").Error; err != nil {
+				tx.Rollback()
+				result <- model.Result{Error: err}
+				return
+			}
+
+			/* Process create user and user has roles */
+			err := tx.Create(&users[index]).Error
+			if err == nil {
+				userHasRoles := []model.UserHasRole{}
+				for _, roleID := range roles[index] {
+					userHasRoles = append(userHasRoles, model.UserHasRole{UserID: users[index].ID, RoleID: roleID})
+				}
+				err = tx.Create(&userHasRoles).Error
+			}
+			if err == nil {
+				err = tx.Create(&model.OrganizationUser{OrganizationID: organizationID, UserID: users[index].ID}).Error
+			}
+			if err != nil {
+				rowErrors[index] = err
+				users[index].ID = 0
+				if err := tx.RollbackTo("import_row").Error; err != nil {
+					tx.Rollback()
+					result <- model.Result{Error: err}
+					return
+				}
+			}
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: rowErrors}
+
+	}()
+	return result
+}
+
+// CreatePasswordReset: previous reset token that not used yet is invalidated
+func (r *repository) CreatePasswordReset(passwordReset *model.PasswordReset) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Invalidate previous reset token */
+		tx := r.dbMaster.Begin()
+		sql := `update password_resets set used_at = now() where user_id = ? and used_at is null`
+		if err := tx.Exec(sql, passwordReset.UserID).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Create reset token */
+		if err := tx.Create(passwordReset).Error; err != nil {
+			tx.Rollback()
 			result <- model.Result{Error: err}
 			return
 		}
 
 		tx.Commit()
+		result <- model.Result{Data: passwordReset}
+	}()
+	return result
+}
+
+// CreateInvitation: expired invitation of the email is revoked, an email can only have one pending invitation
+func (r *repository) CreateInvitation(invitation *model.Invitation, roles []int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Revoke expired invitation */
+		tx := r.dbMaster.Begin()
+		sql := `update user_invitations set revoked_at = now()
+			where lower(email) = lower(?) and accepted_at is null and revoked_at is null and expires_at <= now()`
+		if err := tx.Exec(sql, invitation.Email).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Pending invitation check */
+		var count int64
+		sql = `select count(1) from user_invitations where lower(email) = lower(?) and accepted_at is null and revoked_at is null`
+		if err := tx.Raw(sql, invitation.Email).Scan(&count).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		if count > 0 {
+			tx.Rollback()
+			result <- model.Result{Error: errors.New("Invitation for the email already pending")}
+			return
+		}
+
+		/* Create invitation and invitation roles */
+		if err := tx.Create(invitation).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+		invitationRoles := []model.InvitationRole{}
+		for _, roleID := range roles {
+			invitationRoles = append(invitationRoles, model.InvitationRole{InvitationID: invitation.ID, RoleID: roleID})
+		}
+		if err := tx.Create(&invitationRoles).Error; err != nil {
+			tx.Rollback()
+			result <- model.Result{Error: err}
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: invitation}
+	}()
+	return result
+}
+
+// GetInvitations: pending invitation, expired one is listed so it can be resent
+func (r *repository) GetInvitations(organizationID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get invitations */
+		var list []model.InvitationWithRoles
+		sql := `select
+				ui.id,
+				ui.email,
+				coalesce(ui.invited_by, 0) as invited_by,
+				ui.expires_at,
+				ui.expires_at <= now() as expired,
+				ui.created_at,
+				coalesce((
+					select json_agg(json_build_object('id', r.id, 'code', r.code, 'name', r.name) order by r.id)
+					from user_invitation_roles uir
+					inner join roles r on r.id = uir.role_id
+					where uir.invitation_id = ui.id
+				), '[]') as roles
+			from user_invitations ui
+			where ui.organization_id = ? and ui.accepted_at is null and ui.revoked_at is null
+			order by ui.id desc`
+		if err := r.dbMaster.Raw(sql, organizationID).Scan(&list).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		for index := range list {
+			var roles []model.Role
+			if err := json.Unmarshal(list[index].Roles, &roles); err != nil {
+				result <- model.Result{Error: err}
+				return
+			}
+			list[index].JsonRoles = roles
+		}
+		result <- model.Result{Data: list}
+	}()
+	return result
+}
+
+// GetInvitation: pending invitation
+func (r *repository) GetInvitation(organizationID, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process get invitation */
+		var invitation model.Invitation
+		sql := `select * from user_invitations where id = ? and organization_id = ? and accepted_at is null and revoked_at is null`
+		if err := r.dbMaster.Raw(sql, id, organizationID).Scan(&invitation).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		if invitation.ID == 0 {
+			result <- model.Result{Error: errors.New("Invitation not found")}
+			return
+		}
+		result <- model.Result{Data: invitation}
+	}()
+	return result
+}
+
+// RenewInvitation: replace the token so the link of the previous email can not be used
+func (r *repository) RenewInvitation(id int, tokenHash string, expiresAt time.Time) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process renew invitation */
+		sql := `update user_invitations set token_hash = ?, expires_at = ? where id = ? and accepted_at is null and revoked_at is null`
+		process := r.dbMaster.Exec(sql, tokenHash, expiresAt, id)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: errors.New("Invitation not found")}
+			return
+		}
 		result <- model.Result{}
 	}()
 	return result
 }
+
+// RevokeInvitation:
+func (r *repository) RevokeInvitation(organizationID, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process revoke invitation */
+		sql := `update user_invitations set revoked_at = now() where id = ? and organization_id = ? and accepted_at is null and revoked_at is null`
+		process := r.dbMaster.Exec(sql, id, organizationID)
+		if process.Error != nil {
+			result <- model.Result{Error: process.Error}
+			return
+		}
+		if process.RowsAffected == 0 {
+			result <- model.Result{Error: errors.New("Invitation not found")}
+			return
+		}
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// IsMemberOfOtherOrganization:
+func (r *repository) IsMemberOfOtherOrganization(organizationID, userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process check member */
+		var exists bool
+		sql := `select exists(select 1 from organization_users where organization_id <> ? and user_id = ?)`
+		if err := r.dbMaster.Raw(sql, organizationID, userID).Scan(&exists).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: exists}
+	}()
+	return result
+}
+
+// IsMember: deleted user stay member so it can be restored
+func (r *repository) IsMember(organizationID, userID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Process check member */
+		var exists bool
+		sql := `select exists(select 1 from organization_users where organization_id = ? and user_id = ?)`
+		if err := r.dbMaster.Raw(sql, organizationID, userID).Scan(&exists).Error; err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		result <- model.Result{Data: exists}
+	}()
+	return result
+}
+
+// lockoutMemberSQL: ip lockout is not owned by organization, email lockout is owned by organization of the user
+const lockoutMemberSQL string = `(lf.kind <> 'email' or exists (
+		select 1 from users lu
+		inner join organization_users lou on lou.user_id = lu.id
+		where lower(lu.email) = lf.value and lou.organization_id = ?
+	))`
+
+// lockRootRoleSQL: change that may remove the last active root hold this lock, so concurrent change see each other's result
+const lockRootRoleSQL string = `select id from roles where code = 'root' for update`
+
+const activeRootUsersSQL string = `select count(distinct users.id) from users
+	inner join user_has_roles on user_has_roles.user_id = users.id
+	inner join roles on roles.id = user_has_roles.role_id
+	where roles.code = 'root' and users.deleted_at is null and users.status = 'active'`
+
+// userFilterQuery: role filter use exists so the listed roles of the user are not filtered
+func userFilterQuery(filter model.UserFilter) (string, []interface{}) {
+	conditions := []string{`exists (select 1 from organization_users fou where fou.user_id = u.id and fou.organization_id = ?)`}
+	args := []interface{}{filter.OrganizationID}
+	switch filter.Status {
+	case "deleted":
+		conditions = append(conditions, `u.deleted_at is not null`)
+	case model.UserStatusActive, model.UserStatusDisabled:
+		conditions = append(conditions, `u.deleted_at is null and u.status = ?`)
+		args = append(args, filter.Status)
+	default:
+		conditions = append(conditions, `u.deleted_at is null`)
+	}
+	if search := strings.TrimSpace(filter.Search); len(search) > 0 {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(search)) + "%"
+		conditions = append(conditions, `(lower(u.name) like ? or lower(u.email) like ?)`)
+		args = append(args, pattern, pattern)
+	}
+	if len(filter.Role) > 0 {
+		conditions = append(conditions, `exists (
+					select 1 from user_has_roles fuhr
+					inner join roles fr on fr.id = fuhr.role_id
+					where fuhr.user_id = u.id and fr.code = ?
+				)`)
+		args = append(args, filter.Role)
+	}
+	return "where " + strings.Join(conditions, " and "), args
+}
+
+// userListQuery: user with the roles of it, filter and order come from the caller
+func userListQuery(where, order string) string {
+	return `select 
+					u.id,
+					u.name,
+					u.email,
+					u.verified_at,
+					u.status,
+					u.created_at,
+					u.deleted_at,
+					jsonb_agg(concat('{', 
+						'"id"', ':', r.id , ',',
+						'"code"', ':', '"', r.code , '",',
+						'"name"', ':', '"', r.name , '"',
+					'}')::json) as roles
+				from users as u
+				inner join user_has_roles uhr on u.id = uhr.user_id 
+				inner join roles r on uhr.role_id = r.id
+				` + where + `
+				group by u.id, u.name, u.email, u.verified_at, u.status, u.created_at, u.deleted_at
+				order by ` + order
+}
+
+func setUserRoles(list []model.UserWithRoles) error {
+	for index := range list {
+		var roles []model.Role
+		if err := json.Unmarshal(list[index].Roles, &roles); err != nil {
+			return err
+		}
+		list[index].JsonRoles = roles
+	}
+	return nil
+}
+
+// userSortQuery: only allowlisted column is used in order by
+func userSortQuery(filter model.UserFilter) string {
+	return cursor.Order(userSortKey(filter, nil), false)
+}
+
+// userKey: sort value of the row kept in cursor
+type userKey struct {
+	ID        int        `json:"i"`
+	Name      string     `json:"n"`
+	Email     string     `json:"e"`
+	CreatedAt *time.Time `json:"c"`
+}
+
+func newUserKey(user model.UserWithRoles) userKey {
+	return userKey{ID: user.ID, Name: user.Name, Email: user.Email, CreatedAt: user.CreatedAt}
+}
+
+// userCursorSignature: cursor is only valid for the filter and sort it was created with, value is normalized
+// the same way as userFilterQuery and userSortKey so equivalent request share the cursor
+func userCursorSignature(filter model.UserFilter) string {
+	status := filter.Status
+	if status != "deleted" && status != model.UserStatusActive && status != model.UserStatusDisabled {
+		status = ""
+	}
+	columns := []string{}
+	for _, column := range userSortKey(filter, nil) {
+		if column.Desc {
+			columns = append(columns, "-"+column.Expr)
+			continue
+		}
+		columns = append(columns, column.Expr)
+	}
+	return fmt.Sprintf("%q", []string{strings.ToLower(strings.TrimSpace(filter.Search)), filter.Role, status, strings.Join(columns, ",")})
+}
+
+// userSortKey: id is the last tiebreaker so the order is stable, key fill the cursor value of each column,
+// nullable column is compared through coalesce so null row is not dropped out of the paging
+func userSortKey(filter model.UserFilter, key *userKey) []cursor.Column {
+	if key == nil {
+		key = &userKey{}
+	}
+	columns := map[string]cursor.Column{
+		"name":       {Expr: "coalesce(lower(u.name), '')", Param: "lower(?)", Value: key.Name},
+		"email":      {Expr: "coalesce(lower(u.email), '')", Param: "lower(?)", Value: key.Email},
+		"created_at": {Expr: "u.created_at", Value: key.CreatedAt},
+	}
+	column, ok := columns[filter.Sort]
+	if !ok {
+		return []cursor.Column{{Expr: "u.id", Desc: true, Value: key.ID}}
+	}
+	column.Desc = filter.Order == "desc"
+	return []cursor.Column{column, {Expr: "u.id", Desc: column.Desc, Value: key.ID}}
+}
+
+// likeEscaper: escape wildcard of user input, backslash is the default escape character of like
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
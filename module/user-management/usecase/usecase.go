@@ -1,47 +1,88 @@
 package usecase
 
 import (
-	"crypto/md5"
-	"encoding/hex"
 	"errors"
+	"fmt"
+	"html"
 	"math"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/novalwardhana/golang-boilerplate/config/env"
+	"github.com/novalwardhana/golang-boilerplate/helper/password"
+	"github.com/novalwardhana/golang-boilerplate/helper/token"
+	emailRepository "github.com/novalwardhana/golang-boilerplate/module/email/repository"
 
 	"github.com/novalwardhana/golang-boilerplate/module/user-management/model"
 	"github.com/novalwardhana/golang-boilerplate/module/user-management/repository"
 )
 
 type usecase struct {
-	repo repository.Repository
+	repo      repository.Repository
+	hasher    password.Hasher
+	emailRepo emailRepository.Repository
 }
 
 type Usecase interface {
-	Create(user *model.NewUser) <-chan model.Result
-	GetData(page, limit int) <-chan model.Result
-	Detail(id int) <-chan model.Result
-	Update(user *model.NewUser) <-chan model.Result
-	Delete(id int) <-chan model.Result
+	Create(actorID, organizationID int, user *model.NewUser) <-chan model.Result
+	GetData(page, limit int, filter model.UserFilter) <-chan model.Result
+	GetDataCursor(limit int, after string, estimate bool, filter model.UserFilter) <-chan model.Result
+	Detail(organizationID, id int) <-chan model.Result
+	Update(actorID, organizationID int, user *model.NewUser) <-chan model.Result
+	Delete(actorID, organizationID, id int) <-chan model.Result
+	ResendVerification(organizationID, id int) <-chan model.Result
+	GetLockouts(organizationID int) <-chan model.Result
+	Unlock(organizationID int, kind, value string) <-chan model.Result
+	SetStatus(actorID, organizationID, id int, status string) <-chan model.Result
+	Restore(actorID, organizationID, id int) <-chan model.Result
+	Purge(organizationID, id int) <-chan model.Result
+	GetSessions(organizationID, id int) <-chan model.Result
+	RevokeSessions(actorID, organizationID, id int) <-chan model.Result
+	Import(actorID, organizationID int, rows [][]string, dryRun bool) <-chan model.Result
+	CreateInvitation(organizationID int, request model.InvitationRequest, invitedBy int) <-chan model.Result
+	GetInvitations(organizationID int) <-chan model.Result
+	ResendInvitation(organizationID, id int) <-chan model.Result
+	RevokeInvitation(organizationID, id int) <-chan model.Result
 }
 
-func NewUsecase(repo repository.Repository) Usecase {
+func NewUsecase(repo repository.Repository, hasher password.Hasher, emailRepo emailRepository.Repository) Usecase {
 	return &usecase{
-		repo: repo,
+		repo:      repo,
+		hasher:    hasher,
+		emailRepo: emailRepo,
 	}
 }
 
 // Create:
-func (u *usecase) Create(payload *model.NewUser) <-chan model.Result {
+func (u *usecase) Create(actorID, organizationID int, payload *model.NewUser) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Create new user data process */
 		user := payload.User
-		passwordByte := []byte(user.Password)
-		passwordHex := md5.Sum(passwordByte)
-		passwordHash := hex.EncodeToString(passwordHex[:])
+		user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+		passwordHash, err := u.hasher.Hash(user.Password)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
 		user.Password = passwordHash
+		user.VerifiedAt = nil
+		user.Status = model.UserStatusActive
 		roleIDs := payload.Roles
-		processCreateUser := <-u.repo.Create(&user, roleIDs)
+		if err := u.validateRoles(roleIDs); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		if err := u.checkRoleCeiling(actorID, roleIDs); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		processCreateUser := <-u.repo.Create(organizationID, &user, roleIDs)
 		if processCreateUser.Error != nil {
 			result <- model.Result{Error: processCreateUser.Error}
 			return
@@ -49,6 +90,12 @@ func (u *usecase) Create(payload *model.NewUser) <-chan model.Result {
 		user = *(processCreateUser.Data.(*model.User))
 		user.Password = ""
 
+		/* Send verification email, the user is already created so failure is returned along with the user */
+		emailError := ""
+		if err := u.sendEmailVerification(user); err != nil {
+			emailError = err.Error()
+		}
+
 		/* Get roles process */
 		processGetRoles := <-u.repo.GetRoles(user.ID)
 		if processGetRoles.Error != nil {
@@ -58,10 +105,12 @@ func (u *usecase) Create(payload *model.NewUser) <-chan model.Result {
 		roles := processGetRoles.Data.([]model.Role)
 
 		result <- model.Result{Data: model.UserWithRoles{
-			ID:        user.ID,
-			Name:      user.Name,
-			Email:     user.Email,
-			JsonRoles: roles,
+			ID:         user.ID,
+			Name:       user.Name,
+			Email:      user.Email,
+			VerifiedAt: user.VerifiedAt,
+			JsonRoles:  roles,
+			EmailError: emailError,
 		}}
 
 	}()
@@ -69,13 +118,13 @@ func (u *usecase) Create(payload *model.NewUser) <-chan model.Result {
 }
 
 // GetData:
-func (u *usecase) GetData(page, limit int) <-chan model.Result {
+func (u *usecase) GetData(page, limit int, filter model.UserFilter) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
 		/* Count data process */
-		processCountData := <-u.repo.CountData()
+		processCountData := <-u.repo.CountData(filter)
 		if processCountData.Error != nil {
 			result <- model.Result{Error: processCountData.Error}
 			return
@@ -84,7 +133,7 @@ func (u *usecase) GetData(page, limit int) <-chan model.Result {
 		numberOfPage := int(math.Ceil(float64(totalData) / float64(limit)))
 
 		/* Get data process */
-		processGetData := <-u.repo.GetData(page, limit)
+		processGetData := <-u.repo.GetData(page, limit, filter)
 		if processGetData.Error != nil {
 			result <- model.Result{Error: processGetData.Error}
 			return
@@ -101,12 +150,49 @@ func (u *usecase) GetData(page, limit int) <-chan model.Result {
 	return result
 }
 
+// GetDataCursor: total is not counted, estimate is the cheap replacement of it
+func (u *usecase) GetDataCursor(limit int, after string, estimate bool, filter model.UserFilter) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get data process */
+		processGetData := <-u.repo.GetDataCursor(limit, after, filter)
+		if processGetData.Error != nil {
+			result <- model.Result{Error: processGetData.Error}
+			return
+		}
+		pagination := processGetData.Data.(model.Pagination)
+
+		/* Estimate data process */
+		if estimate {
+			processEstimateData := <-u.repo.EstimateData(filter)
+			if processEstimateData.Error != nil {
+				result <- model.Result{Error: processEstimateData.Error}
+				return
+			}
+			estimatedTotal := processEstimateData.Data.(int)
+			pagination.EstimatedTotal = &estimatedTotal
+		}
+
+		result <- model.Result{Data: pagination}
+
+	}()
+	return result
+}
+
 // Detail:
-func (u *usecase) Detail(id int) <-chan model.Result {
+func (u *usecase) Detail(organizationID, id int) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
+		/* Member check */
+		if err := u.checkMember(organizationID, id); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
 		/* Get user process */
 		processGetUser := <-u.repo.GetUser(id)
 		if processGetUser.Error != nil {
@@ -115,6 +201,10 @@ func (u *usecase) Detail(id int) <-chan model.Result {
 		}
 		user := processGetUser.Data.(model.User)
 		user.Password = ""
+		if user.ID == 0 {
+			result <- model.Result{Error: errors.New("User not found")}
+			return
+		}
 
 		/* Get roles process */
 		processGetRoles := <-u.repo.GetRoles(user.ID)
@@ -125,25 +215,56 @@ func (u *usecase) Detail(id int) <-chan model.Result {
 		roles := processGetRoles.Data.([]model.Role)
 
 		result <- model.Result{Data: model.UserWithRoles{
-			ID:        user.ID,
-			Name:      user.Name,
-			Email:     user.Email,
-			JsonRoles: roles,
+			ID:         user.ID,
+			Name:       user.Name,
+			Email:      user.Email,
+			VerifiedAt: user.VerifiedAt,
+			JsonRoles:  roles,
 		}}
 	}()
 	return result
 }
 
-// Update:
-func (u *usecase) Update(user *model.NewUser) <-chan model.Result {
+// Update: actor can not update user that has role outside the actor roles
+func (u *usecase) Update(actorID, organizationID int, user *model.NewUser) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
-		/* Hash password */
-		passwordHex := md5.Sum([]byte(user.Password))
-		passwordHash := hex.EncodeToString(passwordHex[:])
-		user.Password = passwordHash
+		/* Member check */
+		if err := u.checkManageable(actorID, organizationID, user.ID); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Role validation */
+		if err := u.validateRoles(user.Roles); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		if err := u.checkRoleCeiling(actorID, user.Roles); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Get current roles process */
+		processGetCurrentRoles := <-u.repo.GetRoles(user.ID)
+		if processGetCurrentRoles.Error != nil {
+			result <- model.Result{Error: processGetCurrentRoles.Error}
+			return
+		}
+		rolesChanged := isRolesChanged(processGetCurrentRoles.Data.([]model.Role), user.Roles)
+
+		/* Hash password, empty password keep the current password */
+		passwordChanged := len(user.Password) > 0
+		if passwordChanged {
+			passwordHash, err := u.hasher.Hash(user.Password)
+			if err != nil {
+				result <- model.Result{Error: err}
+				return
+			}
+			user.Password = passwordHash
+		}
 
 		/* Update data process */
 		processUpdateData := <-u.repo.Update(user)
@@ -153,6 +274,15 @@ func (u *usecase) Update(user *model.NewUser) <-chan model.Result {
 		}
 		user := processUpdateData.Data.(model.User)
 
+		/* Revoke token process, token carry the old roles and old password session */
+		if passwordChanged || rolesChanged {
+			processRevoke := <-u.repo.RevokeUserTokens(user.ID, passwordChanged)
+			if processRevoke.Error != nil {
+				result <- model.Result{Error: processRevoke.Error}
+				return
+			}
+		}
+
 		/* Get roles process */
 		processGetRoles := <-u.repo.GetRoles(user.ID)
 		if processGetRoles.Error != nil {
@@ -162,10 +292,11 @@ func (u *usecase) Update(user *model.NewUser) <-chan model.Result {
 		roles := processGetRoles.Data.([]model.Role)
 
 		result <- model.Result{Data: model.UserWithRoles{
-			ID:        user.ID,
-			Name:      user.Name,
-			Email:     user.Email,
-			JsonRoles: roles,
+			ID:         user.ID,
+			Name:       user.Name,
+			Email:      user.Email,
+			VerifiedAt: user.VerifiedAt,
+			JsonRoles:  roles,
 		}}
 
 	}()
@@ -173,11 +304,17 @@ func (u *usecase) Update(user *model.NewUser) <-chan model.Result {
 }
 
 // Delete:
-func (u *usecase) Delete(id int) <-chan model.Result {
+func (u *usecase) Delete(actorID, organizationID, id int) <-chan model.Result {
 	result := make(chan model.Result)
 	go func() {
 		defer close(result)
 
+		/* Member check */
+		if err := u.checkManageable(actorID, organizationID, id); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
 		/* Get roles process */
 		processGetRoles := <-u.repo.GetRoles(id)
 		if processGetRoles.Error != nil {
@@ -206,8 +343,745 @@ func (u *usecase) Delete(id int) <-chan model.Result {
 			return
 		}
 
+		/* Revoke token process */
+		processRevoke := <-u.repo.RevokeUserTokens(id, true)
+		if processRevoke.Error != nil {
+			result <- model.Result{Error: processRevoke.Error}
+			return
+		}
+
 		result <- model.Result{}
 
 	}()
 	return result
 }
+
+// isRolesChanged:
+func isRolesChanged(currentRoles []model.Role, roleIDs []int) bool {
+	current := map[int]bool{}
+	for _, role := range currentRoles {
+		current[role.ID] = true
+	}
+	next := map[int]bool{}
+	for _, roleID := range roleIDs {
+		next[roleID] = true
+	}
+	if len(current) != len(next) {
+		return true
+	}
+	for roleID := range next {
+		if !current[roleID] {
+			return true
+		}
+	}
+	return false
+}
+
+// ResendVerification:
+func (u *usecase) ResendVerification(organizationID, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Member check */
+		if err := u.checkMember(organizationID, id); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Get user process */
+		processGetUser := <-u.repo.GetUser(id)
+		if processGetUser.Error != nil {
+			result <- model.Result{Error: processGetUser.Error}
+			return
+		}
+		user := processGetUser.Data.(model.User)
+		if user.ID == 0 {
+			result <- model.Result{Error: errors.New("User not found")}
+			return
+		}
+		if user.VerifiedAt != nil {
+			result <- model.Result{Error: errors.New("User email already verified")}
+			return
+		}
+
+		/* Send verification email process */
+		if err := u.sendEmailVerification(user); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// GetLockouts:
+func (u *usecase) GetLockouts(organizationID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get lockouts process */
+		processGetLockouts := <-u.repo.GetLoginLockouts(organizationID)
+		if processGetLockouts.Error != nil {
+			result <- model.Result{Error: processGetLockouts.Error}
+			return
+		}
+
+		result <- model.Result{Data: processGetLockouts.Data}
+	}()
+	return result
+}
+
+// Unlock: email is stored in lower case by login tracker
+func (u *usecase) Unlock(organizationID int, kind, value string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Unlock process */
+		if kind == "email" {
+			value = strings.ToLower(strings.TrimSpace(value))
+		}
+		processUnlock := <-u.repo.UnlockLogin(organizationID, kind, value)
+		if processUnlock.Error != nil {
+			result <- model.Result{Error: processUnlock.Error}
+			return
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// GetSessions:
+func (u *usecase) GetSessions(organizationID, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Member check */
+		if err := u.checkMember(organizationID, id); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Get sessions process */
+		processGetSessions := <-u.repo.GetSessions(id)
+		if processGetSessions.Error != nil {
+			result <- model.Result{Error: processGetSessions.Error}
+			return
+		}
+
+		result <- model.Result{Data: processGetSessions.Data}
+	}()
+	return result
+}
+
+// RevokeSessions: force logout user from every session
+func (u *usecase) RevokeSessions(actorID, organizationID, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Member check */
+		if err := u.checkManageable(actorID, organizationID, id); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Get user process */
+		processGetUser := <-u.repo.GetUser(id)
+		if processGetUser.Error != nil {
+			result <- model.Result{Error: processGetUser.Error}
+			return
+		}
+		if processGetUser.Data.(model.User).ID == 0 {
+			result <- model.Result{Error: errors.New("User not found")}
+			return
+		}
+
+		/* Revoke process */
+		processRevoke := <-u.repo.RevokeUserTokens(id, true)
+		if processRevoke.Error != nil {
+			result <- model.Result{Error: processRevoke.Error}
+			return
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// SetStatus: disabled user can not login and the running sessions is ended, the last active root can not be disabled
+func (u *usecase) SetStatus(actorID, organizationID, id int, status string) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Member check */
+		if err := u.checkManageable(actorID, organizationID, id); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Update status process, last root check is done in the same transaction */
+		processSetStatus := <-u.repo.SetStatus(id, status)
+		if processSetStatus.Error != nil {
+			result <- model.Result{Error: processSetStatus.Error}
+			return
+		}
+
+		/* Revoke token process */
+		if status == model.UserStatusDisabled {
+			processRevoke := <-u.repo.RevokeUserTokens(id, true)
+			if processRevoke.Error != nil {
+				result <- model.Result{Error: processRevoke.Error}
+				return
+			}
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// Restore:
+func (u *usecase) Restore(actorID, organizationID, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Member check */
+		if err := u.checkManageable(actorID, organizationID, id); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Restore process */
+		processRestore := <-u.repo.Restore(id)
+		if processRestore.Error != nil {
+			result <- model.Result{Error: processRestore.Error}
+			return
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// Purge:
+func (u *usecase) Purge(organizationID, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Member check */
+		if err := u.checkMember(organizationID, id); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Purge process */
+		processPurge := <-u.repo.Purge(id)
+		if processPurge.Error != nil {
+			result <- model.Result{Error: processPurge.Error}
+			return
+		}
+
+		result <- model.Result{}
+	}()
+	return result
+}
+
+// Import: first row is the header with name, email, and roles column, roles is role codes separated by comma or semicolon.
+// Every row is validated first, dry run stop there, otherwise valid rows are created in batches and invited to set their password
+func (u *usecase) Import(actorID, organizationID int, rows [][]string, dryRun bool) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Header validation */
+		if len(rows) < 2 {
+			result <- model.Result{Error: errors.New("File must have header and at least one row")}
+			return
+		}
+		if maxRows := env.GetInt(env.EnvUserImportMaxRows, 1000); len(rows)-1 > maxRows {
+			result <- model.Result{Error: fmt.Errorf("File can not have more than %d rows", maxRows)}
+			return
+		}
+		columns := map[string]int{}
+		for index, header := range rows[0] {
+			columns[strings.ToLower(strings.TrimSpace(header))] = index
+		}
+		for _, column := range []string{"name", "email", "roles"} {
+			if _, ok := columns[column]; !ok {
+				result <- model.Result{Error: fmt.Errorf("Column %s not found in header", column)}
+				return
+			}
+		}
+
+		/* Parse rows */
+		importRows := []model.ImportRow{}
+		emails := []string{}
+		roleCodes := []string{}
+		for index, row := range rows[1:] {
+			cell := func(column string) string {
+				if columns[column] < len(row) {
+					return strings.TrimSpace(row[columns[column]])
+				}
+				return ""
+			}
+			importRow := model.ImportRow{
+				Row:   index + 2,
+				Name:  cell("name"),
+				Email: strings.ToLower(cell("email")),
+				Roles: strings.FieldsFunc(cell("roles"), func(r rune) bool {
+					return r == ',' || r == ';' || r == '|' || r == ' '
+				}),
+			}
+			if len(importRow.Name) == 0 && len(importRow.Email) == 0 && len(importRow.Roles) == 0 {
+				continue
+			}
+			importRows = append(importRows, importRow)
+			emails = append(emails, importRow.Email)
+			roleCodes = append(roleCodes, importRow.Roles...)
+		}
+
+		/* Get registered emails and roles */
+		processGetExistingEmails := <-u.repo.GetExistingEmails(emails)
+		if processGetExistingEmails.Error != nil {
+			result <- model.Result{Error: processGetExistingEmails.Error}
+			return
+		}
+		existingEmails := map[string]bool{}
+		for _, email := range processGetExistingEmails.Data.([]string) {
+			existingEmails[email] = true
+		}
+		processGetRoles := <-u.repo.GetRolesByCode(roleCodes)
+		if processGetRoles.Error != nil {
+			result <- model.Result{Error: processGetRoles.Error}
+			return
+		}
+		roleIDs := map[string]int{}
+		for _, role := range processGetRoles.Data.([]model.Role) {
+			roleIDs[role.Code] = role.ID
+		}
+		actorRoleIDs, err := u.getActorRoleIDs(actorID)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Validate rows */
+		report := model.ImportReport{DryRun: dryRun, TotalRow: len(importRows)}
+		fileEmails := map[string]int{}
+		for index := range importRows {
+			importRow := &importRows[index]
+			if err := validateImportRow(importRow, roleIDs, actorRoleIDs); err != nil {
+				importRow.Error = err.Error()
+			} else if row, ok := fileEmails[importRow.Email]; ok {
+				importRow.Error = fmt.Sprintf("Email duplicate with row %d", row)
+			} else if existingEmails[importRow.Email] {
+				importRow.Error = "Email already registered"
+			}
+			if len(importRow.Email) > 0 {
+				if _, ok := fileEmails[importRow.Email]; !ok {
+					fileEmails[importRow.Email] = importRow.Row
+				}
+			}
+			if len(importRow.Error) > 0 {
+				importRow.Status = model.ImportRowStatusFailed
+				report.Failed++
+				continue
+			}
+			importRow.Status = model.ImportRowStatusValid
+			report.Valid++
+		}
+		if dryRun || report.Valid == 0 {
+			report.Rows = importRows
+			result <- model.Result{Data: report}
+			return
+		}
+
+		/* Imported user can not login until the password is set from the invite link,
+		 * one unusable hash is shared so the import does not hash a password for every row */
+		randomPassword, _, err := token.Generate(32)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		passwordHash, err := u.hasher.Hash(randomPassword)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		/* Create users in batches */
+		batchSize := env.GetInt(env.EnvUserImportBatchSize, 100)
+		if batchSize < 1 {
+			batchSize = 100
+		}
+		validRows := []*model.ImportRow{}
+		for index := range importRows {
+			if importRows[index].Status == model.ImportRowStatusValid {
+				validRows = append(validRows, &importRows[index])
+			}
+		}
+		for start := 0; start < len(validRows); start += batchSize {
+			end := start + batchSize
+			if end > len(validRows) {
+				end = len(validRows)
+			}
+			batchRows := validRows[start:end]
+			users := []model.User{}
+			roles := [][]int{}
+			for _, importRow := range batchRows {
+				users = append(users, model.User{
+					Name:     importRow.Name,
+					Email:    importRow.Email,
+					Password: passwordHash,
+					Status:   model.UserStatusActive,
+				})
+				roles = append(roles, importRow.RoleIDs)
+			}
+			processCreateBatch := <-u.repo.CreateBatch(organizationID, users, roles)
+			for index, importRow := range batchRows {
+				importRow.Status = model.ImportRowStatusFailed
+				if processCreateBatch.Error != nil {
+					importRow.Error = processCreateBatch.Error.Error()
+					report.Failed++
+					continue
+				}
+				if err := processCreateBatch.Data.([]error)[index]; err != nil {
+					importRow.Error = err.Error()
+					report.Failed++
+					continue
+				}
+				importRow.Status = model.ImportRowStatusCreated
+				importRow.UserID = users[index].ID
+				report.Created++
+
+				/* Send invite email, the user is already created so failure is reported on the row */
+				if err := u.sendInvite(users[index]); err != nil {
+					importRow.EmailError = err.Error()
+				}
+			}
+		}
+		report.Rows = importRows
+
+		result <- model.Result{Data: report}
+	}()
+	return result
+}
+
+// CreateInvitation: the invitee choose their own name and password when accepting, roles are limited to the inviter roles
+func (u *usecase) CreateInvitation(organizationID int, request model.InvitationRequest, invitedBy int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Payload validation */
+		email := strings.ToLower(strings.TrimSpace(request.Email))
+		if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+			result <- model.Result{Error: errors.New("Email not valid")}
+			return
+		}
+		if err := u.validateRoles(request.Roles); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		if err := u.checkRoleCeiling(invitedBy, request.Roles); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		processGetExistingEmails := <-u.repo.GetExistingEmails([]string{email})
+		if processGetExistingEmails.Error != nil {
+			result <- model.Result{Error: processGetExistingEmails.Error}
+			return
+		}
+		if len(processGetExistingEmails.Data.([]string)) > 0 {
+			result <- model.Result{Error: errors.New("Email already registered")}
+			return
+		}
+
+		/* Create invitation process */
+		invitationToken, invitationTokenHash, err := token.Generate(32)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		invitation := model.Invitation{
+			OrganizationID: organizationID,
+			Email:          email,
+			TokenHash:      invitationTokenHash,
+			InvitedBy:      invitedBy,
+			ExpiresAt:      time.Now().Add(env.GetDuration(env.EnvUserInviteTTL, 72*time.Hour)),
+		}
+		processCreateInvitation := <-u.repo.CreateInvitation(&invitation, request.Roles)
+		if processCreateInvitation.Error != nil {
+			result <- model.Result{Error: processCreateInvitation.Error}
+			return
+		}
+
+		/* Send invitation email, the invitation is already created so failure is returned along with it, admin can resend it */
+		if err := u.sendInvitation(invitation.Email, invitationToken); err != nil {
+			invitation.EmailError = err.Error()
+		}
+
+		result <- model.Result{Data: invitation}
+	}()
+	return result
+}
+
+// GetInvitations:
+func (u *usecase) GetInvitations(organizationID int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get invitations process */
+		processGetInvitations := <-u.repo.GetInvitations(organizationID)
+		result <- processGetInvitations
+	}()
+	return result
+}
+
+// ResendInvitation: new token and expiry, link of the previous email stop working
+func (u *usecase) ResendInvitation(organizationID, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Get invitation process */
+		processGetInvitation := <-u.repo.GetInvitation(organizationID, id)
+		if processGetInvitation.Error != nil {
+			result <- model.Result{Error: processGetInvitation.Error}
+			return
+		}
+		invitation := processGetInvitation.Data.(model.Invitation)
+
+		/* Renew invitation process */
+		invitationToken, invitationTokenHash, err := token.Generate(32)
+		if err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+		invitation.ExpiresAt = time.Now().Add(env.GetDuration(env.EnvUserInviteTTL, 72*time.Hour))
+		processRenew := <-u.repo.RenewInvitation(invitation.ID, invitationTokenHash, invitation.ExpiresAt)
+		if processRenew.Error != nil {
+			result <- model.Result{Error: processRenew.Error}
+			return
+		}
+
+		/* Send invitation email */
+		if err := u.sendInvitation(invitation.Email, invitationToken); err != nil {
+			result <- model.Result{Error: err}
+			return
+		}
+
+		result <- model.Result{Data: invitation}
+	}()
+	return result
+}
+
+// RevokeInvitation:
+func (u *usecase) RevokeInvitation(organizationID, id int) <-chan model.Result {
+	result := make(chan model.Result)
+	go func() {
+		defer close(result)
+
+		/* Revoke invitation process */
+		processRevoke := <-u.repo.RevokeInvitation(organizationID, id)
+		result <- processRevoke
+	}()
+	return result
+}
+
+// validateImportRow: fill role id of the row, root role can not be given from a file and actorRoleIDs nil is root actor
+func validateImportRow(importRow *model.ImportRow, roleIDs map[string]int, actorRoleIDs map[int]bool) error {
+	if len(importRow.Name) == 0 {
+		return errors.New("Name must be filled")
+	}
+	if len(importRow.Email) == 0 {
+		return errors.New("Email must be filled")
+	}
+	if address, err := mail.ParseAddress(importRow.Email); err != nil || address.Address != importRow.Email {
+		return errors.New("Email not valid")
+	}
+	if len(importRow.Roles) == 0 {
+		return errors.New("Roles must be filled")
+	}
+	uniqueRoles := map[string]bool{}
+	for _, code := range importRow.Roles {
+		if uniqueRoles[code] {
+			continue
+		}
+		uniqueRoles[code] = true
+		if code == "root" {
+			return errors.New("Role root can not be imported")
+		}
+		roleID, ok := roleIDs[code]
+		if !ok {
+			return fmt.Errorf("Role %s not found", code)
+		}
+		if actorRoleIDs != nil && !actorRoleIDs[roleID] {
+			return fmt.Errorf("Role %s outside your roles", code)
+		}
+		importRow.RoleIDs = append(importRow.RoleIDs, roleID)
+	}
+	return nil
+}
+
+// checkMember: user of other organization is reported as not found
+func (u *usecase) checkMember(organizationID, userID int) error {
+	processIsMember := <-u.repo.IsMember(organizationID, userID)
+	if processIsMember.Error != nil {
+		return processIsMember.Error
+	}
+	if !processIsMember.Data.(bool) {
+		return errors.New("User not found")
+	}
+	return nil
+}
+
+// checkManageable: role, password, status, and deletion of user is shared by every organization of the user,
+// user with role outside the actor roles is changed only by root
+func (u *usecase) checkManageable(actorID, organizationID, userID int) error {
+	if err := u.checkMember(organizationID, userID); err != nil {
+		return err
+	}
+	actorRoleIDs, err := u.getActorRoleIDs(actorID)
+	if err != nil || actorRoleIDs == nil {
+		return err
+	}
+	processGetRoles := <-u.repo.GetRoles(userID)
+	if processGetRoles.Error != nil {
+		return processGetRoles.Error
+	}
+	for _, role := range processGetRoles.Data.([]model.Role) {
+		if !actorRoleIDs[role.ID] {
+			return errors.New("Cannot change user with role outside your roles")
+		}
+	}
+	processIsMemberOfOther := <-u.repo.IsMemberOfOtherOrganization(organizationID, userID)
+	if processIsMemberOfOther.Error != nil {
+		return processIsMemberOfOther.Error
+	}
+	if processIsMemberOfOther.Data.(bool) {
+		return errors.New("User also belongs to other organization, only root can change it")
+	}
+	return nil
+}
+
+// validateRoles: user must have at least one role and every role must exist
+func (u *usecase) validateRoles(roleIDs []int) error {
+	if len(roleIDs) == 0 {
+		return errors.New("Roles must be filled")
+	}
+	uniqueRoleIDs := map[int]bool{}
+	for _, roleID := range roleIDs {
+		uniqueRoleIDs[roleID] = true
+	}
+	if len(uniqueRoleIDs) != len(roleIDs) {
+		return errors.New("Roles must be unique")
+	}
+	processCountRoles := <-u.repo.CountRoles(roleIDs)
+	if processCountRoles.Error != nil {
+		return processCountRoles.Error
+	}
+	if int(processCountRoles.Data.(int64)) != len(roleIDs) {
+		return errors.New("Role not found")
+	}
+	return nil
+}
+
+// checkRoleCeiling: actor can only give roles it has, so root role is given only by root and root has no ceiling
+func (u *usecase) checkRoleCeiling(actorID int, roleIDs []int) error {
+	actorRoleIDs, err := u.getActorRoleIDs(actorID)
+	if err != nil || actorRoleIDs == nil {
+		return err
+	}
+	for _, roleID := range roleIDs {
+		if !actorRoleIDs[roleID] {
+			return errors.New("Cannot give role outside your roles")
+		}
+	}
+	return nil
+}
+
+// getActorRoleIDs: nil when the actor is root
+func (u *usecase) getActorRoleIDs(actorID int) (map[int]bool, error) {
+	processGetActorRoles := <-u.repo.GetRoles(actorID)
+	if processGetActorRoles.Error != nil {
+		return nil, processGetActorRoles.Error
+	}
+	actorRoleIDs := map[int]bool{}
+	for _, role := range processGetActorRoles.Data.([]model.Role) {
+		if role.Code == "root" {
+			return nil, nil
+		}
+		actorRoleIDs[role.ID] = true
+	}
+	return actorRoleIDs, nil
+}
+
+// sendInvite: invite is a password reset token with longer lifetime, setting the password also verify the email
+func (u *usecase) sendInvite(user model.User) error {
+
+	/* Create reset token */
+	resetToken, resetTokenHash, err := token.Generate(32)
+	if err != nil {
+		return err
+	}
+	processCreate := <-u.repo.CreatePasswordReset(&model.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: resetTokenHash,
+		ExpiresAt: time.Now().Add(env.GetDuration(env.EnvUserInviteTTL, 72*time.Hour)),
+	})
+	if processCreate.Error != nil {
+		return processCreate.Error
+	}
+
+	/* Send set password link */
+	link := fmt.Sprintf("%s?token=%s", os.Getenv(env.EnvPasswordResetURL), url.QueryEscape(resetToken))
+	text := fmt.Sprintf("Hi %s, an account has been created for you.<br/>"+
+		"Open <a href=\"%s\">this link</a> to set your password, the link is valid for one time use only.", html.EscapeString(user.Name), html.EscapeString(link))
+	processSendMail := <-u.emailRepo.SendMailDefault(user.Email, "Set your password", text)
+	return processSendMail.Error
+}
+
+// sendInvitation:
+func (u *usecase) sendInvitation(email, invitationToken string) error {
+	link := fmt.Sprintf("%s?token=%s", os.Getenv(env.EnvUserInvitationURL), url.QueryEscape(invitationToken))
+	text := fmt.Sprintf("Hi, you have been invited to create an account.<br/>"+
+		"Open <a href=\"%s\">this link</a> to choose your name and password, the link is valid for one time use only.", html.EscapeString(link))
+	processSendMail := <-u.emailRepo.SendMailDefault(email, "You are invited", text)
+	return processSendMail.Error
+}
+
+// sendEmailVerification:
+func (u *usecase) sendEmailVerification(user model.User) error {
+
+	/* Create verification token */
+	verificationToken, verificationTokenHash, err := token.Generate(32)
+	if err != nil {
+		return err
+	}
+	processCreate := <-u.repo.CreateEmailVerification(&model.EmailVerification{
+		UserID:    user.ID,
+		TokenHash: verificationTokenHash,
+		ExpiresAt: time.Now().Add(env.GetDuration(env.EnvEmailVerificationTTL, 48*time.Hour)),
+	})
+	if processCreate.Error != nil {
+		return processCreate.Error
+	}
+
+	/* Send verification link */
+	link := fmt.Sprintf("%s?token=%s", os.Getenv(env.EnvEmailVerificationURL), url.QueryEscape(verificationToken))
+	text := fmt.Sprintf("Hi %s, your account has been created.<br/>"+
+		"Open <a href=\"%s\">this link</a> to verify your email address.", html.EscapeString(user.Name), html.EscapeString(link))
+	processSendMail := <-u.emailRepo.SendMailDefault(user.Email, "Verify your email address", text)
+	return processSendMail.Error
+}